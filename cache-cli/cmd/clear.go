@@ -18,7 +18,13 @@ var clearCmd = &cobra.Command{
 }
 
 func RunClear(cmd *cobra.Command, args []string) {
-	storage, err := storage.InitStorage()
+	scope := findScope(cmd)
+	if storage.IsReadOnlyScope(scope) {
+		log.Errorf("Scope '%s' is read-only, nothing will be deleted.", scope)
+		return
+	}
+
+	storage, err := storage.InitStorageWithConfig(storage.StorageConfig{SortKeysBy: storage.SortByStoreTime, Scope: scope})
 	utils.Check(err)
 
 	err = storage.Clear()
@@ -27,5 +33,6 @@ func RunClear(cmd *cobra.Command, args []string) {
 }
 
 func init() {
+	addScopeFlag(clearCmd, "Scope to remove all keys from: project, org, or the name of a custom scope shared by all projects.")
 	RootCmd.AddCommand(clearCmd)
 }
@@ -1,36 +1,72 @@
 package cmd
 
 import (
+	"time"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
 	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
 	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
-var deleteCmd = &cobra.Command{
-	Use:   "delete [key]",
-	Short: "Delete a key from the cache.",
-	Long:  ``,
-	Args:  cobra.ArbitraryArgs,
-	Run: func(cmd *cobra.Command, args []string) {
-		RunDelete(cmd, args)
-	},
+func NewDeleteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete [key]",
+		Short: "Delete a key from the cache.",
+		Long: `Delete a key from the cache.
+If no key is given, all keys matching the filters are deleted.`,
+		Args: cobra.ArbitraryArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			RunDelete(cmd, args)
+		},
+	}
+
+	addKeyFilterFlags(cmd, "Delete")
+	cmd.Flags().Bool("dry-run", false, "Only show which keys would be deleted, without deleting anything.")
+	addScopeFlag(cmd, "Scope to delete keys from: project, org, or the name of a custom scope shared by all projects.")
+	return cmd
 }
 
 func RunDelete(cmd *cobra.Command, args []string) {
-	if len(args) != 1 {
+	filtered, err := usesKeyFilter(cmd)
+	if err != nil {
+		log.Errorf("Invalid filter: %v", err)
+		return
+	}
+
+	if (!filtered && len(args) != 1) || (filtered && len(args) != 0) {
 		log.Errorf("Incorrect number of arguments!")
 		_ = cmd.Help()
 		return
 	}
 
-	storage, err := storage.InitStorage()
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	utils.Check(err)
+
+	scope := findScope(cmd)
+	if storage.IsReadOnlyScope(scope) && !dryRun {
+		log.Errorf("Scope '%s' is read-only, nothing will be deleted.", scope)
+		return
+	}
+
+	storage, err := storage.InitStorageWithConfig(storage.StorageConfig{SortKeysBy: storage.SortByStoreTime, Scope: scope})
 	utils.Check(err)
 
+	if filtered {
+		deleteMatchingKeys(storage, buildKeyFilter(cmd, time.Now()), dryRun)
+		return
+	}
+
 	rawKey := args[0]
 	key := NormalizeKey(rawKey)
 
 	if ok, _ := storage.HasKey(key); ok {
+		if dryRun {
+			log.Infof("[dry-run] Key '%s' would be deleted.", key)
+			return
+		}
+
 		err := storage.Delete(key)
 		utils.Check(err)
 		log.Infof("Key '%s' is deleted.", key)
@@ -39,6 +75,36 @@ func RunDelete(cmd *cobra.Command, args []string) {
 	}
 }
 
+func deleteMatchingKeys(storage storage.Storage, filter storage.KeyFilter, dryRun bool) {
+	keys, err := storage.List()
+	utils.Check(err)
+
+	matching := filter.Filter(keys)
+	if len(matching) == 0 {
+		log.Info("No keys match the filters.")
+		return
+	}
+
+	var totalSize int64
+	for _, key := range matching {
+		totalSize += key.Size
+		if dryRun {
+			log.Infof("[dry-run] Key '%s' (%s) would be deleted.", key.Name, files.HumanReadableSize(key.Size))
+		} else {
+			log.Infof("Deleting key '%s' (%s)...", key.Name, files.HumanReadableSize(key.Size))
+		}
+	}
+
+	if dryRun {
+		log.Infof("[dry-run] %d key(s) would be deleted, freeing %s.", len(matching), files.HumanReadableSize(totalSize))
+		return
+	}
+
+	err = storage.DeleteMany(matching)
+	utils.Check(err)
+	log.Infof("Deleted %d key(s), freeing %s.", len(matching), files.HumanReadableSize(totalSize))
+}
+
 func init() {
-	RootCmd.AddCommand(deleteCmd)
+	RootCmd.AddCommand(NewDeleteCommand())
 }
@@ -13,6 +13,7 @@ import (
 )
 
 func Test__Delete(t *testing.T) {
+	deleteCmd := NewDeleteCommand()
 	log.SetFormatter(new(logging.CustomFormatter))
 	log.SetLevel(log.InfoLevel)
 	log.SetOutput(openLogfileForTests(t))
@@ -47,5 +48,117 @@ func Test__Delete(t *testing.T) {
 			assert.Contains(t, output, "Key 'abc/00/33' is normalized to 'abc-00-33'")
 			assert.Contains(t, output, "Key 'abc-00-33' is deleted.")
 		})
+
+		t.Run(fmt.Sprintf("%s key and filters", backend), func(*testing.T) {
+			prefixDeleteCmd := NewDeleteCommand()
+			prefixDeleteCmd.Flags().Set("prefix", "abc")
+
+			RunDelete(prefixDeleteCmd, []string{"abc001"})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "Incorrect number of arguments!")
+		})
+
+		t.Run(fmt.Sprintf("%s deletes keys with prefix", backend), func(*testing.T) {
+			storage.Clear()
+			tempFile, _ := ioutil.TempFile(os.TempDir(), "*")
+			storage.Store("gems-master-1", tempFile.Name())
+			storage.Store("gems-dev-2", tempFile.Name())
+			storage.Store("node-modules-master-3", tempFile.Name())
+
+			prefixDeleteCmd := NewDeleteCommand()
+			prefixDeleteCmd.Flags().Set("prefix", "gems-")
+			RunDelete(prefixDeleteCmd, []string{})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "Deleting key 'gems-master-1'")
+			assert.Contains(t, output, "Deleting key 'gems-dev-2'")
+			assert.Contains(t, output, "Deleted 2 key(s)")
+
+			keys, _ := storage.List()
+			if assert.Len(t, keys, 1) {
+				assert.Equal(t, "node-modules-master-3", keys[0].Name)
+			}
+		})
+
+		t.Run(fmt.Sprintf("%s deletes keys matching regex", backend), func(*testing.T) {
+			storage.Clear()
+			tempFile, _ := ioutil.TempFile(os.TempDir(), "*")
+			storage.Store("gems-master-1", tempFile.Name())
+			storage.Store("gems-dev-2", tempFile.Name())
+			storage.Store("node-modules-master-3", tempFile.Name())
+
+			regexDeleteCmd := NewDeleteCommand()
+			regexDeleteCmd.Flags().Set("regex", "-master-")
+			RunDelete(regexDeleteCmd, []string{})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "Deleted 2 key(s)")
+
+			keys, _ := storage.List()
+			if assert.Len(t, keys, 1) {
+				assert.Equal(t, "gems-dev-2", keys[0].Name)
+			}
+		})
+
+		t.Run(fmt.Sprintf("%s nothing matches filters", backend), func(*testing.T) {
+			storage.Clear()
+			tempFile, _ := ioutil.TempFile(os.TempDir(), "*")
+			storage.Store("abc001", tempFile.Name())
+
+			olderThanDeleteCmd := NewDeleteCommand()
+			olderThanDeleteCmd.Flags().Set("older-than", "30d")
+			RunDelete(olderThanDeleteCmd, []string{})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "No keys match the filters.")
+		})
+
+		t.Run(fmt.Sprintf("%s empty prefix deletes nothing", backend), func(*testing.T) {
+			storage.Clear()
+			tempFile, _ := ioutil.TempFile(os.TempDir(), "*")
+			storage.Store("abc001", tempFile.Name())
+
+			emptyPrefixDeleteCmd := NewDeleteCommand()
+			emptyPrefixDeleteCmd.Flags().Set("prefix", "")
+			RunDelete(emptyPrefixDeleteCmd, []string{})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "Invalid filter: --prefix can't be empty")
+			keys, _ := storage.List()
+			assert.Len(t, keys, 1)
+		})
+
+		t.Run(fmt.Sprintf("%s zero-valued filters are used", backend), func(*testing.T) {
+			storage.Clear()
+			tempFile, _ := ioutil.TempFile(os.TempDir(), "*")
+			storage.Store("abc001", tempFile.Name())
+
+			largerThanDeleteCmd := NewDeleteCommand()
+			largerThanDeleteCmd.Flags().Set("larger-than", "0")
+			RunDelete(largerThanDeleteCmd, []string{})
+			output := readOutputFromFile(t)
+
+			assert.NotContains(t, output, "Incorrect number of arguments!")
+			assert.Contains(t, output, "No keys match the filters.")
+		})
+
+		t.Run(fmt.Sprintf("%s dry run does not delete anything", backend), func(*testing.T) {
+			storage.Clear()
+			tempFile, _ := ioutil.TempFile(os.TempDir(), "*")
+			storage.Store("abc001", tempFile.Name())
+
+			dryRunDeleteCmd := NewDeleteCommand()
+			dryRunDeleteCmd.Flags().Set("prefix", "abc")
+			dryRunDeleteCmd.Flags().Set("dry-run", "true")
+			RunDelete(dryRunDeleteCmd, []string{})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "[dry-run] Key 'abc001' (0.0) would be deleted.")
+			assert.Contains(t, output, "[dry-run] 1 key(s) would be deleted, freeing 0.0.")
+
+			keys, _ := storage.List()
+			assert.Len(t, keys, 1)
+		})
 	})
 }
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/docker"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func NewDockerCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "docker",
+		Short: "Store and restore Docker images.",
+		Long: `Store Docker images in the cache, and load them back into Docker.
+Layers are stored separately, so layers shared between images are only uploaded once.`,
+	}
+
+	cmd.AddCommand(NewDockerStoreCommand())
+	cmd.AddCommand(NewDockerRestoreCommand())
+	return cmd
+}
+
+func NewDockerStoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "store [image]...",
+		Short: "Store Docker images in the cache.",
+		Long:  ``,
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			RunDockerStore(cmd, args)
+		},
+	}
+
+	addScopeFlag(cmd, "Scope to store images in: project, org, or the name of a custom scope shared by all projects.")
+	return cmd
+}
+
+func NewDockerRestoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore [image]...",
+		Short: "Load Docker images from the cache.",
+		Long:  `Load the given images from the cache. If no images are given, every image in the cache is loaded.`,
+		Args:  cobra.ArbitraryArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			RunDockerRestore(cmd, args)
+		},
+	}
+
+	addScopeFlag(cmd, "Scope to restore images from: project, org, or the name of a custom scope shared by all projects.")
+	return cmd
+}
+
+func RunDockerStore(cmd *cobra.Command, args []string) {
+	scope, err := cmd.Flags().GetString("scope")
+	utils.Check(err)
+
+	if storage.IsReadOnlyScope(scope) {
+		log.Errorf("Scope '%s' is read-only, nothing will be stored.", scope)
+		return
+	}
+
+	storage, err := storage.InitStorageWithConfig(storage.StorageConfig{SortKeysBy: storage.SortByStoreTime, Scope: scope})
+	utils.Check(err)
+
+	imageCache := docker.NewImageCache(storage)
+	for _, image := range args {
+		err := imageCache.Store(image)
+		if err != nil {
+			log.Errorf("Error storing image '%s': %v", image, err)
+		}
+	}
+}
+
+func RunDockerRestore(cmd *cobra.Command, args []string) {
+	scope, err := cmd.Flags().GetString("scope")
+	utils.Check(err)
+
+	storage, err := storage.InitStorageWithConfig(storage.StorageConfig{SortKeysBy: storage.SortByStoreTime, Scope: scope})
+	utils.Check(err)
+
+	imageCache := docker.NewImageCache(storage)
+	images := args
+	if len(images) == 0 {
+		images, err = imageCache.Images()
+		utils.Check(err)
+
+		if len(images) == 0 {
+			log.Info("No images in the cache.")
+			return
+		}
+	}
+
+	for _, image := range images {
+		found, err := imageCache.Restore(image)
+		if err != nil {
+			log.Errorf("Error restoring image '%s': %v", image, err)
+			continue
+		}
+
+		if !found {
+			log.Infof("Image '%s' is not in the cache.", image)
+		}
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(NewDockerCommand())
+}
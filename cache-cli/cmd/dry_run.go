@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Resolves the key that would be restored, without downloading anything.
+func describeRestore(logger *log.Entry, storages []scopedStorage, keys []string, path string, options restoreOptions) (restoreOutcome, error) {
+	outcome := restoreOutcome{Status: RestoreMiss, Keys: keys, Path: path}
+
+	match, storage, err := resolveRestoreKeyInScopes(logger, storages, keys, options)
+	if err != nil {
+		outcome.fail(err)
+		return outcome, err
+	}
+
+	if match == nil {
+		logger.Info("[dry-run] Nothing would be restored.")
+		return outcome, nil
+	}
+
+	outcome.MatchedKey = match.Key
+	outcome.Scope = match.Scope
+	outcome.Status = hitStatus(match.ScopeIndex == 0 && match.Index == 0 && match.Exact)
+	outcome.SizeBytes = remoteKeySize(storage, match.Key)
+	logger.Infof("[dry-run] Would download key '%s' (%s).", match.Key, files.HumanReadableSize(outcome.SizeBytes))
+
+	if options.To != "" {
+		logger.Infof("[dry-run] Would restore under '%s' (%s).", options.To, describeLocalPath(options.To))
+	} else if path != "" {
+		logger.Infof("[dry-run] Would restore into '%s' (%s).", path, describeLocalPath(path))
+	}
+
+	return outcome, nil
+}
+
+// Checks what would be uploaded for the key, without compressing anything.
+func describeStore(logger *log.Entry, storage storage.Storage, rawKey, path string, options storeOptions) {
+	key := normalizeKey(logger, rawKey)
+	if _, err := os.Stat(path); err != nil {
+		logger.Infof("[dry-run] '%s' doesn't exist locally, nothing would be uploaded.", path)
+		return
+	}
+
+	ok, err := storage.HasKey(key)
+	utils.Check(err)
+
+	if ok && options.Overwrite {
+		logger.Infof("[dry-run] Key '%s' already exists, it would be overwritten with '%s' (%s).", key, path, describeLocalPath(path))
+		return
+	}
+
+	if ok {
+		logger.Infof("[dry-run] Key '%s' already exists, '%s' (%s) would not be uploaded.", key, path, describeLocalPath(path))
+		return
+	}
+
+	if options.SkipUnchanged {
+		manifest, err := files.UnchangedSinceRestore(files.DefaultManifestDirectory(), key, path)
+		if err == nil && manifest != nil {
+			logger.Infof("[dry-run] '%s' did not change since it was restored using key '%s', nothing would be uploaded.", path, manifest.Key)
+			return
+		}
+	}
+
+	logger.Infof("[dry-run] Would compress and upload '%s' (%s) with cache key '%s'.", path, describeLocalPath(path), key)
+}
+
+func remoteKeySize(storage storage.Storage, key string) int64 {
+	cacheKey := findCacheKey(storage, key)
+	if cacheKey == nil {
+		return 0
+	}
+
+	return cacheKey.Size
+}
+
+func describeLocalPath(path string) string {
+	if _, err := os.Stat(path); err != nil {
+		return "doesn't exist locally"
+	}
+
+	size, err := files.PathSize(path)
+	if err != nil {
+		return fmt.Sprintf("error finding local size: %v", err)
+	}
+
+	return fmt.Sprintf("local size: %s", files.HumanReadableSize(size))
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func NewGCCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Evict keys until the cache fits in its size limit.",
+		Long: `Evict keys until the cache fits in its size limit, using the same policy
+used by store when there is not enough space.
+With --dry-run, nothing is deleted, and the keys that would be evicted
+under each of the possible policies are shown instead.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			RunGC(cmd, args)
+		},
+	}
+
+	description := fmt.Sprintf(
+		`Keys are sorted in descending order using the specified field, and evicted starting from the last key on the list. Possible values are: %v.`,
+		strings.Join(storage.ValidSortByKeys, ","),
+	)
+
+	cmd.Flags().StringP("cleanup-by", "c", storage.SortByStoreTime, description)
+	cmd.Flags().String("max-size", "", "Size the cache should fit in, e.g. 5G. Defaults to the size limit of the cache backend.")
+	cmd.Flags().String("pinned", "", "Comma-separated key patterns that are never evicted, e.g. '*-main'. Defaults to SEMAPHORE_CACHE_PINNED_KEYS.")
+	cmd.Flags().Bool("dry-run", false, "Only show which keys would be evicted under each policy, without deleting anything.")
+	addScopeFlag(cmd, "Scope to evict keys from: project, org, or the name of a custom scope shared by all projects.")
+	addOutputFlag(cmd)
+	return cmd
+}
+
+func RunGC(cmd *cobra.Command, args []string) {
+	cleanupBy, err := cmd.Flags().GetString("cleanup-by")
+	utils.Check(err)
+
+	maxSizeFlag, err := cmd.Flags().GetString("max-size")
+	utils.Check(err)
+
+	pinnedFlag, err := cmd.Flags().GetString("pinned")
+	utils.Check(err)
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	utils.Check(err)
+
+	output := findOutputFormat(cmd)
+	scope := findScope(cmd)
+	if storage.IsReadOnlyScope(scope) && !dryRun {
+		log.Errorf("Scope '%s' is read-only, nothing will be evicted.", scope)
+		return
+	}
+
+	pinned := storage.PinnedKeysFromEnv()
+	if pinnedFlag != "" {
+		pinned, err = storage.ParsePinnedKeys(pinnedFlag)
+		utils.Check(err)
+	}
+
+	policy := storage.EvictionPolicy{SortKeysBy: cleanupBy, Pinned: pinned}
+	storage, err := storage.InitStorageWithConfig(storage.StorageConfig{SortKeysBy: cleanupBy, Scope: scope})
+	utils.Check(err)
+
+	maxSize := storage.Config().MaxSpace
+	if maxSizeFlag != "" {
+		maxSize, err = files.ParseSize(maxSizeFlag)
+		utils.Check(err)
+	}
+
+	usage, err := storage.Usage()
+	utils.Check(err)
+
+	if maxSizeFlag == "" && usage.Free == -1 {
+		log.Info("The cache has no size limit, use --max-size to choose one.")
+		return
+	}
+
+	keys, err := storage.List()
+	utils.Check(err)
+
+	required := usage.Used - maxSize
+	if dryRun {
+		plans := evictionPlans(keys, required, pinned)
+		if output != OutputText {
+			writeOutput(cmd, output, plans, []string{"policy", "name", "size"}, evictionPlanRows(plans))
+			return
+		}
+
+		log.Infof("Cache uses %s of %s.", files.HumanReadableSize(usage.Used), files.HumanReadableSize(maxSize))
+		for _, plan := range plans {
+			log.Info(formatEvictionPlan(plan, plan.Policy == cleanupBy))
+		}
+
+		return
+	}
+
+	if required <= 0 {
+		log.Infof("Cache uses %s of %s, nothing to evict.", files.HumanReadableSize(usage.Used), files.HumanReadableSize(maxSize))
+		return
+	}
+
+	evictKeys(storage, policy.Plan(keys, required))
+}
+
+func evictKeys(s storage.Storage, plan *storage.EvictionPlan) {
+	if !plan.IsEnough() {
+		log.Warnf("Only %s out of %s can be freed without evicting pinned keys.", files.HumanReadableSize(plan.Freed), files.HumanReadableSize(plan.Required))
+	}
+
+	err := storage.Evict(s, plan)
+	utils.Check(err)
+
+	log.Infof("Evicted %d keys, freeing %s.", len(plan.Evicted), files.HumanReadableSize(plan.Freed))
+}
+
+func evictionPlans(keys []storage.CacheKey, required int64, pinned []string) []*storage.EvictionPlan {
+	plans := []*storage.EvictionPlan{}
+	for _, sortKeysBy := range storage.ValidSortByKeys {
+		policy := storage.EvictionPolicy{SortKeysBy: sortKeysBy, Pinned: pinned}
+		plans = append(plans, policy.Plan(keys, required))
+	}
+
+	return plans
+}
+
+func evictionPlanRows(plans []*storage.EvictionPlan) [][]string {
+	rows := [][]string{}
+	for _, plan := range plans {
+		for _, key := range plan.Evicted {
+			rows = append(rows, []string{plan.Policy, key.Name, strconv.FormatInt(key.Size, 10)})
+		}
+	}
+
+	return rows
+}
+
+func formatEvictionPlan(plan *storage.EvictionPlan, current bool) string {
+	title := fmt.Sprintf("POLICY %s", plan.Policy)
+	if current {
+		title += " (selected)"
+	}
+
+	if len(plan.Evicted) == 0 {
+		return fmt.Sprintf("%s: nothing to evict.\n", title)
+	}
+
+	formatted := fmt.Sprintf("%s: %d keys would be evicted, freeing %s.\n", title, len(plan.Evicted), files.HumanReadableSize(plan.Freed))
+	if !plan.IsEnough() {
+		formatted += fmt.Sprintf("Only %s out of %s can be freed without evicting pinned keys.\n", files.HumanReadableSize(plan.Freed), files.HumanReadableSize(plan.Required))
+	}
+
+	formatted += formatList(plan.Evicted)
+	for _, key := range plan.Pinned {
+		formatted += fmt.Sprintf("Key '%s' is pinned, and would be kept.\n", key.Name)
+	}
+
+	return formatted
+}
+
+func init() {
+	RootCmd.AddCommand(NewGCCommand())
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/logging"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	log "github.com/sirupsen/logrus"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__GC(t *testing.T) {
+	log.SetFormatter(new(logging.CustomFormatter))
+	log.SetLevel(log.InfoLevel)
+	log.SetOutput(openLogfileForTests(t))
+
+	storeKeys := func(storage storage.Storage) {
+		_ = storage.Clear()
+		for key, size := range map[string]int{"small-main": 100, "small": 200, "large": 1000} {
+			tempFile, _ := ioutil.TempFile(os.TempDir(), "*")
+			_, _ = tempFile.WriteString(strings.Repeat("x", size))
+			_ = tempFile.Close()
+			_ = storage.Store(key, tempFile.Name())
+			os.Remove(tempFile.Name())
+		}
+	}
+
+	runTestForAllBackends(t, func(backend string, storage storage.Storage) {
+		t.Run(fmt.Sprintf("%s dry run", backend), func(t *testing.T) {
+			storeKeys(storage)
+
+			gcCmd := NewGCCommand()
+			gcCmd.Flags().Set("max-size", "1000")
+			gcCmd.Flags().Set("dry-run", "true")
+			RunGC(gcCmd, []string{})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "POLICY SIZE: 2 keys would be evicted")
+			keys, _ := storage.List()
+			assert.Len(t, keys, 3)
+		})
+
+		t.Run(fmt.Sprintf("%s evicts keys", backend), func(t *testing.T) {
+			storeKeys(storage)
+
+			gcCmd := NewGCCommand()
+			gcCmd.Flags().Set("max-size", "1000")
+			gcCmd.Flags().Set("cleanup-by", "SIZE")
+			RunGC(gcCmd, []string{})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "Evicted 2 keys")
+			keys, _ := storage.List()
+			assert.Equal(t, []string{"large"}, keyNames(keys))
+		})
+
+		t.Run(fmt.Sprintf("%s pinned keys are kept", backend), func(t *testing.T) {
+			storeKeys(storage)
+
+			gcCmd := NewGCCommand()
+			gcCmd.Flags().Set("max-size", "1000")
+			gcCmd.Flags().Set("cleanup-by", "SIZE")
+			gcCmd.Flags().Set("pinned", "*-main")
+			RunGC(gcCmd, []string{})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "Evicted 2 keys")
+			keys, _ := storage.List()
+			assert.Equal(t, []string{"small-main"}, keyNames(keys))
+		})
+
+		t.Run(fmt.Sprintf("%s nothing to evict", backend), func(t *testing.T) {
+			storeKeys(storage)
+
+			gcCmd := NewGCCommand()
+			gcCmd.Flags().Set("max-size", "10K")
+			RunGC(gcCmd, []string{})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "nothing to evict")
+		})
+	})
+}
+
+func keyNames(keys []storage.CacheKey) []string {
+	names := []string{}
+	for _, key := range keys {
+		names = append(names, key.Name)
+	}
+
+	return names
+}
+
+func Test__FormatEvictionPlan(t *testing.T) {
+	storedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	keys := []storage.CacheKey{
+		{Name: "deps-main", Size: 300, StoredAt: &storedAt, LastAccessedAt: &storedAt},
+		{Name: "deps-feature", Size: 200, StoredAt: &storedAt, LastAccessedAt: &storedAt},
+		{Name: "build-feature", Size: 100, StoredAt: &storedAt, LastAccessedAt: &storedAt},
+	}
+
+	plans := evictionPlans(keys, 250, []string{"*-main"})
+	assert.Len(t, plans, len(storage.ValidSortByKeys))
+
+	sizePlan := plans[0]
+	assert.Equal(t, storage.SortBySize, sizePlan.Policy)
+
+	formatted := formatEvictionPlan(sizePlan, true)
+	assert.Contains(t, formatted, "POLICY SIZE (selected): 2 keys would be evicted, freeing 300.0.")
+	assert.Contains(t, formatted, "build-feature")
+	assert.Contains(t, formatted, "deps-feature")
+	assert.NotContains(t, formatted, "Only")
+
+	plans = evictionPlans(keys, 1000, []string{"*-main"})
+	formatted = formatEvictionPlan(plans[0], false)
+	assert.Contains(t, formatted, "Only 300.0 out of 1000.0 can be freed without evicting pinned keys.")
+	assert.Contains(t, formatted, "Key 'deps-main' is pinned, and would be kept.")
+
+	assert.Equal(t, "POLICY SIZE: nothing to evict.\n", formatEvictionPlan(evictionPlans(keys, 0, nil)[0], false))
+	assert.Equal(t, []string{storage.SortBySize, "build-feature", "100"}, evictionPlanRows(plans)[0])
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/gocache"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func NewGoCacheProgCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gocacheprog",
+		Short: "Share the Go build cache between jobs.",
+		Long: `Implement the GOCACHEPROG protocol, so the go command reads and writes
+its build cache through the configured cache backend, one compiled package at a time.
+The go command starts it by itself, with:
+
+  export GOCACHEPROG="cache gocacheprog"
+
+Outputs are also kept in a local directory, so they are only downloaded once per job.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			RunGoCacheProg(cmd, args)
+		},
+	}
+
+	cmd.Flags().String("dir", defaultGoCacheDir(), "Local directory to keep outputs in.")
+	cmd.Flags().Bool("read-only", false, "Only read from the cache, without uploading new outputs.")
+	cmd.Flags().Bool("local-only", false, "Only use the local directory, without using the cache backend.")
+	cmd.Flags().String("key-prefix", gocache.DefaultKeyPrefix, "Prefix for the keys used to store outputs.")
+	addScopeFlag(cmd, "Scope to keep outputs in: project, org, or the name of a custom scope shared by all projects.")
+	return cmd
+}
+
+func defaultGoCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "semaphore-gocacheprog")
+}
+
+func RunGoCacheProg(cmd *cobra.Command, args []string) {
+	// Stdout is used to talk to the go command, so nothing else can be written there.
+	log.SetOutput(os.Stderr)
+
+	dir, err := cmd.Flags().GetString("dir")
+	utils.Check(err)
+
+	readOnly, err := cmd.Flags().GetBool("read-only")
+	utils.Check(err)
+
+	localOnly, err := cmd.Flags().GetBool("local-only")
+	utils.Check(err)
+
+	keyPrefix, err := cmd.Flags().GetString("key-prefix")
+	utils.Check(err)
+
+	scope, err := cmd.Flags().GetString("scope")
+	utils.Check(err)
+
+	if storage.IsReadOnlyScope(scope) {
+		readOnly = true
+	}
+
+	// A build should not fail because the cache is not reachable.
+	var backend storage.Storage
+	if !localOnly {
+		backend, err = storage.InitStorageWithConfig(storage.StorageConfig{SortKeysBy: storage.SortByStoreTime, Scope: scope})
+		if err != nil {
+			log.Errorf("Error initializing cache storage: %v - using only '%s'.", err, dir)
+			backend = nil
+		}
+	}
+
+	program := gocache.NewProgram(dir, backend, keyPrefix, readOnly)
+	err = program.Run(os.Stdin, os.Stdout)
+	utils.Check(err)
+}
+
+func init() {
+	RootCmd.AddCommand(NewGoCacheProgCommand())
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"os"
+	"strconv"
 
 	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
 	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
@@ -28,10 +29,22 @@ func RunHasKey(cmd *cobra.Command, args []string) bool {
 		return true
 	}
 
+	output := findOutputFormat(cmd)
+
 	storage, err := storage.InitStorage()
 	utils.Check(err)
 
 	rawKey := args[0]
+	if output != OutputText {
+		key := normalizeKey(quietLogger(), rawKey)
+		exists, err := storage.HasKey(key)
+		utils.Check(err)
+
+		result := hasKeyResult{Key: key, Exists: exists}
+		writeOutput(cmd, output, result, []string{"key", "exists"}, [][]string{{key, strconv.FormatBool(exists)}})
+		return exists
+	}
+
 	key := NormalizeKey(rawKey)
 	exists, err := storage.HasKey(key)
 	utils.Check(err)
@@ -45,6 +58,12 @@ func RunHasKey(cmd *cobra.Command, args []string) bool {
 	return false
 }
 
+type hasKeyResult struct {
+	Key    string `json:"key"`
+	Exists bool   `json:"exists"`
+}
+
 func init() {
+	addOutputFlag(hasKeyCmd)
 	RootCmd.AddCommand(hasKeyCmd)
 }
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -47,5 +48,23 @@ func Test__HasKey(t *testing.T) {
 			assert.Contains(t, output, "Key 'abc/00/33' is normalized to 'abc-00-33'")
 			assert.Contains(t, output, "Key 'abc-00-33' exists in the cache store.")
 		})
+
+		t.Run(fmt.Sprintf("%s key is present as json", backend), func(*testing.T) {
+			storage.Clear()
+			tempFile, _ := ioutil.TempFile(os.TempDir(), "*")
+			storage.Store("abc001", tempFile.Name())
+
+			buffer := bytes.NewBufferString("")
+			hasKeyCmd.SetOut(buffer)
+			hasKeyCmd.Flags().Set("output", "json")
+			defer hasKeyCmd.Flags().Set("output", "text")
+
+			assert.True(t, RunHasKey(hasKeyCmd, []string{"abc001"}))
+			assert.JSONEq(t, `{"key": "abc001", "exists": true}`, buffer.String())
+
+			buffer.Reset()
+			assert.False(t, RunHasKey(hasKeyCmd, []string{"abc/00/99"}))
+			assert.JSONEq(t, `{"key": "abc-00-99", "exists": false}`, buffer.String())
+		})
 	})
 }
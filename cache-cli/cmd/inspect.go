@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/archive"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/metrics"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func NewInspectCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect [key]",
+		Short: "Show information about a key and the contents of its archive.",
+		Long:  ``,
+		Args:  cobra.ArbitraryArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			RunInspect(cmd, args)
+		},
+	}
+
+	cmd.Flags().String("diff", "", "Compare the contents of the archive with this local directory.")
+	return cmd
+}
+
+func RunInspect(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		log.Error("Incorrect number of arguments!")
+		_ = cmd.Help()
+		return
+	}
+
+	diffDirectory, err := cmd.Flags().GetString("diff")
+	utils.Check(err)
+
+	storage, err := storage.InitStorage()
+	utils.Check(err)
+
+	key := NormalizeKey(args[0])
+	cacheKey := findCacheKey(storage, key)
+	if cacheKey == nil {
+		log.Infof("Key '%s' doesn't exist in the cache store.", key)
+		return
+	}
+
+	log.Infof("KEY:         %s", cacheKey.Name)
+	log.Infof("SIZE:        %s", files.HumanReadableSize(cacheKey.Size))
+	log.Infof("STORED AT:   %s", formatInspectTime(cacheKey.StoredAt))
+	log.Infof("ACCESSED AT: %s", formatInspectTime(cacheKey.LastAccessedAt))
+
+	compressed, err := storage.Restore(key)
+	utils.Check(err)
+
+	defer os.Remove(compressed.Name())
+
+	checksum, err := files.GenerateChecksum(compressed.Name())
+	utils.Check(err)
+	log.Infof("CHECKSUM:    %s (md5)", checksum)
+
+	format, err := archive.DetectFormat(compressed.Name())
+	utils.Check(err)
+	log.Infof("FORMAT:      %s", format.Archive)
+	log.Infof("COMPRESSION: %s", format.Compression)
+
+	if format.Archive != "tar" || format.Compression != "gzip" {
+		log.Errorf("Archive entries can only be listed for gzipped tar archives.")
+		return
+	}
+
+	archiver := archive.NewNativeArchiver(metrics.NewNoOpMetricsManager(), false)
+	entries, err := archiver.Entries(compressed.Name())
+	utils.Check(err)
+
+	log.Info(formatEntries(entries))
+
+	if diffDirectory != "" {
+		if _, err := os.Stat(diffDirectory); err != nil {
+			log.Errorf("'%s' doesn't exist locally.", diffDirectory)
+			return
+		}
+
+		differences, err := archive.Diff(entries, diffDirectory)
+		utils.Check(err)
+		log.Info(formatDifferences(differences, diffDirectory))
+	}
+}
+
+func findCacheKey(storage storage.Storage, key string) *storage.CacheKey {
+	keys, err := storage.List()
+	utils.Check(err)
+
+	for i := range keys {
+		if keys[i].Name == key {
+			return &keys[i]
+		}
+	}
+
+	return nil
+}
+
+func formatInspectTime(t *time.Time) string {
+	if t == nil {
+		return "(unknown)"
+	}
+
+	return t.Format(time.RFC822)
+}
+
+func formatEntries(entries []archive.Entry) string {
+	var totalSize int64
+	formatted := fmt.Sprintf("%-8s %-12s %-12s %s\n", "TYPE", "MODE", "SIZE", "NAME")
+	for _, entry := range entries {
+		name := entry.Name
+		if entry.Type == archive.EntryTypeSymlink {
+			name = fmt.Sprintf("%s -> %s", entry.Name, entry.Linkname)
+		}
+
+		totalSize += entry.Size
+		formatted += fmt.Sprintf("%-8s %-12s %-12s %s\n", entry.Type, entry.Mode.String(), files.HumanReadableSize(entry.Size), name)
+	}
+
+	formatted += fmt.Sprintf("%d entries, %s uncompressed.", len(entries), files.HumanReadableSize(totalSize))
+	return formatted
+}
+
+func formatDifferences(differences []archive.Difference, directory string) string {
+	if len(differences) == 0 {
+		return fmt.Sprintf("No differences found between archive and '%s'.", directory)
+	}
+
+	formatted := fmt.Sprintf("%d difference(s) found between archive and '%s':\n", len(differences), directory)
+	for _, difference := range differences {
+		if difference.Details == "" {
+			formatted += fmt.Sprintf("  %s: %s\n", difference.Kind, difference.Path)
+		} else {
+			formatted += fmt.Sprintf("  %s: %s (%s)\n", difference.Kind, difference.Path, difference.Details)
+		}
+	}
+
+	return formatted
+}
+
+func init() {
+	RootCmd.AddCommand(NewInspectCommand())
+}
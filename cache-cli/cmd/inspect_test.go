@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/archive"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/logging"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	log "github.com/sirupsen/logrus"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__Inspect(t *testing.T) {
+	inspectCmd := NewInspectCommand()
+	log.SetFormatter(new(logging.CustomFormatter))
+	log.SetLevel(log.InfoLevel)
+	log.SetOutput(openLogfileForTests(t))
+
+	runTestForAllBackends(t, func(backend string, storage storage.Storage) {
+		t.Run(fmt.Sprintf("%s wrong number of arguments", backend), func(t *testing.T) {
+			RunInspect(inspectCmd, []string{})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "Incorrect number of arguments!")
+		})
+
+		t.Run(fmt.Sprintf("%s key is missing", backend), func(t *testing.T) {
+			storage.Clear()
+
+			RunInspect(inspectCmd, []string{"this-key-does-not-exist"})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "Key 'this-key-does-not-exist' doesn't exist in the cache store.")
+		})
+
+		t.Run(fmt.Sprintf("%s shows metadata and entries", backend), func(t *testing.T) {
+			storage.Clear()
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			_ = ioutil.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("hello"), 0600)
+
+			RunStore(NewStoreCommand(), []string{"abc001", tempDir})
+			_ = readOutputFromFile(t)
+
+			diffInspectCmd := NewInspectCommand()
+			diffInspectCmd.Flags().Set("diff", tempDir)
+			RunInspect(diffInspectCmd, []string{"abc001"})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "KEY:         abc001")
+			assert.Contains(t, output, "CHECKSUM:")
+			assert.Contains(t, output, "FORMAT:      tar")
+			assert.Contains(t, output, "COMPRESSION: gzip")
+			assert.Contains(t, output, filepath.Join(tempDir, "a.txt"))
+			assert.Contains(t, output, "2 entries")
+			assert.Contains(t, output, fmt.Sprintf("No differences found between archive and '%s'.", tempDir))
+
+			os.RemoveAll(tempDir)
+		})
+	})
+}
+
+func Test__FormatDifferences(t *testing.T) {
+	differences := []archive.Difference{
+		{Path: "a.txt", Kind: archive.DiffSize, Details: "5 bytes in archive, 6 bytes locally"},
+		{Path: "c.txt", Kind: archive.DiffOnlyLocally},
+	}
+
+	assert.Equal(t, "2 difference(s) found between archive and 'vendor':\n"+
+		"  size differs: a.txt (5 bytes in archive, 6 bytes locally)\n"+
+		"  only locally: c.txt\n", formatDifferences(differences, "vendor"))
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"os"
+	"strconv"
 
 	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
 	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
@@ -23,15 +24,27 @@ var isNotEmptyCmd = &cobra.Command{
 }
 
 func RunIsNotEmpty(cmd *cobra.Command, args []string) bool {
+	output := findOutputFormat(cmd)
+
 	storage, err := storage.InitStorage()
 	utils.Check(err)
 
 	isNotEmpty, err := storage.IsNotEmpty()
 	utils.Check(err)
 
+	if output != OutputText {
+		result := isNotEmptyResult{NotEmpty: isNotEmpty}
+		writeOutput(cmd, output, result, []string{"not_empty"}, [][]string{{strconv.FormatBool(isNotEmpty)}})
+	}
+
 	return isNotEmpty
 }
 
+type isNotEmptyResult struct {
+	NotEmpty bool `json:"not_empty"`
+}
+
 func init() {
+	addOutputFlag(isNotEmptyCmd)
 	RootCmd.AddCommand(isNotEmptyCmd)
 }
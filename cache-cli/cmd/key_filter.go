@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// Flags used by commands operating on multiple keys at once, like delete and migrate.
+func addKeyFilterFlags(cmd *cobra.Command, action string) {
+	cmd.Flags().String("prefix", "", fmt.Sprintf("%s all keys starting with this prefix.", action))
+	cmd.Flags().String("regex", "", fmt.Sprintf("%s all keys matching this regular expression.", action))
+	cmd.Flags().String("older-than", "", fmt.Sprintf("%s all keys stored longer ago than this, e.g. 30d, 2w or 12h.", action))
+	cmd.Flags().String("larger-than", "", fmt.Sprintf("%s all keys larger than this, e.g. 500M or 1G.", action))
+	cmd.Flags().String("not-accessed-since", "", fmt.Sprintf("%s all keys not accessed since this date (e.g. 2022-03-01), or for this long (e.g. 7d).", action))
+}
+
+var keyFilterFlags = []string{"prefix", "regex", "older-than", "larger-than", "not-accessed-since"}
+
+// Filters are used if any of their flags is given, even with a zero value like --larger-than 0.
+// Empty values are rejected, since an unset variable, like --prefix "$PREFIX",
+// would otherwise select every key.
+func usesKeyFilter(cmd *cobra.Command) (bool, error) {
+	used := false
+	for _, name := range keyFilterFlags {
+		if !cmd.Flags().Changed(name) {
+			continue
+		}
+
+		value, err := cmd.Flags().GetString(name)
+		if err != nil {
+			return false, err
+		}
+
+		if value == "" {
+			return false, fmt.Errorf("--%s can't be empty", name)
+		}
+
+		used = true
+	}
+
+	return used, nil
+}
+
+func buildKeyFilter(cmd *cobra.Command, now time.Time) storage.KeyFilter {
+	prefix, err := cmd.Flags().GetString("prefix")
+	utils.Check(err)
+
+	expression, err := cmd.Flags().GetString("regex")
+	utils.Check(err)
+
+	olderThan, err := cmd.Flags().GetString("older-than")
+	utils.Check(err)
+
+	largerThan, err := cmd.Flags().GetString("larger-than")
+	utils.Check(err)
+
+	notAccessedSince, err := cmd.Flags().GetString("not-accessed-since")
+	utils.Check(err)
+
+	filter := storage.KeyFilter{Prefix: NormalizeKey(prefix)}
+	if expression != "" {
+		filter.Regex, err = regexp.Compile(expression)
+		utils.Check(err)
+	}
+
+	if olderThan != "" {
+		age, err := utils.ParseDuration(olderThan)
+		utils.Check(err)
+
+		storedBefore := now.Add(-age)
+		filter.StoredBefore = &storedBefore
+	}
+
+	if largerThan != "" {
+		size, err := files.ParseSize(largerThan)
+		utils.Check(err)
+
+		filter.LargerThan = &size
+	}
+
+	if notAccessedSince != "" {
+		since, err := utils.ParseTimeOrAge(notAccessedSince, now)
+		utils.Check(err)
+
+		filter.NotAccessedSince = &since
+	}
+
+	return filter
+}
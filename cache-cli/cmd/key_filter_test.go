@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__UsesKeyFilter(t *testing.T) {
+	t.Run("no filter flags", func(t *testing.T) {
+		cmd := NewDeleteCommand()
+		used, err := usesKeyFilter(cmd)
+		assert.Nil(t, err)
+		assert.False(t, used)
+	})
+
+	t.Run("zero-valued filter flags", func(t *testing.T) {
+		cmd := NewDeleteCommand()
+		assert.Nil(t, cmd.Flags().Set("larger-than", "0"))
+		used, err := usesKeyFilter(cmd)
+		assert.Nil(t, err)
+		assert.True(t, used)
+
+		filter := buildKeyFilter(cmd, time.Now())
+		if assert.NotNil(t, filter.LargerThan) {
+			assert.Equal(t, int64(0), *filter.LargerThan)
+		}
+	})
+
+	t.Run("other flags", func(t *testing.T) {
+		cmd := NewDeleteCommand()
+		assert.Nil(t, cmd.Flags().Set("dry-run", "true"))
+		used, err := usesKeyFilter(cmd)
+		assert.Nil(t, err)
+		assert.False(t, used)
+	})
+
+	t.Run("empty filter flags", func(t *testing.T) {
+		for _, name := range []string{"prefix", "regex", "larger-than"} {
+			cmd := NewDeleteCommand()
+			assert.Nil(t, cmd.Flags().Set(name, ""))
+			_, err := usesKeyFilter(cmd)
+			assert.EqualError(t, err, fmt.Sprintf("--%s can't be empty", name))
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	log "github.com/sirupsen/logrus"
+	assert "github.com/stretchr/testify/assert"
+)
+
+// Only implements locking, every other storage method panics.
+type lockingStorage struct {
+	storage.Storage
+	acquired   bool
+	refreshErr error
+	released   []string
+}
+
+func (s *lockingStorage) AcquireLock(key string) (bool, error) {
+	return s.acquired, nil
+}
+
+func (s *lockingStorage) RefreshLock(key string) error {
+	return s.refreshErr
+}
+
+func (s *lockingStorage) ReleaseLock(key string) error {
+	s.released = append(s.released, key)
+	return nil
+}
+
+func Test__KeyLock(t *testing.T) {
+	logger := log.NewEntry(log.StandardLogger())
+	defer func(interval time.Duration) { lockRefreshInterval = interval }(lockRefreshInterval)
+	lockRefreshInterval = 10 * time.Millisecond
+
+	t.Run("lock held by another job", func(t *testing.T) {
+		assert.Nil(t, acquireKeyLock(logger, &lockingStorage{acquired: false}, "abc001"))
+	})
+
+	t.Run("refreshed lock is kept", func(t *testing.T) {
+		s := &lockingStorage{acquired: true}
+		lock := acquireKeyLock(logger, s, "abc001")
+		time.Sleep(50 * time.Millisecond)
+		assert.False(t, lock.Lost())
+
+		lock.Release()
+		assert.Equal(t, []string{"abc001"}, s.released)
+	})
+
+	t.Run("lock is lost if it can't be refreshed", func(t *testing.T) {
+		s := &lockingStorage{acquired: true, refreshErr: fmt.Errorf("lock for key 'abc001' is no longer held by this job")}
+		lock := acquireKeyLock(logger, s, "abc001")
+		assert.Eventually(t, lock.Lost, time.Second, 10*time.Millisecond)
+		lock.Release()
+	})
+}
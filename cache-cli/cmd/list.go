@@ -29,6 +29,9 @@ func NewListCommand() *cobra.Command {
 	)
 
 	cmd.Flags().StringP("sort-by", "s", storage.SortByStoreTime, description)
+	cmd.Flags().Bool("all", false, "Also list the keys used by build tools through serve and gocacheprog.")
+	addScopeFlag(cmd, "Scope to list keys from: project, org, or the name of a custom scope shared by all projects.")
+	addOutputFlag(cmd)
 	return cmd
 }
 
@@ -36,17 +39,43 @@ func RunList(cmd *cobra.Command, args []string) {
 	sortBy, err := cmd.Flags().GetString("sort-by")
 	utils.Check(err)
 
-	storage, err := storage.InitStorageWithConfig(storage.StorageConfig{SortKeysBy: sortBy})
+	all, err := cmd.Flags().GetBool("all")
+	utils.Check(err)
+
+	output := findOutputFormat(cmd)
+	scope := findScope(cmd)
+
+	storage, err := storage.InitStorageWithConfig(storage.StorageConfig{SortKeysBy: sortBy, Scope: scope})
 	utils.Check(err)
 
 	keys, err := storage.List()
 	utils.Check(err)
 
-	if len(keys) == 0 {
+	keys, buildCacheKeys := listedKeys(keys, all)
+
+	if output != OutputText {
+		writeCacheKeys(cmd, output, keys)
+		return
+	}
+
+	if len(keys) == 0 && len(buildCacheKeys) == 0 {
 		log.Info("Cache is empty.")
 	} else {
 		log.Info(formatList(keys))
 	}
+
+	if len(buildCacheKeys) > 0 {
+		log.Infof("%d keys used by build tools are not shown, use --all to list them.", len(buildCacheKeys))
+	}
+}
+
+// Keys used by build tools are only listed if asked for, since there are usually thousands of them.
+func listedKeys(keys []storage.CacheKey, all bool) ([]storage.CacheKey, []storage.CacheKey) {
+	if all {
+		return keys, []storage.CacheKey{}
+	}
+
+	return storage.SplitBuildCacheKeys(keys)
 }
 
 func formatList(keys []storage.CacheKey) string {
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -42,5 +44,39 @@ func Test__List(t *testing.T) {
 			assert.Contains(t, output, "abc002")
 			assert.Contains(t, output, "abc003")
 		})
+
+		t.Run(fmt.Sprintf("%s with keys as json", backend), func(*testing.T) {
+			storage.Clear()
+			tempFile, _ := ioutil.TempFile(os.TempDir(), "*")
+			storage.Store("abc001", tempFile.Name())
+
+			jsonListCmd := NewListCommand()
+			jsonListCmd.Flags().Set("output", "json")
+			buffer := bytes.NewBufferString("")
+			jsonListCmd.SetOut(buffer)
+
+			RunList(jsonListCmd, []string{})
+
+			keys := []map[string]interface{}{}
+			assert.Nil(t, json.Unmarshal(buffer.Bytes(), &keys))
+			if assert.Len(t, keys, 1) {
+				assert.Equal(t, "abc001", keys[0]["name"])
+				assert.Contains(t, keys[0], "size")
+				assert.Contains(t, keys[0], "stored_at")
+				assert.Contains(t, keys[0], "last_accessed_at")
+			}
+		})
 	})
 }
+
+func Test__ListedKeys(t *testing.T) {
+	keys := []storage.CacheKey{{Name: "abc001"}, {Name: storage.BuildCacheKeyPrefix + "remote-cas-abc"}}
+
+	listed, hidden := listedKeys(keys, false)
+	assert.Equal(t, []storage.CacheKey{{Name: "abc001"}}, listed)
+	assert.Len(t, hidden, 1)
+
+	listed, hidden = listedKeys(keys, true)
+	assert.Equal(t, keys, listed)
+	assert.Empty(t, hidden)
+}
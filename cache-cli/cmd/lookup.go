@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+func addLookupFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("recursive", false, "Also look for lock files in subdirectories, using separate keys for each project.")
+	cmd.Flags().Int("max-depth", files.DefaultMaxDepth, "How many directory levels to descend into when using --recursive.")
+	cmd.Flags().StringSlice("ignore", files.DefaultIgnoredDirectories, "Directory name patterns to skip when using --recursive.")
+}
+
+func buildLookupOptions(cmd *cobra.Command, restore bool) files.LookupOptions {
+	recursive, err := cmd.Flags().GetBool("recursive")
+	utils.Check(err)
+
+	maxDepth, err := cmd.Flags().GetInt("max-depth")
+	utils.Check(err)
+
+	ignore, err := cmd.Flags().GetStringSlice("ignore")
+	utils.Check(err)
+
+	return files.LookupOptions{
+		GitBranch:         FindGitBranch(),
+		Restore:           restore,
+		Recursive:         recursive,
+		MaxDepth:          maxDepth,
+		IgnoreDirectories: ignore,
+	}
+}
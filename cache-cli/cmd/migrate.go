@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func NewMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Copy keys from one cache backend to another.",
+		Long: `Copy keys from one cache backend to another.
+Backends are described using URLs:
+  env                                           - the backend configured through SEMAPHORE_CACHE_* variables
+  s3://<bucket>/<project>?endpoint=<url>
+  gcs://<bucket>/<project>
+  sftp://<username>@<host>:<port>?private-key=<path>
+
+Keys already present in the destination are skipped,
+so an interrupted migration can be resumed by running the same command again.
+
+Each key is downloaded into the temporary directory before being uploaded,
+so it needs as much free space as the largest key copied. Set TMPDIR to use a different disk.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !RunMigrate(cmd, args) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().String("from", "env", "Backend to copy keys from.")
+	cmd.Flags().String("to", "", "Backend to copy keys to.")
+	cmd.Flags().Bool("dry-run", false, "Only show which keys would be copied, without copying anything.")
+	addKeyFilterFlags(cmd, "Copy")
+	return cmd
+}
+
+// RunMigrate returns false if any key could not be copied.
+func RunMigrate(cmd *cobra.Command, args []string) bool {
+	from, err := cmd.Flags().GetString("from")
+	utils.Check(err)
+
+	to, err := cmd.Flags().GetString("to")
+	utils.Check(err)
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	utils.Check(err)
+
+	if to == "" || from == to {
+		log.Error("A destination backend different from the source is required!")
+		_ = cmd.Help()
+		return true
+	}
+
+	if _, err := usesKeyFilter(cmd); err != nil {
+		log.Errorf("Invalid filter: %v", err)
+		return false
+	}
+
+	filter := buildKeyFilter(cmd, time.Now())
+
+	source, err := storage.InitStorageFromURL(from, storage.StorageConfig{SortKeysBy: storage.SortByStoreTime})
+	utils.Check(err)
+
+	destination, err := storage.InitStorageFromURL(to, storage.StorageConfig{SortKeysBy: storage.SortByStoreTime})
+	utils.Check(err)
+
+	return migrateKeys(source, destination, filter, dryRun)
+}
+
+// Keys are copied one at a time, most recently stored first,
+// so at most one key is on the local disk at any point,
+// and the most useful keys are available in the destination as soon as possible.
+// Keys go through the local disk because storage.Storage only stores local files:
+// the SFTP backend needs the size up front to make room for the key,
+// and the S3 uploader reads parts of the file concurrently.
+func migrateKeys(source, destination storage.Storage, filter storage.KeyFilter, dryRun bool) bool {
+	sourceKeys, err := source.List()
+	utils.Check(err)
+
+	destinationKeys, err := destination.List()
+	utils.Check(err)
+
+	existing := map[string]bool{}
+	for _, key := range destinationKeys {
+		existing[key.Name] = true
+	}
+
+	keys := filter.Filter(sourceKeys)
+	if len(keys) == 0 {
+		log.Info("No keys to migrate.")
+		return true
+	}
+
+	start := time.Now()
+	copied, skipped, failed := 0, 0, []string{}
+	var copiedSize int64
+
+	for i, key := range keys {
+		progress := fmt.Sprintf("[%d/%d]", i+1, len(keys))
+		if existing[key.Name] {
+			log.Infof("%s Key '%s' already exists in the destination, skipping.", progress, key.Name)
+			skipped++
+			continue
+		}
+
+		if dryRun {
+			log.Infof("[dry-run] %s Key '%s' (%s) would be copied.", progress, key.Name, files.HumanReadableSize(key.Size))
+			copied++
+			copiedSize += key.Size
+			continue
+		}
+
+		log.Infof("%s Copying key '%s' (%s)...", progress, key.Name, files.HumanReadableSize(key.Size))
+		err := migrateKey(source, destination, key)
+		if err != nil {
+			log.Errorf("%s Error copying key '%s': %v", progress, key.Name, err)
+			failed = append(failed, key.Name)
+			continue
+		}
+
+		copied++
+		copiedSize += key.Size
+	}
+
+	if dryRun {
+		log.Infof("[dry-run] %d key(s) would be copied (%s), %d already exist in the destination.", copied, files.HumanReadableSize(copiedSize), skipped)
+		return true
+	}
+
+	log.Infof("Copied %d key(s) (%s), skipped %d already in the destination. Duration: %v.", copied, files.HumanReadableSize(copiedSize), skipped, time.Since(start))
+	if len(failed) > 0 {
+		log.Errorf("Failed to copy %d key(s): %s. Run the same command again to retry them.", len(failed), strings.Join(failed, ", "))
+		return false
+	}
+
+	return true
+}
+
+func migrateKey(source, destination storage.Storage, key storage.CacheKey) error {
+	file, err := source.Restore(key.Name)
+	if err != nil {
+		return fmt.Errorf("error downloading: %v", err)
+	}
+
+	defer os.Remove(file.Name())
+	_ = file.Close()
+
+	err = destination.Store(key.Name, file.Name())
+	if err != nil {
+		return fmt.Errorf("error uploading: %v", err)
+	}
+
+	if setter, ok := destination.(storage.StoreTimeSetter); ok && key.StoredAt != nil {
+		err = setter.SetStoreTime(key.Name, *key.StoredAt)
+		if err != nil {
+			log.Errorf("Error preserving store time for key '%s': %v", key.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(NewMigrateCommand())
+}
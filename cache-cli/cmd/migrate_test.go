@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/logging"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	log "github.com/sirupsen/logrus"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__Migrate(t *testing.T) {
+	log.SetFormatter(new(logging.CustomFormatter))
+	log.SetLevel(log.InfoLevel)
+	log.SetOutput(openLogfileForTests(t))
+
+	destinationURL := fmt.Sprintf("s3://semaphore-cache/cache-cli-migrated?endpoint=%s", os.Getenv("SEMAPHORE_CACHE_S3_URL"))
+
+	runTestForAllBackends(t, func(backend string, source storage.Storage) {
+		destination, err := storage.InitStorageFromURL(destinationURL, storage.StorageConfig{SortKeysBy: storage.SortByStoreTime})
+		assert.Nil(t, err)
+
+		t.Run(fmt.Sprintf("%s no destination", backend), func(t *testing.T) {
+			RunMigrate(NewMigrateCommand(), []string{})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "A destination backend different from the source is required!")
+		})
+
+		t.Run(fmt.Sprintf("%s copies keys and skips existing ones", backend), func(t *testing.T) {
+			source.Clear()
+			destination.Clear()
+
+			tempFile, _ := ioutil.TempFile(os.TempDir(), "*")
+			source.Store("abc001", tempFile.Name())
+			source.Store("abc002", tempFile.Name())
+			destination.Store("abc002", tempFile.Name())
+
+			migrateCmd := NewMigrateCommand()
+			migrateCmd.Flags().Set("to", destinationURL)
+			assert.True(t, RunMigrate(migrateCmd, []string{}))
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "Copying key 'abc001'")
+			assert.Contains(t, output, "Key 'abc002' already exists in the destination, skipping.")
+			assert.Contains(t, output, "Copied 1 key(s)")
+
+			keys, err := destination.List()
+			assert.Nil(t, err)
+			assert.Len(t, keys, 2)
+		})
+
+		t.Run(fmt.Sprintf("%s copies only filtered keys", backend), func(t *testing.T) {
+			source.Clear()
+			destination.Clear()
+
+			tempFile, _ := ioutil.TempFile(os.TempDir(), "*")
+			source.Store("gems-001", tempFile.Name())
+			source.Store("node-001", tempFile.Name())
+
+			migrateCmd := NewMigrateCommand()
+			migrateCmd.Flags().Set("to", destinationURL)
+			migrateCmd.Flags().Set("prefix", "gems-")
+			assert.True(t, RunMigrate(migrateCmd, []string{}))
+
+			keys, err := destination.List()
+			assert.Nil(t, err)
+			if assert.Len(t, keys, 1) {
+				assert.Equal(t, "gems-001", keys[0].Name)
+			}
+		})
+
+		t.Run(fmt.Sprintf("%s dry run does not copy anything", backend), func(t *testing.T) {
+			source.Clear()
+			destination.Clear()
+
+			tempFile, _ := ioutil.TempFile(os.TempDir(), "*")
+			source.Store("abc001", tempFile.Name())
+
+			migrateCmd := NewMigrateCommand()
+			migrateCmd.Flags().Set("to", destinationURL)
+			migrateCmd.Flags().Set("dry-run", "true")
+			assert.True(t, RunMigrate(migrateCmd, []string{}))
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "[dry-run] [1/1] Key 'abc001' (0.0) would be copied.")
+
+			keys, err := destination.List()
+			assert.Nil(t, err)
+			assert.Len(t, keys, 0)
+		})
+	})
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+	OutputCSV  = "csv"
+)
+
+var ValidOutputFormats = []string{OutputText, OutputJSON, OutputCSV}
+
+func addOutputFlag(cmd *cobra.Command) {
+	description := fmt.Sprintf(
+		`Output format. Possible values are: %v.`,
+		strings.Join(ValidOutputFormats, ","),
+	)
+
+	cmd.Flags().StringP("output", "o", OutputText, description)
+}
+
+func findOutputFormat(cmd *cobra.Command) string {
+	output, err := cmd.Flags().GetString("output")
+	utils.Check(err)
+
+	for _, format := range ValidOutputFormats {
+		if output == format {
+			return output
+		}
+	}
+
+	utils.Check(fmt.Errorf("output format '%s' is not valid; possible values are: %s", output, strings.Join(ValidOutputFormats, ",")))
+	return OutputText
+}
+
+// Machine-readable output goes straight to stdout, and not through the logger,
+// so it is not mixed with anything else, and doesn't end up in the log file.
+func writeOutput(cmd *cobra.Command, format string, value interface{}, header []string, rows [][]string) {
+	var err error
+	switch format {
+	case OutputJSON:
+		err = writeJSON(cmd.OutOrStdout(), value)
+	case OutputCSV:
+		err = writeCSV(cmd.OutOrStdout(), header, rows)
+	}
+
+	if err != nil {
+		log.Errorf("Error writing %s output: %v", format, err)
+	}
+}
+
+func writeJSON(w io.Writer, value interface{}) error {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(content))
+	return err
+}
+
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(header)
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteAll(rows)
+	if err != nil {
+		return err
+	}
+
+	return writer.Error()
+}
+
+func writeCacheKeys(cmd *cobra.Command, format string, keys []storage.CacheKey) {
+	// An empty cache should still be a valid JSON array.
+	if keys == nil {
+		keys = []storage.CacheKey{}
+	}
+
+	writeOutput(cmd, format, keys, cacheKeyHeader, cacheKeyRows(keys))
+}
+
+var cacheKeyHeader = []string{"name", "size", "stored_at", "last_accessed_at"}
+
+func cacheKeyRows(keys []storage.CacheKey) [][]string {
+	rows := [][]string{}
+	for _, key := range keys {
+		rows = append(rows, []string{
+			key.Name,
+			strconv.FormatInt(key.Size, 10),
+			formatOptionalTime(key.StoredAt),
+			formatOptionalTime(key.LastAccessedAt),
+		})
+	}
+
+	return rows
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// Machine-readable output should not be interrupted by informational messages.
+func quietLogger() *log.Entry {
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	return log.NewEntry(logger)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__WriteOutput(t *testing.T) {
+	storedAt := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	accessedAt := time.Date(2022, 3, 2, 10, 0, 0, 0, time.UTC)
+	keys := []storage.CacheKey{
+		{Name: "abc001", Size: 1024, StoredAt: &storedAt, LastAccessedAt: &accessedAt},
+		{Name: "abc002", Size: 10},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		listCmd := NewListCommand()
+		buffer := bytes.NewBufferString("")
+		listCmd.SetOut(buffer)
+
+		writeOutput(listCmd, OutputJSON, keys, cacheKeyHeader, cacheKeyRows(keys))
+		assert.JSONEq(t, `[
+			{"name": "abc001", "size": 1024, "stored_at": "2022-03-01T10:00:00Z", "last_accessed_at": "2022-03-02T10:00:00Z"},
+			{"name": "abc002", "size": 10, "stored_at": null, "last_accessed_at": null}
+		]`, buffer.String())
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		listCmd := NewListCommand()
+		buffer := bytes.NewBufferString("")
+		listCmd.SetOut(buffer)
+
+		writeOutput(listCmd, OutputCSV, keys, cacheKeyHeader, cacheKeyRows(keys))
+		assert.Equal(t, "name,size,stored_at,last_accessed_at\n"+
+			"abc001,1024,2022-03-01T10:00:00Z,2022-03-02T10:00:00Z\n"+
+			"abc002,10,,\n", buffer.String())
+	})
+
+	t.Run("empty list is an empty json array", func(t *testing.T) {
+		listCmd := NewListCommand()
+		buffer := bytes.NewBufferString("")
+		listCmd.SetOut(buffer)
+
+		writeCacheKeys(listCmd, OutputJSON, nil)
+		assert.JSONEq(t, `[]`, buffer.String())
+	})
+
+	t.Run("usage summary", func(t *testing.T) {
+		listCmd := NewListCommand()
+		buffer := bytes.NewBufferString("")
+		listCmd.SetOut(buffer)
+
+		writeOutput(listCmd, OutputJSON, storage.UsageSummary{Free: -1, Used: 2048}, nil, nil)
+		assert.JSONEq(t, `{"free": -1, "used": 2048}`, buffer.String())
+	})
+}
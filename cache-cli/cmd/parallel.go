@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/logging"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const DefaultParallelism = 4
+
+type automaticEntry struct {
+	Index        int
+	DetectedFile string
+	files.LookupResultEntry
+}
+
+func addParallelismFlag(cmd *cobra.Command) {
+	cmd.Flags().Int("parallelism", DefaultParallelism, "How many automatically detected cache entries to process at the same time.")
+}
+
+func findParallelism(cmd *cobra.Command) int {
+	parallelism, err := cmd.Flags().GetInt("parallelism")
+	utils.Check(err)
+
+	if parallelism < 1 {
+		return 1
+	}
+
+	return parallelism
+}
+
+// Entries that use the same path (e.g. ~/go/pkg/mod for multiple projects)
+// are put in the same group, and processed one after the other,
+// since compressing and unpacking the same directory at the same time is not safe.
+func groupEntriesByPath(lookupResults []files.LookupResult) [][]automaticEntry {
+	groups := [][]automaticEntry{}
+	groupIndexes := map[string]int{}
+
+	index := 0
+	for _, lookupResult := range lookupResults {
+		for _, entry := range lookupResult.Entries {
+			automatic := automaticEntry{
+				Index:             index,
+				DetectedFile:      lookupResult.DetectedFile,
+				LookupResultEntry: entry,
+			}
+
+			index++
+			if i, ok := groupIndexes[entry.Path]; ok {
+				groups[i] = append(groups[i], automatic)
+				continue
+			}
+
+			groupIndexes[entry.Path] = len(groups)
+			groups = append(groups, []automaticEntry{automatic})
+		}
+	}
+
+	return groups
+}
+
+func countEntries(groups [][]automaticEntry) int {
+	count := 0
+	for _, group := range groups {
+		count += len(group)
+	}
+
+	return count
+}
+
+// Calls work for every index in [0, count), using at most parallelism goroutines.
+// Errors don't stop the other indexes from being processed: they are all returned together, at the end.
+func forEachInParallel(count, parallelism int, work func(i int) error) error {
+	indexes := make(chan int)
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+
+	for w := 0; w < parallelism && w < count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = work(i)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// When entries are processed in parallel, their output is interleaved,
+// so every line is prefixed with the path it belongs to.
+func entryLogger(path string, prefixed bool) *log.Entry {
+	if prefixed {
+		return log.WithField(logging.PrefixField, path)
+	}
+
+	return log.NewEntry(log.StandardLogger())
+}
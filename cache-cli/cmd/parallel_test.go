@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/logging"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__GroupEntriesByPath(t *testing.T) {
+	lookupResults := []files.LookupResult{
+		{
+			DetectedFile: "go.sum",
+			Entries:      []files.LookupResultEntry{{Path: "~/go/pkg/mod", Keys: []string{"go-a"}}},
+		},
+		{
+			DetectedFile: "package-lock.json",
+			Entries:      []files.LookupResultEntry{{Path: "node_modules", Keys: []string{"node-modules"}}},
+		},
+		{
+			DetectedFile: "services/worker/go.sum",
+			Entries:      []files.LookupResultEntry{{Path: "~/go/pkg/mod", Keys: []string{"go-b"}}},
+		},
+	}
+
+	groups := groupEntriesByPath(lookupResults)
+	if assert.Len(t, groups, 2) {
+		assert.Len(t, groups[0], 2)
+		assert.Equal(t, 0, groups[0][0].Index)
+		assert.Equal(t, "go.sum", groups[0][0].DetectedFile)
+		assert.Equal(t, 2, groups[0][1].Index)
+		assert.Equal(t, "services/worker/go.sum", groups[0][1].DetectedFile)
+
+		assert.Len(t, groups[1], 1)
+		assert.Equal(t, 1, groups[1][0].Index)
+		assert.Equal(t, "node_modules", groups[1][0].Path)
+	}
+
+	assert.Equal(t, 3, countEntries(groups))
+}
+
+func Test__ForEachInParallel(t *testing.T) {
+	t.Run("calls work for every index", func(t *testing.T) {
+		var mutex sync.Mutex
+		seen := map[int]bool{}
+		err := forEachInParallel(10, 3, func(i int) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			seen[i] = true
+			return nil
+		})
+
+		assert.Nil(t, err)
+		assert.Len(t, seen, 10)
+	})
+
+	t.Run("does not exceed parallelism", func(t *testing.T) {
+		var running, maxRunning int32
+		_ = forEachInParallel(10, 3, func(i int) error {
+			current := atomic.AddInt32(&running, 1)
+			for {
+				observed := atomic.LoadInt32(&maxRunning)
+				if current <= observed || atomic.CompareAndSwapInt32(&maxRunning, observed, current) {
+					break
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+
+		assert.LessOrEqual(t, maxRunning, int32(3))
+	})
+
+	t.Run("nothing to do", func(t *testing.T) {
+		called := false
+		err := forEachInParallel(0, 3, func(i int) error {
+			called = true
+			return nil
+		})
+
+		assert.Nil(t, err)
+		assert.False(t, called)
+	})
+
+	t.Run("errors do not stop other indexes", func(t *testing.T) {
+		var processed int32
+		err := forEachInParallel(10, 3, func(i int) error {
+			atomic.AddInt32(&processed, 1)
+			if i%4 == 0 {
+				return fmt.Errorf("error processing %d", i)
+			}
+
+			return nil
+		})
+
+		assert.Equal(t, int32(10), processed)
+		if assert.NotNil(t, err) {
+			assert.Equal(t, "error processing 0\nerror processing 4\nerror processing 8", err.Error())
+		}
+	})
+}
+
+func Test__EntryLogger(t *testing.T) {
+	formatter := new(logging.CustomFormatter)
+
+	prefixed := entryLogger("node_modules", true)
+	prefixed.Message = "Restored: node_modules."
+	line, err := formatter.Format(prefixed)
+	assert.Nil(t, err)
+	assert.Equal(t, "[node_modules] Restored: node_modules.\n", string(line))
+
+	unprefixed := entryLogger("node_modules", false)
+	unprefixed.Message = "Restored: node_modules."
+	line, err = formatter.Format(unprefixed)
+	assert.Nil(t, err)
+	assert.Equal(t, "Restored: node_modules.\n", string(line))
+}
@@ -1,7 +1,8 @@
 package cmd
 
 import (
-	"io/fs"
+	"errors"
+	"fmt"
 	"os"
 	"regexp"
 	"strings"
@@ -16,123 +17,345 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var restoreCmd = &cobra.Command{
-	Use:   "restore [keys]",
-	Short: "Restore keys from the cache.",
-	Long:  ``,
-	Args:  cobra.ArbitraryArgs,
-	Run: func(cmd *cobra.Command, args []string) {
-		RunRestore(cmd, args)
-	},
+func NewRestoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore [keys]",
+		Short: "Restore keys from the cache.",
+		Long:  ``,
+		Args:  cobra.ArbitraryArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !RunRestore(cmd, args) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().Bool("regex", false, "Treat keys as regular expressions, instead of prefixes, when no exact match is found.")
+	cmd.Flags().Bool("exact", false, "Only restore keys that match exactly, without using prefix or regex matching.")
+	cmd.Flags().Bool("fail-on-miss", false, "Exit with a non-zero status if no key could be restored.")
+	cmd.Flags().Bool("dry-run", false, "Only show which keys would be restored, without downloading anything.")
+	cmd.Flags().String("outcome-file", "", "Write the restore outcome as JSON to this file. Use '-' to write it to stdout.")
+	cmd.Flags().String("to", "", "Restore all files under this directory, instead of where they were when the key was stored.")
+	cmd.Flags().Bool("record-manifest", false, "Record what restored paths look like, so 'cache store --skip-unchanged' can skip them if nothing changed.")
+	addScopeFlag(cmd, "Comma-separated list of scopes to look for keys in, in order, e.g. project,org.")
+	addLookupFlags(cmd)
+	addParallelismFlag(cmd)
+	return cmd
 }
 
-func RunRestore(cmd *cobra.Command, args []string) {
+type restoreOptions struct {
+	UseRegex       bool
+	Exact          bool
+	To             string
+	RecordManifest bool
+}
+
+// RunRestore returns false only if --fail-on-miss is used and nothing was restored.
+func RunRestore(cmd *cobra.Command, args []string) bool {
 	if len(args) > 1 {
 		log.Error("Incorrect number of arguments!")
 		_ = cmd.Help()
-		return
+		return true
 	}
 
-	storage, err := storage.InitStorage()
+	useRegex, err := cmd.Flags().GetBool("regex")
+	utils.Check(err)
+
+	exact, err := cmd.Flags().GetBool("exact")
+	utils.Check(err)
+
+	failOnMiss, err := cmd.Flags().GetBool("fail-on-miss")
 	utils.Check(err)
 
-	metricsManager, err := metrics.InitMetricsManager(metrics.LocalBackend)
+	outcomeFile, err := cmd.Flags().GetString("outcome-file")
 	utils.Check(err)
 
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	utils.Check(err)
+
+	to, err := cmd.Flags().GetString("to")
+	utils.Check(err)
+
+	recordManifest, err := cmd.Flags().GetBool("record-manifest")
+	utils.Check(err)
+
+	// Stdout is reserved for the outcomes, so they can be piped into something else.
+	if outcomeFile == "-" {
+		log.SetOutput(cmd.ErrOrStderr())
+	}
+
+	options := restoreOptions{UseRegex: useRegex, Exact: exact, To: to, RecordManifest: recordManifest}
+	parallelism := findParallelism(cmd)
+
+	storages := initScopedStorages(cmd)
+
+	metricsManager := metrics.InitMetricsManagerFromEnv()
+
 	archiver := archive.NewArchiver(metricsManager)
 
+	outcomes := []restoreOutcome{}
 	if len(args) == 0 {
-		lookupResults := files.Lookup(files.LookupOptions{
-			GitBranch: FindGitBranch(),
-			Restore:   true,
-		})
+		lookupResults := files.Lookup(buildLookupOptions(cmd, true))
 
 		if len(lookupResults) == 0 {
 			log.Info("Nothing to restore from cache.")
-			return
+			writeRestoreOutcomes(cmd.OutOrStdout(), outcomeFile, outcomes)
+			return !failOnMiss
 		}
 
-		for _, lookupResult := range lookupResults {
-			log.Infof("Detected %s.", lookupResult.DetectedFile)
-			for _, entry := range lookupResult.Entries {
-				log.Infof("Fetching '%s' directory with cache keys '%s'...", entry.Path, strings.Join(entry.Keys, ","))
-				downloadAndUnpack(storage, archiver, metricsManager, entry.Keys)
+		start := time.Now()
+		groups := groupEntriesByPath(lookupResults)
+		prefixed := parallelism > 1 && len(groups) > 1
+
+		// Outcomes are reported in the same order the entries were detected.
+		outcomes = make([]restoreOutcome, countEntries(groups))
+		err = forEachInParallel(len(groups), parallelism, func(i int) error {
+			errs := []error{}
+			for _, entry := range groups[i] {
+				logger := entryLogger(entry.Path, prefixed)
+				logger.Infof("Detected %s.", entry.DetectedFile)
+				logger.Infof("Fetching '%s' directory with cache keys '%s'...", entry.Path, strings.Join(entry.Keys, ","))
+
+				var err error
+				if dryRun {
+					outcomes[entry.Index], err = describeRestore(logger, storages, entry.Keys, entry.Path, options)
+				} else {
+					outcomes[entry.Index], err = downloadAndUnpack(logger, storages, archiver, metricsManager, entry.Keys, options)
+				}
+
+				if err != nil {
+					logger.Errorf("Error restoring '%s': %v", entry.Path, err)
+					errs = append(errs, err)
+				}
 			}
-		}
+
+			return errors.Join(errs...)
+		})
+
+		log.Infof("Processed %d cache entries. Total duration: %v.", len(outcomes), time.Since(start))
 	} else {
+		logger := log.NewEntry(log.StandardLogger())
 		keys := strings.Split(args[0], ",")
-		downloadAndUnpack(storage, archiver, metricsManager, keys)
+
+		var outcome restoreOutcome
+		if dryRun {
+			outcome, err = describeRestore(logger, storages, keys, "", options)
+		} else {
+			outcome, err = downloadAndUnpack(logger, storages, archiver, metricsManager, keys, options)
+		}
+
+		outcomes = append(outcomes, outcome)
+	}
+
+	writeRestoreOutcomes(cmd.OutOrStdout(), outcomeFile, outcomes)
+
+	if failOnMiss && hasMiss(outcomes) {
+		log.Error("Cache restore failed: no matching keys were found, or they could not be restored.")
+		return false
 	}
+
+	// Exiting only after every entry was processed, so no unpack is interrupted halfway.
+	utils.Check(err)
+	return true
 }
 
-func downloadAndUnpack(storage storage.Storage, archiver archive.Archiver, metricsManager metrics.MetricsManager, keys []string) {
-	for _, rawKey := range keys {
-		key := NormalizeKey(rawKey)
+// Errors are returned instead of exiting, since other keys might be restored at the same time.
+func downloadAndUnpack(logger *log.Entry, storages []scopedStorage, archiver archive.Archiver, metricsManager metrics.MetricsManager, keys []string, options restoreOptions) (restoreOutcome, error) {
+	start := time.Now()
+	outcome := restoreOutcome{Status: RestoreMiss, Keys: keys}
+
+	match, storage, err := resolveRestoreKeyInScopes(logger, storages, keys, options)
+	if err == nil && match != nil {
+		outcome.MatchedKey = match.Key
+		outcome.Scope = match.Scope
+		outcome.Status = hitStatus(match.ScopeIndex == 0 && match.Index == 0 && match.Exact)
+		outcome.Path, outcome.SizeBytes, err = downloadAndUnpackKey(logger, storage, archiver, metricsManager, match, outcome.Status, options)
+	} else if err == nil {
+		publishMetrics(logger, metricsManager, metrics.CacheEvent{Result: metrics.ResultMiss})
+	}
+
+	if err != nil {
+		outcome.fail(err)
+	}
+
+	outcome.DurationMs = time.Since(start).Milliseconds()
+	return outcome, err
+}
+
+// Goes through the keys in order, and returns the first one available in the cache.
+func resolveRestoreKey(logger *log.Entry, storage storage.Storage, keys []string, options restoreOptions) (*keyMatch, error) {
+	for i, rawKey := range keys {
+		key := normalizeKey(logger, rawKey)
 		if ok, _ := storage.HasKey(key); ok {
-			log.Infof("HIT: '%s', using key '%s'.", key, key)
-			downloadAndUnpackKey(storage, archiver, metricsManager, key)
-			break
+			logger.Infof("HIT: '%s', using key '%s'.", key, key)
+			logger.Infof("Key '%s' was chosen because it is an exact match.", key)
+			return &keyMatch{Key: key, Index: i, Exact: true}, nil
+		}
+
+		if options.Exact {
+			logger.Infof("MISS: '%s'.", key)
+			continue
 		}
 
 		availableKeys, err := storage.List()
-		utils.Check(err)
+		if err != nil {
+			return nil, err
+		}
 
-		matchingKey := findMatchingKey(availableKeys, key)
-		if matchingKey != "" {
-			log.Infof("HIT: '%s', using key '%s'.", key, matchingKey)
-			downloadAndUnpackKey(storage, archiver, metricsManager, matchingKey)
-			break
-		} else {
-			log.Infof("MISS: '%s'.", key)
+		match := findMatchingKey(availableKeys, key, options.UseRegex)
+		if match != nil {
+			logger.Infof("HIT: '%s', using key '%s'.", key, match.Key)
+			logger.Infof("Key '%s' was chosen because it is the %s.", match.Key, match.Reason)
+			match.Index = i
+			return match, nil
 		}
+
+		logger.Infof("MISS: '%s'.", key)
+	}
+
+	return nil, nil
+}
+
+// Only an exact match on the first key, in the first scope, is a full hit.
+// Using any fallback key or scope means the restored cache might be outdated.
+func hitStatus(firstKey bool) string {
+	if firstKey {
+		return RestoreHit
 	}
+
+	return RestorePartialHit
 }
 
-func findMatchingKey(availableKeys []storage.CacheKey, match string) string {
-	for _, availableKey := range availableKeys {
-		isMatch, _ := regexp.MatchString(match, availableKey.Name)
-		if isMatch {
-			return availableKey.Name
+type keyMatch struct {
+	Key        string
+	Reason     string
+	Index      int
+	Exact      bool
+	Scope      string
+	ScopeIndex int
+}
+
+// When no exact match for a key exists, we use the most recently stored key that starts with it.
+// If useRegex is set, the key is used as a regular expression instead of a prefix.
+func findMatchingKey(availableKeys []storage.CacheKey, match string, useRegex bool) *keyMatch {
+	matches := func(name string) bool {
+		return strings.HasPrefix(name, match)
+	}
+
+	description := fmt.Sprintf("starting with '%s'", match)
+	if useRegex {
+		expression, err := regexp.Compile(match)
+		if err != nil {
+			log.Errorf("Invalid regular expression '%s': %v", match, err)
+			return nil
 		}
+
+		matches = expression.MatchString
+		description = fmt.Sprintf("matching regular expression '%s'", match)
 	}
 
-	return ""
+	var newest *storage.CacheKey
+	count := 0
+	for i, availableKey := range availableKeys {
+		if !matches(availableKey.Name) {
+			continue
+		}
+
+		count++
+		if newest == nil || isStoredAfter(availableKey, *newest) {
+			newest = &availableKeys[i]
+		}
+	}
+
+	if newest == nil {
+		return nil
+	}
+
+	return &keyMatch{
+		Key:    newest.Name,
+		Reason: fmt.Sprintf("most recently stored of %d key(s) %s", count, description),
+	}
 }
 
-func downloadAndUnpackKey(storage storage.Storage, archiver archive.Archiver, metricsManager metrics.MetricsManager, key string) {
+func isStoredAfter(key, other storage.CacheKey) bool {
+	if key.StoredAt == nil {
+		return false
+	}
+
+	if other.StoredAt == nil {
+		return true
+	}
+
+	return key.StoredAt.After(*other.StoredAt)
+}
+
+// If options.To is not empty, the key is restored under that directory.
+func downloadAndUnpackKey(logger *log.Entry, storage storage.Storage, archiver archive.Archiver, metricsManager metrics.MetricsManager, match *keyMatch, status string, options restoreOptions) (string, int64, error) {
+	key := match.Key
 	downloadStart := time.Now()
-	log.Infof("Downloading key '%s'...", key)
-	compressed, err := downloadKey(storage, key)
-	utils.Check(err)
+	logger.Infof("Downloading key '%s'...", key)
+	compressed, source, err := downloadKey(logger, storage, key)
+	if err != nil {
+		return "", 0, err
+	}
 
 	downloadDuration := time.Since(downloadStart)
 	info, _ := os.Stat(compressed.Name())
 
-	log.Infof("Download complete. Duration: %v. Size: %v bytes.", downloadDuration.String(), files.HumanReadableSize(info.Size()))
-	publishMetrics(metricsManager, info, downloadDuration)
+	logger.Infof("Download complete. Duration: %v. Size: %v bytes.", downloadDuration.String(), files.HumanReadableSize(info.Size()))
+	publishMetrics(logger, metricsManager, metrics.CacheEvent{
+		Result:        status,
+		KeyIndex:      match.Index,
+		ArchiveMethod: archiver.Method(),
+		SizeBytes:     info.Size(),
+		Duration:      downloadDuration,
+		Source:        source,
+	})
 
 	unpackStart := time.Now()
-	log.Infof("Unpacking '%s'...", compressed.Name())
-	restorationPath, err := archiver.Decompress(compressed.Name())
-	utils.Check(err)
+	if options.To != "" {
+		logger.Infof("Unpacking '%s' into '%s'...", compressed.Name(), options.To)
+	} else {
+		logger.Infof("Unpacking '%s'...", compressed.Name())
+	}
+
+	restorationPath, err := archiver.DecompressTo(compressed.Name(), options.To)
+	if err != nil {
+		_ = os.Remove(compressed.Name())
+		return "", info.Size(), err
+	}
 
 	unpackDuration := time.Since(unpackStart)
-	log.Infof("Unpack complete. Duration: %v.", unpackDuration)
-	log.Infof("Restored: %s.", restorationPath)
+	logger.Infof("Unpack complete. Duration: %v.", unpackDuration)
+	logger.Infof("Restored: %s.", restorationPath)
+
+	publishMetrics(logger, metricsManager, metrics.CacheEvent{Result: metrics.ResultUnpacked, UnpackDuration: unpackDuration})
+
+	// Fingerprinting walks the whole restored path, so it is only done when asked for.
+	if options.RecordManifest && restorationPath != "" {
+		err = files.SaveRestoreManifest(files.DefaultManifestDirectory(), key, restorationPath)
+		if err != nil {
+			logger.Errorf("Error recording manifest for '%s': %v", restorationPath, err)
+		}
+	}
 
 	err = os.Remove(compressed.Name())
 	if err != nil {
-		log.Errorf("Error removing %s: %v", compressed.Name(), err)
+		logger.Errorf("Error removing %s: %v", compressed.Name(), err)
 	}
+
+	return restorationPath, info.Size(), nil
 }
 
-func downloadKey(storage storage.Storage, key string) (*os.File, error) {
+// Also returns where the key was downloaded from, one of the metrics.Source* constants.
+func downloadKey(logger *log.Entry, storage storage.Storage, key string) (*os.File, string, error) {
 	backend := os.Getenv("SEMAPHORE_CACHE_BACKEND")
 
 	// If this is not an sftp backend, then we are not in a cloud environment,
 	// and in there, there's no CDN variation, so just use the storage.
 	if backend != "sftp" {
-		return storage.Restore(key)
+		file, err := storage.Restore(key)
+		return file, metrics.SourceStorage, err
 	}
 
 	// Here, we are using sftp, so we know we are in a cloud job.
@@ -142,28 +365,33 @@ func downloadKey(storage storage.Storage, key string) (*os.File, error) {
 	cdnKey := os.Getenv("SEMAPHORE_CACHE_CDN_KEY")
 	cdnSecret := os.Getenv("SEMAPHORE_CACHE_CDN_SECRET")
 	if cdnURL == "" || cdnKey == "" || cdnSecret == "" {
-		return storage.Restore(key)
+		file, err := storage.Restore(key)
+		return file, metrics.SourceStorage, err
 	}
 
-	log.Infof("Restoring using HTTP URL %s...", cdnURL)
-	return files.DownloadFromHTTP(cdnURL, cdnKey, cdnSecret, key)
+	logger.Infof("Restoring using HTTP URL %s...", cdnURL)
+	file, err := files.DownloadFromHTTP(cdnURL, cdnKey, cdnSecret, key)
+	if err == nil {
+		return file, metrics.SourceCDN, nil
+	}
+
+	// The key exists in the storage, so even if the CDN is not working, we can still get it from there.
+	logger.Errorf("Error downloading '%s' using HTTP URL: %v - falling back to the storage.", key, err)
+	file, err = storage.Restore(key)
+	return file, metrics.SourceStorageFallback, err
 }
 
-func publishMetrics(metricsManager metrics.MetricsManager, fileInfo fs.FileInfo, downloadDuration time.Duration) {
-	event := metrics.CacheEvent{
-		Command:   metrics.CommandRestore,
-		Server:    metrics.CacheServerIP(),
-		User:      metrics.CacheUsername(),
-		SizeBytes: fileInfo.Size(),
-		Duration:  downloadDuration,
-	}
+func publishMetrics(logger *log.Entry, metricsManager metrics.MetricsManager, event metrics.CacheEvent) {
+	event.Command = metrics.CommandRestore
+	event.Server = metrics.CacheServerIP()
+	event.User = metrics.CacheUsername()
 
 	err := metricsManager.LogEvent(event)
 	if err != nil {
-		log.Errorf("Error publishing metrics: %v", err)
+		logger.Errorf("Error publishing metrics: %v", err)
 	}
 }
 
 func init() {
-	RootCmd.AddCommand(restoreCmd)
+	RootCmd.AddCommand(NewRestoreCommand())
 }
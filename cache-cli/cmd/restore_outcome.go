@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	RestoreHit        = "hit"
+	RestorePartialHit = "partial-hit"
+	RestoreMiss       = "miss"
+	RestoreFailed     = "failed"
+)
+
+type restoreOutcome struct {
+	Status     string   `json:"status"`
+	Keys       []string `json:"keys"`
+	MatchedKey string   `json:"matched_key,omitempty"`
+	Scope      string   `json:"scope,omitempty"`
+	Path       string   `json:"path,omitempty"`
+	SizeBytes  int64    `json:"size_bytes"`
+	DurationMs int64    `json:"duration_ms"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// A key that was found, but could not be downloaded or unpacked, is reported as failed.
+func (o *restoreOutcome) fail(err error) {
+	o.Status = RestoreFailed
+	o.Error = err.Error()
+}
+
+func hasMiss(outcomes []restoreOutcome) bool {
+	if len(outcomes) == 0 {
+		return true
+	}
+
+	for _, outcome := range outcomes {
+		if outcome.Status == RestoreMiss || outcome.Status == RestoreFailed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Writes the outcomes as JSON into the file specified.
+// If '-' is used, the outcomes are written to stdout, after everything else.
+// In that case, logs are sent to stderr, so stdout only has the outcomes in it.
+func writeRestoreOutcomes(stdout io.Writer, path string, outcomes []restoreOutcome) {
+	if path == "" {
+		return
+	}
+
+	if path == "-" {
+		err := writeJSON(stdout, outcomes)
+		if err != nil {
+			log.Errorf("Error writing restore outcome: %v", err)
+		}
+
+		return
+	}
+
+	content, err := json.MarshalIndent(outcomes, "", "  ")
+	if err != nil {
+		log.Errorf("Error serializing restore outcome: %v", err)
+		return
+	}
+
+	// #nosec
+	err = os.WriteFile(path, append(content, '\n'), 0644)
+	if err != nil {
+		log.Errorf("Error writing restore outcome to '%s': %v", path, err)
+	}
+}
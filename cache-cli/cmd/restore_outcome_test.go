@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__RestoreOutcome(t *testing.T) {
+	t.Run("no outcomes is a miss", func(t *testing.T) {
+		assert.True(t, hasMiss([]restoreOutcome{}))
+	})
+
+	t.Run("any miss is a miss", func(t *testing.T) {
+		assert.True(t, hasMiss([]restoreOutcome{{Status: RestoreHit}, {Status: RestoreMiss}}))
+	})
+
+	t.Run("hits and partial hits are not misses", func(t *testing.T) {
+		assert.False(t, hasMiss([]restoreOutcome{{Status: RestoreHit}, {Status: RestorePartialHit}}))
+	})
+
+	t.Run("failures are misses", func(t *testing.T) {
+		outcome := restoreOutcome{Status: RestoreHit, MatchedKey: "gems-master"}
+		outcome.fail(fmt.Errorf("unexpected EOF"))
+
+		assert.Equal(t, RestoreFailed, outcome.Status)
+		assert.Equal(t, "unexpected EOF", outcome.Error)
+		assert.True(t, hasMiss([]restoreOutcome{{Status: RestoreHit}, outcome}))
+	})
+
+	t.Run("writes outcomes to file", func(t *testing.T) {
+		file, _ := ioutil.TempFile(os.TempDir(), "*.json")
+		_ = file.Close()
+		defer os.Remove(file.Name())
+
+		writeRestoreOutcomes(ioutil.Discard, file.Name(), []restoreOutcome{
+			{
+				Status:     RestorePartialHit,
+				Keys:       []string{"gems-branch-abc", "gems-master"},
+				MatchedKey: "gems-master-def",
+				Path:       "vendor/bundle",
+				SizeBytes:  1024,
+				DurationMs: 10,
+			},
+		})
+
+		content, err := ioutil.ReadFile(file.Name())
+		assert.Nil(t, err)
+
+		outcomes := []map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal(content, &outcomes))
+		if assert.Len(t, outcomes, 1) {
+			assert.Equal(t, "partial-hit", outcomes[0]["status"])
+			assert.Equal(t, "gems-master-def", outcomes[0]["matched_key"])
+			assert.Equal(t, "vendor/bundle", outcomes[0]["path"])
+			assert.Equal(t, float64(1024), outcomes[0]["size_bytes"])
+			assert.Equal(t, float64(10), outcomes[0]["duration_ms"])
+		}
+	})
+	t.Run("writes outcomes to stdout", func(t *testing.T) {
+		var stdout bytes.Buffer
+		writeRestoreOutcomes(&stdout, "-", []restoreOutcome{
+			{Status: RestoreMiss, Keys: []string{"gems-branch-abc"}},
+		})
+
+		outcomes := []map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal(stdout.Bytes(), &outcomes))
+		if assert.Len(t, outcomes, 1) {
+			assert.Equal(t, "miss", outcomes[0]["status"])
+			assert.NotContains(t, outcomes[0], "error")
+		}
+	})
+}
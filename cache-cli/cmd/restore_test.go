@@ -19,6 +19,7 @@ import (
 )
 
 func Test__Restore(t *testing.T) {
+	restoreCmd := NewRestoreCommand()
 	log.SetFormatter(new(logging.CustomFormatter))
 	log.SetLevel(log.InfoLevel)
 	log.SetOutput(openLogfileForTests(t))
@@ -49,7 +50,7 @@ func Test__Restore(t *testing.T) {
 
 			metricsManager := metrics.NewNoOpMetricsManager()
 			archiver := archive.NewShellOutArchiver(metricsManager)
-			compressAndStore(storage, archiver, metricsManager, "abc-001", tempDir)
+			compressAndStore(t, storage, archiver, metricsManager, "abc-001", tempDir)
 			RunRestore(restoreCmd, []string{"abc-001"})
 			output := readOutputFromFile(t)
 
@@ -70,7 +71,7 @@ func Test__Restore(t *testing.T) {
 
 			metricsManager := metrics.NewNoOpMetricsManager()
 			archiver := archive.NewShellOutArchiver(metricsManager)
-			compressAndStore(storage, archiver, metricsManager, "abc/00/22", tempDir)
+			compressAndStore(t, storage, archiver, metricsManager, "abc/00/22", tempDir)
 			RunRestore(restoreCmd, []string{"abc/00/22"})
 			output := readOutputFromFile(t)
 
@@ -92,7 +93,7 @@ func Test__Restore(t *testing.T) {
 
 			metricsManager := metrics.NewNoOpMetricsManager()
 			archiver := archive.NewShellOutArchiver(metricsManager)
-			compressAndStore(storage, archiver, metricsManager, "abc-001", tempDir)
+			compressAndStore(t, storage, archiver, metricsManager, "abc-001", tempDir)
 			RunRestore(restoreCmd, []string{"abc"})
 			output := readOutputFromFile(t)
 
@@ -113,8 +114,8 @@ func Test__Restore(t *testing.T) {
 
 			metricsManager := metrics.NewNoOpMetricsManager()
 			archiver := archive.NewShellOutArchiver(metricsManager)
-			compressAndStore(storage, archiver, metricsManager, "abc-001", tempDir)
-			compressAndStore(storage, archiver, metricsManager, "abc-002", tempDir)
+			compressAndStore(t, storage, archiver, metricsManager, "abc-001", tempDir)
+			compressAndStore(t, storage, archiver, metricsManager, "abc-002", tempDir)
 			RunRestore(restoreCmd, []string{"abc-001,abc-002"})
 			output := readOutputFromFile(t)
 
@@ -136,7 +137,7 @@ func Test__Restore(t *testing.T) {
 
 			metricsManager := metrics.NewNoOpMetricsManager()
 			archiver := archive.NewShellOutArchiver(metricsManager)
-			compressAndStore(storage, archiver, metricsManager, "abc", tempDir)
+			compressAndStore(t, storage, archiver, metricsManager, "abc", tempDir)
 			RunRestore(restoreCmd, []string{"abc-001,abc"})
 			output := readOutputFromFile(t)
 
@@ -158,17 +159,209 @@ func Test__Restore(t *testing.T) {
 
 			metricsManager := metrics.NewNoOpMetricsManager()
 			archiver := archive.NewShellOutArchiver(metricsManager)
-			compressAndStore(storage, archiver, metricsManager, "abc", tempDir)
-			RunRestore(restoreCmd, []string{"^abc"})
+			compressAndStore(t, storage, archiver, metricsManager, "abc", tempDir)
+
+			regexRestoreCmd := NewRestoreCommand()
+			regexRestoreCmd.Flags().Set("regex", "true")
+			RunRestore(regexRestoreCmd, []string{"^abc"})
 			output := readOutputFromFile(t)
 
 			restoredPath := filepath.FromSlash(fmt.Sprintf("%s/", tempDir))
 			assert.Contains(t, output, "HIT: '^abc', using key 'abc'.")
+			assert.Contains(t, output, "Key 'abc' was chosen because it is the most recently stored of 1 key(s) matching regular expression '^abc'.")
 			assert.Contains(t, output, fmt.Sprintf("Restored: %s.", restoredPath))
 
 			os.Remove(tempFile.Name())
 			os.Remove(tempDir)
 		})
+
+		t.Run(fmt.Sprintf("%s regex key is used as prefix without --regex", backend), func(*testing.T) {
+			storage.Clear()
+
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			tempFile, _ := ioutil.TempFile(tempDir, "*")
+			_ = tempFile.Close()
+
+			metricsManager := metrics.NewNoOpMetricsManager()
+			archiver := archive.NewShellOutArchiver(metricsManager)
+			compressAndStore(t, storage, archiver, metricsManager, "abc", tempDir)
+			RunRestore(restoreCmd, []string{"^abc"})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "MISS: '^abc'.")
+
+			os.Remove(tempFile.Name())
+			os.Remove(tempDir)
+		})
+
+		t.Run(fmt.Sprintf("%s most recently stored matching key is used", backend), func(*testing.T) {
+			storage.Clear()
+
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			tempFile, _ := ioutil.TempFile(tempDir, "*")
+			_ = tempFile.Close()
+
+			metricsManager := metrics.NewNoOpMetricsManager()
+			archiver := archive.NewShellOutArchiver(metricsManager)
+			compressAndStore(t, storage, archiver, metricsManager, "abc-002", tempDir)
+			time.Sleep(time.Second)
+			compressAndStore(t, storage, archiver, metricsManager, "abc-001", tempDir)
+			RunRestore(restoreCmd, []string{"abc"})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "HIT: 'abc', using key 'abc-001'.")
+			assert.Contains(t, output, "Key 'abc-001' was chosen because it is the most recently stored of 2 key(s) starting with 'abc'.")
+
+			os.Remove(tempFile.Name())
+			os.Remove(tempDir)
+		})
+	})
+
+	runTestForAllBackends(t, func(backend string, storage storage.Storage) {
+		t.Run(fmt.Sprintf("%s --exact does not use prefix matching", backend), func(*testing.T) {
+			storage.Clear()
+
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			tempFile, _ := ioutil.TempFile(tempDir, "*")
+			_ = tempFile.Close()
+
+			metricsManager := metrics.NewNoOpMetricsManager()
+			archiver := archive.NewShellOutArchiver(metricsManager)
+			compressAndStore(t, storage, archiver, metricsManager, "abc-001", tempDir)
+
+			exactRestoreCmd := NewRestoreCommand()
+			exactRestoreCmd.Flags().Set("exact", "true")
+			assert.True(t, RunRestore(exactRestoreCmd, []string{"abc,abc-001"}))
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "MISS: 'abc'.")
+			assert.Contains(t, output, "HIT: 'abc-001', using key 'abc-001'.")
+
+			os.Remove(tempFile.Name())
+			os.Remove(tempDir)
+		})
+
+		t.Run(fmt.Sprintf("%s --fail-on-miss", backend), func(*testing.T) {
+			storage.Clear()
+
+			failOnMissRestoreCmd := NewRestoreCommand()
+			failOnMissRestoreCmd.Flags().Set("fail-on-miss", "true")
+			assert.False(t, RunRestore(failOnMissRestoreCmd, []string{"this-key-does-not-exist"}))
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "MISS: 'this-key-does-not-exist'.")
+			assert.Contains(t, output, "Cache restore failed: no matching keys were found.")
+		})
+
+		t.Run(fmt.Sprintf("%s dry run does not download anything", backend), func(*testing.T) {
+			storage.Clear()
+
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			tempFile, _ := ioutil.TempFile(tempDir, "*")
+			_ = tempFile.Close()
+
+			metricsManager := metrics.NewNoOpMetricsManager()
+			archiver := archive.NewShellOutArchiver(metricsManager)
+			compressAndStore(t, storage, archiver, metricsManager, "abc-001", tempDir)
+
+			dryRunRestoreCmd := NewRestoreCommand()
+			dryRunRestoreCmd.Flags().Set("dry-run", "true")
+			RunRestore(dryRunRestoreCmd, []string{"abc-002,abc"})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "MISS: 'abc-002'.")
+			assert.Contains(t, output, "HIT: 'abc', using key 'abc-001'.")
+			assert.Contains(t, output, "[dry-run] Would download key 'abc-001'")
+			assert.NotContains(t, output, "Downloading key")
+
+			os.Remove(tempFile.Name())
+			os.Remove(tempDir)
+		})
+
+		t.Run(fmt.Sprintf("%s writes outcome file", backend), func(*testing.T) {
+			storage.Clear()
+
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			tempFile, _ := ioutil.TempFile(tempDir, "*")
+			_ = tempFile.Close()
+			outcomeFile := filepath.Join(os.TempDir(), "restore-outcome.json")
+
+			metricsManager := metrics.NewNoOpMetricsManager()
+			archiver := archive.NewShellOutArchiver(metricsManager)
+			compressAndStore(t, storage, archiver, metricsManager, "abc-001", tempDir)
+
+			outcomeRestoreCmd := NewRestoreCommand()
+			outcomeRestoreCmd.Flags().Set("outcome-file", outcomeFile)
+			RunRestore(outcomeRestoreCmd, []string{"abc-002,abc"})
+			_ = readOutputFromFile(t)
+
+			content, err := ioutil.ReadFile(outcomeFile)
+			assert.Nil(t, err)
+			assert.Contains(t, string(content), `"status": "partial-hit"`)
+			assert.Contains(t, string(content), `"matched_key": "abc-001"`)
+
+			os.Remove(outcomeFile)
+			os.Remove(tempFile.Name())
+			os.Remove(tempDir)
+		})
+
+		t.Run(fmt.Sprintf("%s restores into another directory with --to", backend), func(*testing.T) {
+			storage.Clear()
+
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			tempFile, _ := ioutil.TempFile(tempDir, "*")
+			_ = tempFile.Close()
+			destination, _ := ioutil.TempDir(os.TempDir(), "*")
+
+			metricsManager := metrics.NewNoOpMetricsManager()
+			archiver := archive.NewShellOutArchiver(metricsManager)
+			compressAndStore(t, storage, archiver, metricsManager, "abc-001", tempDir)
+			os.RemoveAll(tempDir)
+
+			toRestoreCmd := NewRestoreCommand()
+			toRestoreCmd.Flags().Set("to", destination)
+			RunRestore(toRestoreCmd, []string{"abc-001"})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, fmt.Sprintf("into '%s'", destination))
+			assert.FileExists(t, filepath.Join(destination, tempFile.Name()))
+			assert.NoDirExists(t, tempDir)
+
+			os.RemoveAll(destination)
+		})
+	})
+
+	runTestForSingleBackend(t, "s3", func(projectStorage storage.Storage) {
+		t.Run("restoring falls back to other scopes", func(t *testing.T) {
+			orgStorage, err := storage.InitStorageWithConfig(storage.StorageConfig{SortKeysBy: storage.SortByStoreTime, Scope: storage.ScopeOrg})
+			assert.Nil(t, err)
+			projectStorage.Clear()
+			orgStorage.Clear()
+
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			tempFile, _ := ioutil.TempFile(tempDir, "*")
+			_ = tempFile.Close()
+
+			metricsManager := metrics.NewNoOpMetricsManager()
+			archiver := archive.NewShellOutArchiver(metricsManager)
+			compressAndStore(t, orgStorage, archiver, metricsManager, "shared-toolchain", tempDir)
+
+			projectOnlyRestoreCmd := NewRestoreCommand()
+			RunRestore(projectOnlyRestoreCmd, []string{"shared-toolchain"})
+			output := readOutputFromFile(t)
+			assert.Contains(t, output, "MISS: 'shared-toolchain'.")
+
+			scopedRestoreCmd := NewRestoreCommand()
+			scopedRestoreCmd.Flags().Set("scope", "project,org")
+			RunRestore(scopedRestoreCmd, []string{"shared-toolchain"})
+			output = readOutputFromFile(t)
+			assert.Contains(t, output, "Looking for keys in scope 'org'...")
+			assert.Contains(t, output, "HIT: 'shared-toolchain', using key 'shared-toolchain'.")
+			assert.Contains(t, output, "Restored: ")
+
+			orgStorage.Clear()
+			os.RemoveAll(tempDir)
+		})
 	})
 
 	runTestForSingleBackend(t, "sftp", func(storage storage.Storage) {
@@ -181,7 +374,7 @@ func Test__Restore(t *testing.T) {
 
 			metricsManager := metrics.NewNoOpMetricsManager()
 			archiver := archive.NewShellOutArchiver(metricsManager)
-			compressAndStore(storage, archiver, metricsManager, "abc", tempDir)
+			compressAndStore(t, storage, archiver, metricsManager, "abc", tempDir)
 
 			// set the environment variables to download using HTTP instead before restoring
 			os.Setenv("SEMAPHORE_CACHE_CDN_URL", "http://sftp-server:80")
@@ -193,11 +386,11 @@ func Test__Restore(t *testing.T) {
 				os.Unsetenv("SEMAPHORE_CACHE_CDN_SECRET")
 			}()
 
-			RunRestore(restoreCmd, []string{"^abc"})
+			RunRestore(restoreCmd, []string{"abc"})
 			output := readOutputFromFile(t)
 
 			restoredPath := filepath.FromSlash(fmt.Sprintf("%s/", tempDir))
-			assert.Contains(t, output, "HIT: '^abc', using key 'abc'.")
+			assert.Contains(t, output, "HIT: 'abc', using key 'abc'.")
 			assert.Contains(t, output, fmt.Sprintf("Restored: %s.", restoredPath))
 
 			os.Remove(tempFile.Name())
@@ -213,7 +406,7 @@ func Test__Restore(t *testing.T) {
 
 			metricsManager := metrics.NewNoOpMetricsManager()
 			archiver := archive.NewShellOutArchiver(metricsManager)
-			compressAndStore(storage, archiver, metricsManager, "abc", tempDir)
+			compressAndStore(t, storage, archiver, metricsManager, "abc", tempDir)
 
 			// Set just the URL, but not the user/pass
 			// This means SFTP will still be used.
@@ -222,11 +415,11 @@ func Test__Restore(t *testing.T) {
 				os.Unsetenv("SEMAPHORE_CACHE_CDN_URL")
 			}()
 
-			RunRestore(restoreCmd, []string{"^abc"})
+			RunRestore(restoreCmd, []string{"abc"})
 			output := readOutputFromFile(t)
 
 			restoredPath := filepath.FromSlash(fmt.Sprintf("%s/", tempDir))
-			assert.Contains(t, output, "HIT: '^abc', using key 'abc'.")
+			assert.Contains(t, output, "HIT: 'abc', using key 'abc'.")
 			assert.Contains(t, output, fmt.Sprintf("Restored: %s.", restoredPath))
 
 			os.Remove(tempFile.Name())
@@ -235,7 +428,52 @@ func Test__Restore(t *testing.T) {
 	})
 }
 
+func Test__FindMatchingKey(t *testing.T) {
+	older := time.Now().Add(-time.Hour)
+	newer := time.Now()
+	availableKeys := []storage.CacheKey{
+		{Name: "gems-master-abc", StoredAt: &older},
+		{Name: "gems-master-def", StoredAt: &newer},
+		{Name: "gems.master", StoredAt: &newer},
+		{Name: "node-modules-master", StoredAt: &newer},
+	}
+
+	t.Run("no match", func(t *testing.T) {
+		assert.Nil(t, findMatchingKey(availableKeys, "yarn", false))
+	})
+
+	t.Run("uses most recently stored key with prefix", func(t *testing.T) {
+		match := findMatchingKey(availableKeys, "gems-master", false)
+		if assert.NotNil(t, match) {
+			assert.Equal(t, "gems-master-def", match.Key)
+			assert.Equal(t, "most recently stored of 2 key(s) starting with 'gems-master'", match.Reason)
+		}
+	})
+
+	t.Run("special characters are not treated as regex by default", func(t *testing.T) {
+		match := findMatchingKey(availableKeys, "gems.", false)
+		if assert.NotNil(t, match) {
+			assert.Equal(t, "gems.master", match.Key)
+		}
+
+		assert.Nil(t, findMatchingKey(availableKeys, "^gems", false))
+	})
+
+	t.Run("uses regex if requested", func(t *testing.T) {
+		match := findMatchingKey(availableKeys, "^gems.master-", true)
+		if assert.NotNil(t, match) {
+			assert.Equal(t, "gems-master-def", match.Key)
+			assert.Equal(t, "most recently stored of 2 key(s) matching regular expression '^gems.master-'", match.Reason)
+		}
+	})
+
+	t.Run("invalid regex matches nothing", func(t *testing.T) {
+		assert.Nil(t, findMatchingKey(availableKeys, "gems(", true))
+	})
+}
+
 func Test__AutomaticRestore(t *testing.T) {
+	restoreCmd := NewRestoreCommand()
 	_, file, _, _ := runtime.Caller(0)
 	cmdPath := filepath.Dir(file)
 	rootPath := filepath.Dir(cmdPath)
@@ -293,7 +531,7 @@ func Test__AutomaticRestore(t *testing.T) {
 
 			// storing
 			checksum, _ := files.GenerateChecksum("Gemfile.lock")
-			key := fmt.Sprintf("gems-some-development-branch-%s", checksum)
+			key := fmt.Sprintf("gems-some_-development_-branch-%s", checksum)
 			archiver := archive.NewShellOutArchiver(metrics.NewNoOpMetricsManager())
 			compressedFile := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", key, time.Now().Nanosecond()))
 			archiver.Compress(compressedFile, "vendor/bundle")
@@ -312,3 +550,9 @@ func Test__AutomaticRestore(t *testing.T) {
 		})
 	})
 }
+
+func compressAndStore(t *testing.T, storage storage.Storage, archiver archive.Archiver, metricsManager metrics.MetricsManager, rawKey, path string) {
+	logger := log.NewEntry(log.StandardLogger())
+	err := compressAndStoreWithOptions(logger, storage, archiver, metricsManager, rawKey, path, storeOptions{})
+	assert.Nil(t, err)
+}
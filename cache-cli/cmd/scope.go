@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type scopedStorage struct {
+	Scope   string
+	Storage storage.Storage
+}
+
+func addScopeFlag(cmd *cobra.Command, description string) {
+	cmd.Flags().String("scope", storage.ScopeProject, description)
+}
+
+// Commands managing keys, like list and delete, work on a single scope.
+func findScope(cmd *cobra.Command) string {
+	scope, err := cmd.Flags().GetString("scope")
+	utils.Check(err)
+
+	utils.Check(storage.ValidateScope(scope))
+	return scope
+}
+
+// Restores look for keys in each scope, in order.
+func initScopedStorages(cmd *cobra.Command) []scopedStorage {
+	value, err := cmd.Flags().GetString("scope")
+	utils.Check(err)
+
+	scopes, err := storage.ParseScopes(value)
+	utils.Check(err)
+
+	storages := []scopedStorage{}
+	for _, scope := range scopes {
+		s, err := storage.InitStorageWithConfig(storage.StorageConfig{SortKeysBy: storage.SortByStoreTime, Scope: scope})
+		utils.Check(err)
+		storages = append(storages, scopedStorage{Scope: scope, Storage: s})
+	}
+
+	return storages
+}
+
+// Uses the first scope with a key matching the ones given.
+// Scopes are only mentioned in the logs when more than one is used.
+func resolveRestoreKeyInScopes(logger *log.Entry, storages []scopedStorage, keys []string, options restoreOptions) (*keyMatch, storage.Storage, error) {
+	for i, scoped := range storages {
+		if len(storages) > 1 {
+			logger.Infof("Looking for keys in scope '%s'...", scoped.Scope)
+		}
+
+		match, err := resolveRestoreKey(logger, scoped.Storage, keys, options)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if match != nil {
+			match.Scope = scoped.Scope
+			match.ScopeIndex = i
+			return match, scoped.Storage, nil
+		}
+	}
+
+	return nil, nil, nil
+}
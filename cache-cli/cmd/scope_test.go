@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/logging"
+	log "github.com/sirupsen/logrus"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__StoreInReadOnlyScope(t *testing.T) {
+	log.SetFormatter(new(logging.CustomFormatter))
+	log.SetLevel(log.InfoLevel)
+	log.SetOutput(openLogfileForTests(t))
+
+	os.Setenv("SEMAPHORE_CACHE_READ_ONLY_SCOPES", "org")
+	defer os.Unsetenv("SEMAPHORE_CACHE_READ_ONLY_SCOPES")
+
+	storeCmd := NewStoreCommand()
+	storeCmd.Flags().Set("scope", "org")
+	RunStore(storeCmd, []string{"abc001", os.TempDir()})
+	output := readOutputFromFile(t)
+
+	assert.Contains(t, output, "Scope 'org' is read-only, nothing will be stored.")
+	assert.NotContains(t, output, "Uploading")
+}
+
+func Test__DeleteInReadOnlyScope(t *testing.T) {
+	log.SetFormatter(new(logging.CustomFormatter))
+	log.SetLevel(log.InfoLevel)
+	log.SetOutput(openLogfileForTests(t))
+
+	os.Setenv("SEMAPHORE_CACHE_READ_ONLY_SCOPES", "org")
+	defer os.Unsetenv("SEMAPHORE_CACHE_READ_ONLY_SCOPES")
+
+	deleteCmd := NewDeleteCommand()
+	deleteCmd.Flags().Set("scope", "org")
+	deleteCmd.Flags().Set("prefix", "abc")
+	RunDelete(deleteCmd, []string{})
+	output := readOutputFromFile(t)
+
+	assert.Contains(t, output, "Scope 'org' is read-only, nothing will be deleted.")
+	assert.NotContains(t, output, "Deleting key")
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/server"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func NewServeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the cache as a remote cache for build tools.",
+		Long: `Start an HTTP server using the configured cache backend as a remote cache for build tools.
+Bazel can use it with --remote_cache=http://<address>, and ccache and sccache
+through their HTTP storage backends, without having access to the cache credentials.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			RunServe(cmd, args)
+		},
+	}
+
+	cmd.Flags().String("listen", "127.0.0.1:9092", "Address to listen on.")
+	cmd.Flags().Bool("read-only", false, "Only allow reading from the cache.")
+	cmd.Flags().String("key-prefix", server.DefaultKeyPrefix, "Prefix for the keys used to store entries.")
+	cmd.Flags().Bool("verbose", false, "Log every request.")
+	addScopeFlag(cmd, "Scope to keep entries in: project, org, or the name of a custom scope shared by all projects.")
+	return cmd
+}
+
+func RunServe(cmd *cobra.Command, args []string) {
+	listen, err := cmd.Flags().GetString("listen")
+	utils.Check(err)
+
+	readOnly, err := cmd.Flags().GetBool("read-only")
+	utils.Check(err)
+
+	keyPrefix, err := cmd.Flags().GetString("key-prefix")
+	utils.Check(err)
+
+	verbose, err := cmd.Flags().GetBool("verbose")
+	utils.Check(err)
+
+	scope, err := cmd.Flags().GetString("scope")
+	utils.Check(err)
+
+	if storage.IsReadOnlyScope(scope) {
+		log.Infof("Scope '%s' is read-only, only reads are allowed.", scope)
+		readOnly = true
+	}
+
+	if verbose {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	storage, err := storage.InitStorageWithConfig(storage.StorageConfig{SortKeysBy: storage.SortByStoreTime, Scope: scope})
+	utils.Check(err)
+
+	httpServer := &http.Server{
+		Addr:              listen,
+		Handler:           server.NewServer(storage, keyPrefix, readOnly),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Requests being handled are allowed to finish when the server is stopped.
+	stopped := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer close(stopped)
+		<-signals
+		log.Info("Stopping server...")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Errorf("Error stopping server: %v", err)
+		}
+	}()
+
+	log.Infof("Serving cache on http://%s...", listen)
+	err = httpServer.ListenAndServe()
+	if err != http.ErrServerClosed {
+		utils.Check(err)
+	}
+
+	<-stopped
+}
+
+func init() {
+	RootCmd.AddCommand(NewServeCommand())
+}
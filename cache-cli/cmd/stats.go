@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/metrics"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func NewStatsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Summarize cache hits, misses and transfers recorded in the local metrics file.",
+		Long:  ``,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			RunStats(cmd, args)
+		},
+	}
+
+	cmd.Flags().String("file", "", "Metrics file to read. Defaults to the file used by the local metrics backend.")
+	addOutputFlag(cmd)
+	return cmd
+}
+
+func RunStats(cmd *cobra.Command, args []string) {
+	path, err := cmd.Flags().GetString("file")
+	utils.Check(err)
+
+	output := findOutputFormat(cmd)
+
+	if path == "" {
+		metricsManager, err := metrics.NewLocalMetricsBackend()
+		utils.Check(err)
+		path = metricsManager.ToolboxMetricsPath
+	}
+
+	events, err := metrics.ReadEvents(path)
+	if err != nil {
+		log.Errorf("Error reading metrics from '%s': %v", path, err)
+		log.Info("Metrics are only recorded if SEMAPHORE_TOOLBOX_METRICS_ENABLED=true.")
+		return
+	}
+
+	summary := metrics.Summarize(events)
+	if output != OutputText {
+		writeOutput(cmd, output, summary, []string{"metric", "value"}, statsRows(summary))
+		return
+	}
+
+	log.Info(formatStats(summary))
+}
+
+func formatStats(summary metrics.Summary) string {
+	restores := summary.Restores
+	stores := summary.Stores
+
+	formatted := "RESTORES\n"
+	formatted += fmt.Sprintf("  Total:            %d\n", restores.Total)
+	formatted += fmt.Sprintf("  Hits:             %d\n", restores.Hits)
+	formatted += fmt.Sprintf("  Partial hits:     %d\n", restores.PartialHits)
+	formatted += fmt.Sprintf("  Misses:           %d\n", restores.Misses)
+	formatted += fmt.Sprintf("  Hit rate:         %.1f%%\n", restores.HitRate*100)
+	formatted += fmt.Sprintf("  Corrupt archives: %d\n", restores.Corrupt)
+	formatted += fmt.Sprintf("  Downloaded:       %s\n", files.HumanReadableSize(restores.BytesDownloaded))
+	formatted += fmt.Sprintf("  Avg. download:    %dms\n", restores.AvgDownloadMs)
+	formatted += fmt.Sprintf("  Avg. unpack:      %dms\n", restores.AvgUnpackMs)
+
+	for _, index := range sortedKeyIndexes(restores.HitsByKeyIndex) {
+		formatted += fmt.Sprintf("  Hits on key #%d:   %d\n", index+1, restores.HitsByKeyIndex[index])
+	}
+
+	for _, source := range sortedMethods(restores.Sources) {
+		formatted += fmt.Sprintf("  From %s: %d\n", source, restores.Sources[source])
+	}
+
+	formatted += "STORES\n"
+	formatted += fmt.Sprintf("  Total:            %d\n", stores.Total)
+	formatted += fmt.Sprintf("  Stored:           %d\n", stores.Stored)
+	formatted += fmt.Sprintf("  Skipped:          %d\n", stores.Skipped)
+	formatted += fmt.Sprintf("  Uploaded:         %s\n", files.HumanReadableSize(stores.BytesUploaded))
+	formatted += fmt.Sprintf("  Avg. upload:      %dms\n", stores.AvgUploadMs)
+	formatted += fmt.Sprintf("  Avg. compression: %dms\n", stores.AvgCompressionMs)
+
+	for _, method := range sortedMethods(summary.ArchiveMethods) {
+		formatted += fmt.Sprintf("ARCHIVE METHOD %s: %d\n", method, summary.ArchiveMethods[method])
+	}
+
+	return formatted
+}
+
+func statsRows(summary metrics.Summary) [][]string {
+	restores := summary.Restores
+	stores := summary.Stores
+
+	rows := [][]string{
+		{"restores.total", strconv.Itoa(restores.Total)},
+		{"restores.hits", strconv.Itoa(restores.Hits)},
+		{"restores.partial_hits", strconv.Itoa(restores.PartialHits)},
+		{"restores.misses", strconv.Itoa(restores.Misses)},
+		{"restores.hit_rate", strconv.FormatFloat(restores.HitRate, 'f', 4, 64)},
+		{"restores.corrupt", strconv.Itoa(restores.Corrupt)},
+		{"restores.bytes_downloaded", strconv.FormatInt(restores.BytesDownloaded, 10)},
+		{"restores.avg_download_ms", strconv.FormatInt(restores.AvgDownloadMs, 10)},
+		{"restores.avg_unpack_ms", strconv.FormatInt(restores.AvgUnpackMs, 10)},
+	}
+
+	for _, index := range sortedKeyIndexes(restores.HitsByKeyIndex) {
+		rows = append(rows, []string{fmt.Sprintf("restores.hits_by_key_index.%d", index), strconv.Itoa(restores.HitsByKeyIndex[index])})
+	}
+
+	for _, source := range sortedMethods(restores.Sources) {
+		rows = append(rows, []string{fmt.Sprintf("restores.sources.%s", source), strconv.Itoa(restores.Sources[source])})
+	}
+
+	rows = append(rows,
+		[]string{"stores.total", strconv.Itoa(stores.Total)},
+		[]string{"stores.stored", strconv.Itoa(stores.Stored)},
+		[]string{"stores.skipped", strconv.Itoa(stores.Skipped)},
+		[]string{"stores.bytes_uploaded", strconv.FormatInt(stores.BytesUploaded, 10)},
+		[]string{"stores.avg_upload_ms", strconv.FormatInt(stores.AvgUploadMs, 10)},
+		[]string{"stores.avg_compression_ms", strconv.FormatInt(stores.AvgCompressionMs, 10)},
+	)
+
+	for _, method := range sortedMethods(summary.ArchiveMethods) {
+		rows = append(rows, []string{fmt.Sprintf("archive_methods.%s", method), strconv.Itoa(summary.ArchiveMethods[method])})
+	}
+
+	return rows
+}
+
+func sortedKeyIndexes(hits map[int]int) []int {
+	indexes := []int{}
+	for index := range hits {
+		indexes = append(indexes, index)
+	}
+
+	sort.Ints(indexes)
+	return indexes
+}
+
+func sortedMethods(methods map[string]int) []string {
+	names := []string{}
+	for name := range methods {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RootCmd.AddCommand(NewStatsCommand())
+}
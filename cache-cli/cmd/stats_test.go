@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/logging"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__Stats(t *testing.T) {
+	log.SetFormatter(new(logging.CustomFormatter))
+	log.SetLevel(log.InfoLevel)
+	log.SetOutput(openLogfileForTests(t))
+
+	tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+	defer os.RemoveAll(tempDir)
+
+	metricsFile := filepath.Join(tempDir, "toolbox_metrics")
+	content := "usercache,server=10.0.0.5,user=tester,command=restore,corrupt=0,result=hit,archive_method=native size=100,duration=1000,key_index=0,unpack_duration=500\n" +
+		"usercache,server=10.0.0.5,user=tester,command=restore,corrupt=0,result=partial-hit,archive_method=native size=300,duration=3000,key_index=1,unpack_duration=1500\n" +
+		"usercache_outcome,server=10.0.0.5,user=tester,command=restore,corrupt=0,result=miss duration=0\n" +
+		"usercache_outcome,server=10.0.0.5,user=tester,command=store,corrupt=0,result=skipped duration=0\n"
+	_ = ioutil.WriteFile(metricsFile, []byte(content), 0600)
+
+	t.Run("missing file", func(t *testing.T) {
+		statsCmd := NewStatsCommand()
+		statsCmd.Flags().Set("file", filepath.Join(tempDir, "does-not-exist"))
+		RunStats(statsCmd, []string{})
+		output := readOutputFromFile(t)
+
+		assert.Contains(t, output, "Error reading metrics from")
+	})
+
+	t.Run("text", func(t *testing.T) {
+		statsCmd := NewStatsCommand()
+		statsCmd.Flags().Set("file", metricsFile)
+		RunStats(statsCmd, []string{})
+		output := readOutputFromFile(t)
+
+		assert.Contains(t, output, "Hits:             1")
+		assert.Contains(t, output, "Partial hits:     1")
+		assert.Contains(t, output, "Misses:           1")
+		assert.Contains(t, output, "Hit rate:         66.7%")
+		assert.Contains(t, output, "Avg. download:    2000ms")
+		assert.Contains(t, output, "Hits on key #2:   1")
+		assert.Contains(t, output, "Skipped:          1")
+		assert.Contains(t, output, "ARCHIVE METHOD native: 2")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		statsCmd := NewStatsCommand()
+		statsCmd.Flags().Set("file", metricsFile)
+		statsCmd.Flags().Set("output", "json")
+		buffer := bytes.NewBufferString("")
+		statsCmd.SetOut(buffer)
+		RunStats(statsCmd, []string{})
+
+		summary := metrics.Summary{}
+		assert.Nil(t, json.Unmarshal(buffer.Bytes(), &summary))
+		assert.Equal(t, 3, summary.Restores.Total)
+		assert.Equal(t, int64(400), summary.Restores.BytesDownloaded)
+		assert.Equal(t, map[int]int{0: 1, 1: 1}, summary.Restores.HitsByKeyIndex)
+		assert.Equal(t, 1, summary.Stores.Skipped)
+	})
+}
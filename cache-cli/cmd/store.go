@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/semaphoreci/toolbox/cache-cli/pkg/archive"
@@ -35,6 +37,14 @@ func NewStoreCommand() *cobra.Command {
 	`, strings.Join(storage.ValidSortByKeys, ","))
 
 	cmd.Flags().StringP("cleanup-by", "c", storage.SortByStoreTime, description)
+	cmd.Flags().Bool("dry-run", false, "Only show what would be uploaded, without compressing or uploading anything.")
+	cmd.Flags().Bool("overwrite", false, "Replace the key if it already exists in the cache.")
+	cmd.Flags().Bool("skip-unchanged", false, `Skip the upload if the path did not change since it was restored from the cache using the same key,
+with 'cache restore --record-manifest'. A path restored from a fallback key is still uploaded,
+since the new key would be missing otherwise.`)
+	addScopeFlag(cmd, "Scope to store keys in: project, org, or the name of a custom scope shared by all projects.")
+	addLookupFlags(cmd)
+	addParallelismFlag(cmd)
 	return cmd
 }
 
@@ -48,115 +58,304 @@ func RunStore(cmd *cobra.Command, args []string) {
 	cleanupBy, err := cmd.Flags().GetString("cleanup-by")
 	utils.Check(err)
 
-	storage, err := storage.InitStorageWithConfig(storage.StorageConfig{SortKeysBy: cleanupBy})
+	dryRun, err := cmd.Flags().GetBool("dry-run")
 	utils.Check(err)
 
-	metricsManager, err := metrics.InitMetricsManager(metrics.LocalBackend)
+	overwrite, err := cmd.Flags().GetBool("overwrite")
 	utils.Check(err)
 
+	skipUnchanged, err := cmd.Flags().GetBool("skip-unchanged")
+	utils.Check(err)
+
+	scope, err := cmd.Flags().GetString("scope")
+	utils.Check(err)
+
+	if storage.IsReadOnlyScope(scope) {
+		log.Errorf("Scope '%s' is read-only, nothing will be stored.", scope)
+		return
+	}
+
+	options := storeOptions{Overwrite: overwrite, SkipUnchanged: skipUnchanged}
+	parallelism := findParallelism(cmd)
+
+	storage, err := storage.InitStorageWithConfig(storage.StorageConfig{SortKeysBy: cleanupBy, Scope: scope})
+	utils.Check(err)
+
+	metricsManager := metrics.InitMetricsManagerFromEnv()
+
 	archiver := archive.NewArchiver(metricsManager)
 
 	if len(args) == 0 {
-		lookupResults := files.Lookup(files.LookupOptions{
-			GitBranch: FindGitBranch(),
-			Restore:   false,
-		})
+		lookupResults := files.Lookup(buildLookupOptions(cmd, false))
 
 		if len(lookupResults) == 0 {
 			log.Info("Nothing to store in cache.")
 			return
 		}
 
-		for _, lookupResult := range lookupResults {
-			log.Infof("Detected %s.", lookupResult.DetectedFile)
-			for _, entry := range lookupResult.Entries {
-				log.Infof("Using default cache path '%s'.", entry.Path)
+		start := time.Now()
+		groups := groupEntriesByPath(lookupResults)
+		prefixed := parallelism > 1 && len(groups) > 1
+		err := forEachInParallel(len(groups), parallelism, func(i int) error {
+			errs := []error{}
+			for _, entry := range groups[i] {
+				logger := entryLogger(entry.Path, prefixed)
+				logger.Infof("Detected %s.", entry.DetectedFile)
+				logger.Infof("Using default cache path '%s'.", entry.Path)
 				key := entry.Keys[0]
-				compressAndStore(storage, archiver, metricsManager, key, entry.Path)
+				if dryRun {
+					describeStore(logger, storage, key, entry.Path, options)
+					continue
+				}
+
+				err := compressAndStoreWithOptions(logger, storage, archiver, metricsManager, key, entry.Path, options)
+				if err != nil {
+					logger.Errorf("Error storing '%s': %v", entry.Path, err)
+					errs = append(errs, err)
+				}
 			}
-		}
+
+			return errors.Join(errs...)
+		})
+
+		log.Infof("Processed %d cache entries. Total duration: %v.", countEntries(groups), time.Since(start))
+
+		// Exiting only after every entry was processed, so no upload is interrupted halfway.
+		utils.Check(err)
 	} else {
+		logger := log.NewEntry(log.StandardLogger())
 		path := filepath.FromSlash(args[1])
-		compressAndStore(storage, archiver, metricsManager, args[0], path)
+		if dryRun {
+			describeStore(logger, storage, args[0], path, options)
+			return
+		}
+
+		err := compressAndStoreWithOptions(logger, storage, archiver, metricsManager, args[0], path, options)
+		utils.Check(err)
 	}
 }
 
-func compressAndStore(storage storage.Storage, archiver archive.Archiver, metricsManager metrics.MetricsManager, rawKey, path string) {
-	key := NormalizeKey(rawKey)
+type storeOptions struct {
+	Overwrite     bool
+	SkipUnchanged bool
+}
+
+// Errors are returned instead of exiting, since other keys might be stored at the same time.
+func compressAndStoreWithOptions(logger *log.Entry, storage storage.Storage, archiver archive.Archiver, metricsManager metrics.MetricsManager, rawKey, path string, options storeOptions) error {
+	key := normalizeKey(logger, rawKey)
 	if _, err := os.Stat(path); err == nil {
 		if ok, _ := storage.HasKey(key); ok {
-			log.Infof("Key '%s' already exists.", key)
-			return
+			if !options.Overwrite {
+				logger.Infof("Key '%s' already exists.", key)
+				publishStoreMetrics(logger, metricsManager, metrics.CacheEvent{Result: metrics.ResultSkipped})
+				return nil
+			}
+
+			logger.Infof("Key '%s' already exists, it will be overwritten.", key)
+		}
+
+		if options.SkipUnchanged && isUnchangedSinceRestore(logger, key, path) {
+			publishStoreMetrics(logger, metricsManager, metrics.CacheEvent{Result: metrics.ResultSkipped})
+			return nil
+		}
+
+		lock := acquireKeyLock(logger, storage, key)
+		if lock == nil {
+			publishStoreMetrics(logger, metricsManager, metrics.CacheEvent{Result: metrics.ResultSkipped})
+			return nil
+		}
+
+		defer lock.Release()
+
+		// Another job might have finished uploading the same key
+		// between our first check and us acquiring the lock.
+		if !options.Overwrite {
+			if ok, _ := storage.HasKey(key); ok {
+				logger.Infof("Key '%s' was stored by another job in the meantime.", key)
+				publishStoreMetrics(logger, metricsManager, metrics.CacheEvent{Result: metrics.ResultSkipped})
+				return nil
+			}
 		}
 
-		compressedFilePath, compressedFileSize, err := compress(archiver, key, path)
+		compressedFilePath, compressedFileSize, compressionDuration, err := compress(logger, archiver, key, path)
 		if err != nil {
-			log.Errorf("Error compressing %s: %v", path, err)
-			return
+			return fmt.Errorf("error compressing %s: %v", path, err)
 		}
 
 		maxSpace := storage.Config().MaxSpace
 		if compressedFileSize > maxSpace {
-			log.Errorf("Archive exceeds allocated %s for cache.", files.HumanReadableSize(maxSpace))
-			return
+			logger.Errorf("Archive exceeds allocated %s for cache.", files.HumanReadableSize(maxSpace))
+			_ = os.Remove(compressedFilePath)
+			return nil
+		}
+
+		// Compressing can take long enough for the lock to expire and be taken over by another job.
+		if lock.Lost() {
+			logger.Infof("Lock for key '%s' was lost while compressing, skipping upload.", key)
+			_ = os.Remove(compressedFilePath)
+			publishStoreMetrics(logger, metricsManager, metrics.CacheEvent{Result: metrics.ResultSkipped})
+			return nil
 		}
 
 		uploadStart := time.Now()
-		log.Infof("Uploading '%s' with cache key '%s'...", path, key)
-		err = storage.Store(key, compressedFilePath)
-		utils.Check(err)
+		logger.Infof("Uploading '%s' with cache key '%s'...", path, key)
+		if options.Overwrite {
+			err = storage.Replace(key, compressedFilePath)
+		} else {
+			err = storage.Store(key, compressedFilePath)
+		}
+
+		if err != nil {
+			_ = os.Remove(compressedFilePath)
+			return err
+		}
 
 		uploadDuration := time.Since(uploadStart)
-		log.Infof("Upload complete. Duration: %v.", uploadDuration)
-		publishStoreMetrics(metricsManager, compressedFileSize, uploadDuration)
+		logger.Infof("Upload complete. Duration: %v.", uploadDuration)
+		publishStoreMetrics(logger, metricsManager, metrics.CacheEvent{
+			Result:              metrics.ResultStored,
+			ArchiveMethod:       archiver.Method(),
+			SizeBytes:           compressedFileSize,
+			Duration:            uploadDuration,
+			CompressionDuration: compressionDuration,
+		})
 
 		err = os.Remove(compressedFilePath)
 		if err != nil {
-			log.Errorf("Error removing %s: %v", compressedFilePath, err)
+			logger.Errorf("Error removing %s: %v", compressedFilePath, err)
 		}
 	} else {
-		log.Infof("'%s' doesn't exist locally.", path)
+		logger.Infof("'%s' doesn't exist locally.", path)
+	}
+
+	return nil
+}
+
+var lockRefreshInterval = storage.LockRefreshInterval
+
+type keyLock struct {
+	logger  *log.Entry
+	storage storage.Storage
+	key     string
+	held    bool
+	lost    int32
+	done    chan struct{}
+}
+
+// Only one job should upload a key at a time.
+// If we can't figure out if someone else is uploading it, we proceed with the upload anyway.
+// While the lock is held, it is refreshed, so uploads taking longer than the lock TTL keep it.
+// Returns nil if another job holds the lock.
+func acquireKeyLock(logger *log.Entry, storage storage.Storage, key string) *keyLock {
+	lock := &keyLock{logger: logger, storage: storage, key: key, done: make(chan struct{})}
+	acquired, err := storage.AcquireLock(key)
+	if err != nil {
+		logger.Errorf("Error acquiring lock for key '%s': %v - proceeding without it.", key, err)
+		return lock
+	}
+
+	if !acquired {
+		logger.Infof("Key '%s' is being uploaded by another job, skipping upload.", key)
+		return nil
 	}
+
+	lock.held = true
+	go lock.refresh()
+	return lock
+}
+
+// A lock that could not be refreshed might have expired and been taken over by another job,
+// so it is considered lost after the first failure.
+func (l *keyLock) refresh() {
+	ticker := time.NewTicker(lockRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			if err := l.storage.RefreshLock(l.key); err != nil {
+				l.logger.Errorf("Error refreshing lock for key '%s': %v", l.key, err)
+				atomic.StoreInt32(&l.lost, 1)
+				return
+			}
+		}
+	}
+}
+
+func (l *keyLock) Lost() bool {
+	return atomic.LoadInt32(&l.lost) == 1
 }
 
-func compress(archiver archive.Archiver, key, path string) (string, int64, error) {
+func (l *keyLock) Release() {
+	close(l.done)
+	if !l.held {
+		return
+	}
+
+	err := l.storage.ReleaseLock(l.key)
+	if err != nil {
+		l.logger.Errorf("Error releasing lock for key '%s': %v", l.key, err)
+	}
+}
+
+func isUnchangedSinceRestore(logger *log.Entry, key, path string) bool {
+	manifest, err := files.UnchangedSinceRestore(files.DefaultManifestDirectory(), key, path)
+	if err != nil {
+		logger.Errorf("Error checking if '%s' changed since it was restored: %v", path, err)
+		return false
+	}
+
+	if manifest == nil {
+		return false
+	}
+
+	logger.Infof("'%s' did not change since it was restored using key '%s', skipping upload.", path, manifest.Key)
+	return true
+}
+
+func compress(logger *log.Entry, archiver archive.Archiver, key, path string) (string, int64, time.Duration, error) {
 	compressingStart := time.Now()
-	log.Infof("Compressing %s...", path)
+	logger.Infof("Compressing %s...", path)
 
 	dst := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", key, time.Now().Nanosecond()))
 	err := archiver.Compress(dst, path)
-	utils.Check(err)
+	if err != nil {
+		_ = os.Remove(dst)
+		return "", -1, time.Since(compressingStart), err
+	}
 
 	compressionDuration := time.Since(compressingStart)
 	info, err := os.Stat(dst)
 	if err != nil {
 		_ = os.Remove(dst)
-		return "", -1, err
+		return "", -1, compressionDuration, err
 	}
 
-	log.Infof("Compression complete. Duration: %v. Size: %v bytes.", compressionDuration.String(), files.HumanReadableSize(info.Size()))
-	return dst, info.Size(), nil
+	logger.Infof("Compression complete. Duration: %v. Size: %v bytes.", compressionDuration.String(), files.HumanReadableSize(info.Size()))
+	return dst, info.Size(), compressionDuration, nil
 }
 
-func publishStoreMetrics(metricsManager metrics.MetricsManager, fileSize int64, uploadDuration time.Duration) {
-	event := metrics.CacheEvent{
-		Command:   metrics.CommandStore,
-		Server:    metrics.CacheServerIP(),
-		User:      metrics.CacheUsername(),
-		SizeBytes: fileSize,
-		Duration:  uploadDuration,
-	}
+func publishStoreMetrics(logger *log.Entry, metricsManager metrics.MetricsManager, event metrics.CacheEvent) {
+	event.Command = metrics.CommandStore
+	event.Server = metrics.CacheServerIP()
+	event.User = metrics.CacheUsername()
 
 	err := metricsManager.LogEvent(event)
 	if err != nil {
-		log.Errorf("Error publishing store metrics: %v", err)
+		logger.Errorf("Error publishing store metrics: %v", err)
 	}
 }
 
 func NormalizeKey(key string) string {
+	return normalizeKey(log.NewEntry(log.StandardLogger()), key)
+}
+
+func normalizeKey(logger *log.Entry, key string) string {
 	normalizedKey := strings.ReplaceAll(key, "/", "-")
 	if normalizedKey != key {
-		log.Infof("Key '%s' is normalized to '%s'.", key, normalizedKey)
+		logger.Infof("Key '%s' is normalized to '%s'.", key, normalizedKey)
 	}
 
 	return normalizedKey
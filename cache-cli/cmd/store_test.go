@@ -77,6 +77,123 @@ func Test__Store(t *testing.T) {
 			output = readOutputFromFile(t)
 			assert.Contains(t, output, "Key 'abc003' already exists")
 		})
+
+		t.Run(fmt.Sprintf("%s overwrites existing key", backend), func(*testing.T) {
+			storage.Clear()
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			ioutil.TempFile(tempDir, "*")
+
+			RunStore(storeCmd, []string{"abc005", tempDir})
+			_ = readOutputFromFile(t)
+
+			overwriteStoreCmd := NewStoreCommand()
+			overwriteStoreCmd.Flags().Set("overwrite", "true")
+			RunStore(overwriteStoreCmd, []string{"abc005", tempDir})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, "Key 'abc005' already exists, it will be overwritten.")
+			assert.Contains(t, output, "Upload complete")
+		})
+
+		t.Run(fmt.Sprintf("%s skips upload if path did not change since restore", backend), func(*testing.T) {
+			storage.Clear()
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			ioutil.TempFile(tempDir, "*")
+
+			RunStore(storeCmd, []string{"abc006", tempDir})
+			restoreCmd := NewRestoreCommand()
+			restoreCmd.Flags().Set("record-manifest", "true")
+			RunRestore(restoreCmd, []string{"abc006"})
+			_ = readOutputFromFile(t)
+
+			skipCmd := NewStoreCommand()
+			skipCmd.Flags().Set("skip-unchanged", "true")
+			skipCmd.Flags().Set("overwrite", "true")
+			RunStore(skipCmd, []string{"abc006", tempDir})
+			output := readOutputFromFile(t)
+			assert.Contains(t, output, "did not change since it was restored using key 'abc006', skipping upload.")
+			assert.NotContains(t, output, "Upload complete")
+
+			ioutil.TempFile(tempDir, "*")
+			RunStore(skipCmd, []string{"abc006", tempDir})
+			output = readOutputFromFile(t)
+			assert.Contains(t, output, "Upload complete")
+		})
+
+		t.Run(fmt.Sprintf("%s uploads if no manifest was recorded on restore", backend), func(*testing.T) {
+			storage.Clear()
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			ioutil.TempFile(tempDir, "*")
+
+			RunStore(storeCmd, []string{"abc006", tempDir})
+			RunRestore(NewRestoreCommand(), []string{"abc006"})
+			_ = readOutputFromFile(t)
+
+			skipCmd := NewStoreCommand()
+			skipCmd.Flags().Set("skip-unchanged", "true")
+			skipCmd.Flags().Set("overwrite", "true")
+			RunStore(skipCmd, []string{"abc006", tempDir})
+			output := readOutputFromFile(t)
+			assert.NotContains(t, output, "skipping upload")
+			assert.Contains(t, output, "Upload complete")
+		})
+
+		t.Run(fmt.Sprintf("%s uploads key restored from a fallback key", backend), func(*testing.T) {
+			storage.Clear()
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			ioutil.TempFile(tempDir, "*")
+
+			RunStore(storeCmd, []string{"abc006", tempDir})
+			restoreCmd := NewRestoreCommand()
+			restoreCmd.Flags().Set("record-manifest", "true")
+			RunRestore(restoreCmd, []string{"abc007,abc006"})
+			_ = readOutputFromFile(t)
+
+			skipCmd := NewStoreCommand()
+			skipCmd.Flags().Set("skip-unchanged", "true")
+			RunStore(skipCmd, []string{"abc007", tempDir})
+			output := readOutputFromFile(t)
+			assert.NotContains(t, output, "skipping upload")
+			assert.Contains(t, output, "Upload complete")
+		})
+
+		t.Run(fmt.Sprintf("%s skips upload if another job is uploading the same key", backend), func(*testing.T) {
+			storage.Clear()
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			ioutil.TempFile(tempDir, "*")
+
+			acquired, err := storage.AcquireLock("abc008")
+			assert.Nil(t, err)
+			assert.True(t, acquired)
+
+			RunStore(storeCmd, []string{"abc008", tempDir})
+			output := readOutputFromFile(t)
+			assert.Contains(t, output, "Key 'abc008' is being uploaded by another job, skipping upload.")
+			assert.NotContains(t, output, "Upload complete")
+
+			assert.Nil(t, storage.ReleaseLock("abc008"))
+			RunStore(storeCmd, []string{"abc008", tempDir})
+			output = readOutputFromFile(t)
+			assert.Contains(t, output, "Upload complete")
+		})
+
+		t.Run(fmt.Sprintf("%s dry run does not upload anything", backend), func(*testing.T) {
+			storage.Clear()
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			ioutil.TempFile(tempDir, "*")
+
+			dryRunStoreCmd := NewStoreCommand()
+			dryRunStoreCmd.Flags().Set("dry-run", "true")
+			RunStore(dryRunStoreCmd, []string{"abc004", tempDir})
+			output := readOutputFromFile(t)
+
+			assert.Contains(t, output, fmt.Sprintf("[dry-run] Would compress and upload '%s' (local size: 0.0) with cache key 'abc004'.", tempDir))
+			assert.NotContains(t, output, "Upload complete")
+
+			ok, err := storage.HasKey("abc004")
+			assert.Nil(t, err)
+			assert.False(t, ok)
+		})
 	})
 }
 
@@ -141,7 +258,7 @@ func Test__AutomaticStore(t *testing.T) {
 
 			checksum, _ := files.GenerateChecksum("Gemfile.lock")
 
-			key := fmt.Sprintf("gems-some-development-branch-%s", checksum)
+			key := fmt.Sprintf("gems-some_-development_-branch-%s", checksum)
 			RunStore(storeCmd, []string{})
 			output := readOutputFromFile(t)
 
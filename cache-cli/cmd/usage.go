@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"strconv"
+
 	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
 	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
 	"github.com/semaphoreci/toolbox/cache-cli/pkg/utils"
@@ -19,12 +21,21 @@ var usageCmd = &cobra.Command{
 }
 
 func RunUsage(cmd *cobra.Command, args []string) {
-	storage, err := storage.InitStorage()
+	output := findOutputFormat(cmd)
+	scope := findScope(cmd)
+
+	storage, err := storage.InitStorageWithConfig(storage.StorageConfig{SortKeysBy: storage.SortByStoreTime, Scope: scope})
 	utils.Check(err)
 
 	summary, err := storage.Usage()
 	utils.Check(err)
 
+	if output != OutputText {
+		row := []string{strconv.FormatInt(summary.Free, 10), strconv.FormatInt(summary.Used, 10)}
+		writeOutput(cmd, output, summary, []string{"free", "used"}, [][]string{row})
+		return
+	}
+
 	if summary.Free == -1 {
 		log.Info("FREE SPACE: (unlimited)")
 	} else {
@@ -35,5 +46,7 @@ func RunUsage(cmd *cobra.Command, args []string) {
 }
 
 func init() {
+	addOutputFlag(usageCmd)
+	addScopeFlag(usageCmd, "Scope to summarize: project, org, or the name of a custom scope shared by all projects.")
 	RootCmd.AddCommand(usageCmd)
 }
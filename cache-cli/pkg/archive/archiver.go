@@ -6,17 +6,28 @@ import (
 	"github.com/semaphoreci/toolbox/cache-cli/pkg/metrics"
 )
 
+const (
+	MethodShellOut       = "shell-out"
+	MethodNative         = "native"
+	MethodNativeParallel = "native-parallel"
+)
+
 type Archiver interface {
 	Compress(dst, src string) error
 	Decompress(src string) (string, error)
+
+	// DecompressTo restores all the entries in the archive under dir,
+	// instead of where they were when the archive was created.
+	DecompressTo(src, dir string) (string, error)
+	Method() string
 }
 
 func NewArchiver(metricsManager metrics.MetricsManager) Archiver {
 	method := os.Getenv("SEMAPHORE_CACHE_ARCHIVE_METHOD")
 	switch method {
-	case "native":
+	case MethodNative:
 		return NewNativeArchiver(metricsManager, false)
-	case "native-parallel":
+	case MethodNativeParallel:
 		return NewNativeArchiver(metricsManager, true)
 	default:
 		return NewShellOutArchiver(metricsManager)
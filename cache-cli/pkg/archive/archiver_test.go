@@ -299,6 +299,124 @@ func Test__Decompress(t *testing.T) {
 	})
 }
 
+func Test__DecompressTo(t *testing.T) {
+	runTestForAllArchiverTypes(t, false, func(archiverType string, archiver Archiver) {
+		t.Run(archiverType+" re-roots absolute paths", func(t *testing.T) {
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			tempFile, _ := ioutil.TempFile(tempDir, "*")
+			_, _ = tempFile.WriteString("hello")
+			_ = tempFile.Close()
+
+			compressedFileName := tmpFileNameWithPrefix("abc0004")
+			assert.NoError(t, archiver.Compress(compressedFileName, tempDir))
+
+			destination, _ := ioutil.TempDir(os.TempDir(), "*")
+			unpackedAt, err := archiver.DecompressTo(compressedFileName, destination)
+			assert.Nil(t, err)
+
+			expected := filepath.Join(destination, tempDir[len(filepath.VolumeName(tempDir)):]) + string(os.PathSeparator)
+			assert.Equal(t, expected, unpackedAt)
+
+			content, err := ioutil.ReadFile(filepath.Join(unpackedAt, filepath.Base(tempFile.Name())))
+			assert.Nil(t, err)
+			assert.Equal(t, "hello", string(content))
+
+			// the original files are left alone
+			content, err = ioutil.ReadFile(tempFile.Name())
+			assert.Nil(t, err)
+			assert.Equal(t, "hello", string(content))
+
+			assert.NoError(t, os.RemoveAll(tempDir))
+			assert.NoError(t, os.RemoveAll(destination))
+			assert.NoError(t, os.Remove(compressedFileName))
+		})
+
+		t.Run(archiverType+" re-roots absolute symlinks into the archived path", func(t *testing.T) {
+			tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			outsideDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			target := filepath.Join(tempDir, "target.txt")
+			_ = ioutil.WriteFile(target, []byte("hello"), 0600)
+			assert.NoError(t, os.Symlink(target, filepath.Join(tempDir, "inside")))
+			assert.NoError(t, os.Symlink(outsideDir, filepath.Join(tempDir, "outside")))
+			assert.NoError(t, os.Symlink("target.txt", filepath.Join(tempDir, "relative")))
+
+			compressedFileName := tmpFileNameWithPrefix("abc0006")
+			assert.NoError(t, archiver.Compress(compressedFileName, tempDir))
+
+			destination, _ := ioutil.TempDir(os.TempDir(), "*")
+			unpackedAt, err := archiver.DecompressTo(compressedFileName, destination)
+			assert.Nil(t, err)
+
+			linkname, err := os.Readlink(filepath.Join(unpackedAt, "inside"))
+			assert.Nil(t, err)
+			assert.Equal(t, filepath.Join(unpackedAt, "target.txt"), linkname)
+
+			linkname, err = os.Readlink(filepath.Join(unpackedAt, "outside"))
+			assert.Nil(t, err)
+			assert.Equal(t, outsideDir, linkname)
+
+			linkname, err = os.Readlink(filepath.Join(unpackedAt, "relative"))
+			assert.Nil(t, err)
+			assert.Equal(t, "target.txt", linkname)
+
+			assert.NoError(t, os.RemoveAll(tempDir))
+			assert.NoError(t, os.RemoveAll(outsideDir))
+			assert.NoError(t, os.RemoveAll(destination))
+			assert.NoError(t, os.Remove(compressedFileName))
+		})
+
+		t.Run(archiverType+" re-roots relative paths and creates the destination", func(t *testing.T) {
+			cwd, _ := os.Getwd()
+			tempDir, _ := ioutil.TempDir(cwd, "*")
+			tempFile, _ := ioutil.TempFile(tempDir, "*")
+			_ = tempFile.Close()
+			tempDirBase := filepath.Base(tempDir)
+
+			compressedFileName := tmpFileNameWithPrefix("abc0005")
+			assert.NoError(t, archiver.Compress(compressedFileName, tempDirBase))
+			assert.NoError(t, os.RemoveAll(tempDir))
+
+			parent, _ := ioutil.TempDir(os.TempDir(), "*")
+			destination := filepath.Join(parent, "checkout")
+			unpackedAt, err := archiver.DecompressTo(compressedFileName, destination)
+			assert.Nil(t, err)
+			assert.Equal(t, filepath.Join(destination, tempDirBase)+string(os.PathSeparator), unpackedAt)
+			assert.FileExists(t, filepath.Join(unpackedAt, filepath.Base(tempFile.Name())))
+			assert.NoDirExists(t, tempDir)
+
+			assert.NoError(t, os.RemoveAll(parent))
+			assert.NoError(t, os.Remove(compressedFileName))
+		})
+	})
+}
+
+func Test__RerootPath(t *testing.T) {
+	destination := filepath.Join(os.TempDir(), "destination")
+
+	t.Run("without directory", func(t *testing.T) {
+		path, err := rerootPath("", "vendor/bundle/")
+		assert.Nil(t, err)
+		assert.Equal(t, "vendor/bundle/", path)
+	})
+
+	t.Run("relative path", func(t *testing.T) {
+		path, err := rerootPath(destination, "vendor/bundle/")
+		assert.Nil(t, err)
+		assert.Equal(t, filepath.Join(destination, "vendor", "bundle")+string(os.PathSeparator), path)
+	})
+
+	t.Run("absolute path", func(t *testing.T) {
+		path, err := rerootPath(destination, "/home/semaphore/.nvm/nvm.sh")
+		assert.Nil(t, err)
+		assert.Equal(t, filepath.Join(destination, "home", "semaphore", ".nvm", "nvm.sh"), path)
+	})
+
+	t.Run("path outside of directory", func(t *testing.T) {
+		_, err := rerootPath(destination, "../../etc/passwd")
+		assert.NotNil(t, err)
+	})
+}
+
 func tmpFileNameWithPrefix(prefix string) string {
 	return filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", prefix, time.Now().Nanosecond()))
 }
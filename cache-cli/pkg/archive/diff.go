@@ -0,0 +1,129 @@
+package archive
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	DiffOnlyInArchive = "only in archive"
+	DiffOnlyLocally   = "only locally"
+	DiffType          = "type differs"
+	DiffSize          = "size differs"
+	DiffLink          = "link differs"
+)
+
+type Difference struct {
+	Path    string
+	Kind    string
+	Details string
+}
+
+// Compares the archive entries with a local directory.
+// The first entry in the archive is the path that was archived,
+// so the paths of all entries are made relative to it before being compared.
+func Diff(entries []Entry, dir string) ([]Difference, error) {
+	archived := map[string]Entry{}
+	if len(entries) > 0 {
+		root := entryPath(entries[0].Name)
+		for _, entry := range entries {
+			relative, err := filepath.Rel(root, entryPath(entry.Name))
+			if err != nil || strings.HasPrefix(relative, "..") {
+				relative = entryPath(entry.Name)
+			}
+
+			archived[relative] = entry
+		}
+	}
+
+	local := map[string]Entry{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		entry := Entry{Name: path, Type: localEntryType(info.Mode()), Size: info.Size(), Mode: info.Mode()}
+		if entry.Type == EntryTypeSymlink {
+			entry.Linkname, _ = os.Readlink(path)
+		}
+
+		local[relative] = entry
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading '%s': %v", dir, err)
+	}
+
+	differences := []Difference{}
+	for path, archivedEntry := range archived {
+		localEntry, ok := local[path]
+		if !ok {
+			differences = append(differences, Difference{Path: path, Kind: DiffOnlyInArchive})
+			continue
+		}
+
+		if difference := compareEntries(path, archivedEntry, localEntry); difference != nil {
+			differences = append(differences, *difference)
+		}
+	}
+
+	for path := range local {
+		if _, ok := archived[path]; !ok {
+			differences = append(differences, Difference{Path: path, Kind: DiffOnlyLocally})
+		}
+	}
+
+	sort.SliceStable(differences, func(i, j int) bool {
+		return differences[i].Path < differences[j].Path
+	})
+
+	return differences, nil
+}
+
+func compareEntries(path string, archived, local Entry) *Difference {
+	if archived.Type != local.Type {
+		return &Difference{Path: path, Kind: DiffType, Details: fmt.Sprintf("%s in archive, %s locally", archived.Type, local.Type)}
+	}
+
+	if archived.Type == EntryTypeFile && archived.Size != local.Size {
+		return &Difference{Path: path, Kind: DiffSize, Details: fmt.Sprintf("%d bytes in archive, %d bytes locally", archived.Size, local.Size)}
+	}
+
+	if archived.Type == EntryTypeSymlink && archived.Linkname != local.Linkname {
+		return &Difference{Path: path, Kind: DiffLink, Details: fmt.Sprintf("'%s' in archive, '%s' locally", archived.Linkname, local.Linkname)}
+	}
+
+	return nil
+}
+
+func entryPath(name string) string {
+	return filepath.Clean(filepath.FromSlash(name))
+}
+
+func localEntryType(mode fs.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return EntryTypeFile
+	case mode.IsDir():
+		return EntryTypeDir
+	case mode&fs.ModeSymlink != 0:
+		return EntryTypeSymlink
+	default:
+		return EntryTypeOther
+	}
+}
@@ -0,0 +1,117 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+const (
+	EntryTypeFile    = "file"
+	EntryTypeDir     = "dir"
+	EntryTypeSymlink = "symlink"
+	EntryTypeOther   = "other"
+)
+
+type Entry struct {
+	Name     string
+	Type     string
+	Size     int64
+	Mode     fs.FileMode
+	ModTime  time.Time
+	Linkname string
+}
+
+type Format struct {
+	Archive     string
+	Compression string
+}
+
+// Both archivers produce gzipped tar archives,
+// but we look at the magic bytes to be able to tell if something else was stored.
+func DetectFormat(src string) (*Format, error) {
+	// #nosec
+	file, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("error opening '%s': %v", src, err)
+	}
+
+	defer file.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("error reading '%s': %v", src, err)
+	}
+
+	header = header[:n]
+	switch {
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return &Format{Archive: "tar", Compression: "gzip"}, nil
+	case bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return &Format{Archive: "tar", Compression: "zstd"}, nil
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		return &Format{Archive: "tar", Compression: "none"}, nil
+	default:
+		return &Format{Archive: "unknown", Compression: "unknown"}, nil
+	}
+}
+
+// Entries reads the archive headers, without extracting anything.
+func (a *NativeArchiver) Entries(src string) ([]Entry, error) {
+	// #nosec
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("error opening '%s': %v", src, err)
+	}
+
+	defer srcFile.Close()
+
+	uncompressedStream, err := a.newGzipReader(srcFile)
+	if err != nil {
+		return nil, fmt.Errorf("error creating gzip reader: %v", err)
+	}
+
+	defer uncompressedStream.Close()
+
+	entries := []Entry{}
+	tarReader := tar.NewReader(uncompressedStream)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error reading tar stream: %v", err)
+		}
+
+		entries = append(entries, Entry{
+			Name:     header.Name,
+			Type:     entryType(header.Typeflag),
+			Size:     header.Size,
+			Mode:     header.FileInfo().Mode(),
+			ModTime:  header.ModTime,
+			Linkname: header.Linkname,
+		})
+	}
+
+	return entries, nil
+}
+
+func entryType(typeflag byte) string {
+	switch typeflag {
+	case tar.TypeReg:
+		return EntryTypeFile
+	case tar.TypeDir:
+		return EntryTypeDir
+	case tar.TypeSymlink:
+		return EntryTypeSymlink
+	default:
+		return EntryTypeOther
+	}
+}
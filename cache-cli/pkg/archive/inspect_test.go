@@ -0,0 +1,93 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/metrics"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__Inspect(t *testing.T) {
+	runTestForAllArchiverTypes(t, false, func(archiverType string, archiver Archiver) {
+		tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+		_ = os.MkdirAll(filepath.Join(tempDir, "sub"), 0755)
+		_ = ioutil.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("hello"), 0600)
+		_ = ioutil.WriteFile(filepath.Join(tempDir, "sub", "b.txt"), []byte("hello world"), 0600)
+		_ = os.Symlink("a.txt", filepath.Join(tempDir, "link"))
+
+		compressedFile := tmpFileNameWithPrefix("abc0007")
+		assert.Nil(t, archiver.Compress(compressedFile, tempDir))
+
+		native := NewNativeArchiver(metrics.NewNoOpMetricsManager(), false)
+
+		t.Run(archiverType+" detects format", func(t *testing.T) {
+			format, err := DetectFormat(compressedFile)
+			assert.Nil(t, err)
+			assert.Equal(t, &Format{Archive: "tar", Compression: "gzip"}, format)
+		})
+
+		t.Run(archiverType+" lists entries", func(t *testing.T) {
+			entries, err := native.Entries(compressedFile)
+			assert.Nil(t, err)
+			if assert.Len(t, entries, 5) {
+				assert.Equal(t, EntryTypeDir, entries[0].Type)
+			}
+
+			found := map[string]Entry{}
+			for _, entry := range entries {
+				found[filepath.Base(entryPath(entry.Name))] = entry
+			}
+
+			assert.Equal(t, EntryTypeFile, found["a.txt"].Type)
+			assert.Equal(t, int64(5), found["a.txt"].Size)
+			assert.Equal(t, int64(11), found["b.txt"].Size)
+			assert.Equal(t, EntryTypeSymlink, found["link"].Type)
+			assert.Equal(t, "a.txt", found["link"].Linkname)
+		})
+
+		t.Run(archiverType+" no differences with the same directory", func(t *testing.T) {
+			entries, _ := native.Entries(compressedFile)
+			differences, err := Diff(entries, tempDir)
+			assert.Nil(t, err)
+			assert.Empty(t, differences)
+		})
+
+		t.Run(archiverType+" finds differences", func(t *testing.T) {
+			entries, _ := native.Entries(compressedFile)
+
+			otherDir, _ := ioutil.TempDir(os.TempDir(), "*")
+			_ = os.MkdirAll(filepath.Join(otherDir, "sub"), 0755)
+			_ = ioutil.WriteFile(filepath.Join(otherDir, "a.txt"), []byte("hello!"), 0600)
+			_ = ioutil.WriteFile(filepath.Join(otherDir, "c.txt"), []byte(""), 0600)
+			_ = os.MkdirAll(filepath.Join(otherDir, "link"), 0755)
+
+			differences, err := Diff(entries, otherDir)
+			assert.Nil(t, err)
+			assert.Equal(t, []Difference{
+				{Path: "a.txt", Kind: DiffSize, Details: "5 bytes in archive, 6 bytes locally"},
+				{Path: "c.txt", Kind: DiffOnlyLocally},
+				{Path: "link", Kind: DiffType, Details: "symlink in archive, dir locally"},
+				{Path: filepath.Join("sub", "b.txt"), Kind: DiffOnlyInArchive},
+			}, differences)
+
+			os.RemoveAll(otherDir)
+		})
+
+		os.Remove(compressedFile)
+		os.RemoveAll(tempDir)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		tempFile, _ := ioutil.TempFile(os.TempDir(), "*")
+		_, _ = tempFile.WriteString("not an archive")
+		_ = tempFile.Close()
+
+		format, err := DetectFormat(tempFile.Name())
+		assert.Nil(t, err)
+		assert.Equal(t, "unknown", format.Archive)
+		os.Remove(tempFile.Name())
+	})
+}
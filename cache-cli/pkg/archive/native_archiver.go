@@ -12,6 +12,7 @@ import (
 	"time"
 
 	pgzip "github.com/klauspost/pgzip"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
 	"github.com/semaphoreci/toolbox/cache-cli/pkg/metrics"
 	log "github.com/sirupsen/logrus"
 )
@@ -28,6 +29,14 @@ func NewNativeArchiver(metricsManager metrics.MetricsManager, useParallelism boo
 	}
 }
 
+func (a *NativeArchiver) Method() string {
+	if a.UseParallelism {
+		return MethodNativeParallel
+	}
+
+	return MethodNative
+}
+
 func (a *NativeArchiver) Compress(dst, src string) error {
 	if _, err := os.Stat(src); err != nil {
 		return fmt.Errorf("error finding '%s': %v", src, err)
@@ -43,6 +52,11 @@ func (a *NativeArchiver) Compress(dst, src string) error {
 	gzipWriter := a.newGzipWriter(dstFile)
 	tarWriter := tar.NewWriter(gzipWriter)
 
+	progress, stopProgress := compressProgress(src)
+	defer stopProgress()
+
+	roots := currentPathRoots()
+
 	// We walk through every file in the specified path, adding them to the tar archive.
 	err = filepath.Walk(src, func(fileName string, fileInfo os.FileInfo, e error) error {
 		var link string
@@ -60,11 +74,7 @@ func (a *NativeArchiver) Compress(dst, src string) error {
 		// Truncate time to seconds only
 		header.ModTime = header.ModTime.Truncate(time.Second)
 
-		if fileInfo.IsDir() {
-			header.Name = fileName + string(os.PathSeparator)
-		} else {
-			header.Name = fileName
-		}
+		roots.normalizeHeader(header, fileName, fileInfo.IsDir())
 
 		if err := tarWriter.WriteHeader(header); err != nil {
 			return fmt.Errorf("error writing tar header: %v", err)
@@ -82,7 +92,7 @@ func (a *NativeArchiver) Compress(dst, src string) error {
 			return fmt.Errorf("error opening file '%s': %v", fileName, err)
 		}
 
-		if _, err := io.Copy(tarWriter, file); err != nil {
+		if _, err := io.Copy(tarWriter, files.NewProgressReader(file, progress)); err != nil {
 			return fmt.Errorf("error writing file '%s' to tar archive: %v", fileName, err)
 		}
 
@@ -116,6 +126,10 @@ type directoryStat struct {
 }
 
 func (a *NativeArchiver) Decompress(src string) (string, error) {
+	return a.DecompressTo(src, "")
+}
+
+func (a *NativeArchiver) DecompressTo(src, dir string) (string, error) {
 	// #nosec
 	srcFile, err := os.Open(src)
 	if err != nil {
@@ -124,7 +138,16 @@ func (a *NativeArchiver) Decompress(src string) (string, error) {
 
 	defer srcFile.Close()
 
-	uncompressedStream, err := a.newGzipReader(srcFile)
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("error creating directory '%s': %v", dir, err)
+		}
+	}
+
+	progress := unpackProgress(srcFile)
+	defer progress.Finish()
+
+	uncompressedStream, err := a.newGzipReader(files.NewProgressReader(srcFile, progress))
 	if err != nil {
 		log.Errorf("error creating gzip reader: %v", err)
 		a.publishCorruptionMetric()
@@ -134,8 +157,10 @@ func (a *NativeArchiver) Decompress(src string) (string, error) {
 	defer uncompressedStream.Close()
 
 	i := 0
+	roots := currentPathRoots()
 	tarReader := tar.NewReader(uncompressedStream)
 	restorationPath := ""
+	archivedPath := ""
 	hadError := false
 	delayedDirectoryStats := []directoryStat{}
 
@@ -155,6 +180,21 @@ func (a *NativeArchiver) Decompress(src string) (string, error) {
 			return "", fmt.Errorf("error reading tar stream: %v", err)
 		}
 
+		err = roots.resolveHeader(header)
+		if err == nil && i == 0 {
+			archivedPath = header.Name
+		}
+
+		if err == nil {
+			header.Name, err = rerootPath(dir, header.Name)
+		}
+
+		if err != nil {
+			log.Errorf("Error restoring archive entry: %v", err)
+			hadError = true
+			continue
+		}
+
 		// If it's the first file in archive, we keep track of its name.
 		if i == 0 {
 			restorationPath = header.Name
@@ -192,6 +232,7 @@ func (a *NativeArchiver) Decompress(src string) (string, error) {
 				_ = os.Remove(header.Name)
 			}
 
+			header.Linkname = rerootLink(dir, archivedPath, header.Linkname)
 			if err := os.Symlink(header.Linkname, header.Name); err != nil {
 				log.Errorf("Error creating symlink '%s'-'%s': %v", header.Name, header.Linkname, err)
 				hadError = true
@@ -286,12 +327,12 @@ func (a *NativeArchiver) newGzipWriter(dstFile *os.File) io.WriteCloser {
 	return gzip.NewWriter(dstFile)
 }
 
-func (a *NativeArchiver) newGzipReader(dstFile *os.File) (io.ReadCloser, error) {
+func (a *NativeArchiver) newGzipReader(reader io.Reader) (io.ReadCloser, error) {
 	if a.UseParallelism {
-		return pgzip.NewReader(dstFile)
+		return pgzip.NewReader(reader)
 	}
 
-	return gzip.NewReader(dstFile)
+	return gzip.NewReader(reader)
 }
 
 func (a *NativeArchiver) publishCorruptionMetric() {
@@ -0,0 +1,223 @@
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Absolute paths under well-known roots are also recorded relative to them,
+// so they can be restored on agents where those roots are somewhere else.
+// PAX records are used for that, since other tar implementations ignore them,
+// and keep using the original absolute paths.
+const (
+	paxRootRecord     = "SEMAPHORE.cache.root"
+	paxPathRecord     = "SEMAPHORE.cache.path"
+	paxLinkRootRecord = "SEMAPHORE.cache.linkroot"
+	paxLinkPathRecord = "SEMAPHORE.cache.linkpath"
+
+	RootHome             = "home"
+	RootWorkingDirectory = "cwd"
+)
+
+type pathRoots struct {
+	Home             string
+	WorkingDirectory string
+}
+
+func currentPathRoots() pathRoots {
+	home, _ := os.UserHomeDir()
+	cwd, _ := os.Getwd()
+	return pathRoots{Home: home, WorkingDirectory: cwd}
+}
+
+func (r pathRoots) dir(root string) string {
+	switch root {
+	case RootHome:
+		return r.Home
+	case RootWorkingDirectory:
+		return r.WorkingDirectory
+	default:
+		return ""
+	}
+}
+
+// Finds the most specific root the absolute path is under,
+// and returns the path relative to it, using forward slashes.
+// A root that is the filesystem root itself, like a job running from '/',
+// would match every absolute path, so it is never used.
+func (r pathRoots) relativize(path string) (string, string, bool) {
+	if !filepath.IsAbs(path) {
+		return "", "", false
+	}
+
+	bestRoot, bestDir, bestRelative := "", "", ""
+	for _, root := range []string{RootHome, RootWorkingDirectory} {
+		dir := r.dir(root)
+		if dir == "" || !filepath.IsAbs(dir) || filepath.Dir(dir) == dir {
+			continue
+		}
+
+		relative, err := filepath.Rel(dir, path)
+		if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(os.PathSeparator)) {
+			continue
+		}
+
+		if len(dir) > len(bestDir) {
+			bestRoot, bestDir, bestRelative = root, dir, relative
+		}
+	}
+
+	if bestRoot == "" {
+		return "", "", false
+	}
+
+	return bestRoot, filepath.ToSlash(bestRelative), true
+}
+
+func (r pathRoots) resolve(root, relative string) (string, error) {
+	dir := r.dir(root)
+	if dir == "" {
+		return "", fmt.Errorf("unknown location for root '%s'", root)
+	}
+
+	path := filepath.Join(dir, filepath.FromSlash(relative))
+	if strings.HasSuffix(relative, "/") {
+		path += string(os.PathSeparator)
+	}
+
+	return path, nil
+}
+
+// Names are always archived with forward slashes,
+// and absolute paths under the roots are also recorded relative to them.
+func (r pathRoots) normalizeHeader(header *tar.Header, fileName string, isDir bool) {
+	header.Name = filepath.ToSlash(fileName)
+	suffix := ""
+	if isDir {
+		suffix = "/"
+		header.Name += suffix
+	}
+
+	records := map[string]string{}
+	if root, relative, ok := r.relativize(fileName); ok {
+		records[paxRootRecord] = root
+		records[paxPathRecord] = relative + suffix
+	}
+
+	if header.Linkname != "" {
+		if root, relative, ok := r.relativize(header.Linkname); ok {
+			records[paxLinkRootRecord] = root
+			records[paxLinkPathRecord] = relative
+		}
+
+		header.Linkname = filepath.ToSlash(header.Linkname)
+	}
+
+	if len(records) > 0 && header.PAXRecords == nil {
+		header.PAXRecords = map[string]string{}
+	}
+
+	for key, value := range records {
+		header.PAXRecords[key] = value
+	}
+}
+
+func isNormalized(header *tar.Header) bool {
+	_, ok := header.PAXRecords[paxRootRecord]
+	return ok
+}
+
+// Resolves the paths recorded by normalizeHeader for the current agent.
+// Archives created before paths were normalized are restored as they were.
+func (r pathRoots) resolveHeader(header *tar.Header) error {
+	header.Name = filepath.FromSlash(header.Name)
+	if root, ok := header.PAXRecords[paxRootRecord]; ok {
+		name, err := r.resolve(root, header.PAXRecords[paxPathRecord])
+		if err != nil {
+			return fmt.Errorf("error resolving '%s': %v", header.Name, err)
+		}
+
+		header.Name = name
+	}
+
+	if header.Linkname == "" {
+		return nil
+	}
+
+	header.Linkname = filepath.FromSlash(header.Linkname)
+	if root, ok := header.PAXRecords[paxLinkRootRecord]; ok {
+		linkname, err := r.resolve(root, header.PAXRecords[paxLinkPathRecord])
+		if err != nil {
+			return fmt.Errorf("error resolving link target for '%s': %v", header.Name, err)
+		}
+
+		header.Linkname = linkname
+	}
+
+	return nil
+}
+
+// Used by archivers that let tar walk the files, to normalize the entries it archived.
+// Entries are written in the same order, and without their own format,
+// so the writer picks one that can hold the records.
+func (r pathRoots) normalizeStream(reader *tar.Reader, writer *tar.Writer) error {
+	return copyStream(reader, writer, func(header *tar.Header) error {
+		name := filepath.FromSlash(strings.TrimSuffix(header.Name, "/"))
+		r.normalizeHeader(header, name, header.Typeflag == tar.TypeDir)
+		return nil
+	})
+}
+
+// Used by archivers that let tar unpack the files, to resolve the entries before tar sees them.
+// When restoring into dir, symlinks into the archived path are re-rooted too, since tar only re-roots names.
+// The records are removed, since other tar implementations complain about unknown ones.
+func (r pathRoots) resolveStream(reader *tar.Reader, writer *tar.Writer, dir, archivedPath string) error {
+	return copyStream(reader, writer, func(header *tar.Header) error {
+		if err := r.resolveHeader(header); err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeSymlink {
+			header.Linkname = rerootLink(dir, archivedPath, header.Linkname)
+		}
+
+		header.Name = filepath.ToSlash(header.Name)
+		header.Linkname = filepath.ToSlash(header.Linkname)
+		for _, record := range []string{paxRootRecord, paxPathRecord, paxLinkRootRecord, paxLinkPathRecord} {
+			delete(header.PAXRecords, record)
+		}
+
+		return nil
+	})
+}
+
+func copyStream(reader *tar.Reader, writer *tar.Writer, rewrite func(header *tar.Header) error) error {
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return writer.Close()
+		}
+
+		if err != nil {
+			return fmt.Errorf("error reading tar stream: %v", err)
+		}
+
+		if err := rewrite(header); err != nil {
+			return err
+		}
+
+		header.Format = tar.FormatUnknown
+		if err := writer.WriteHeader(header); err != nil {
+			return fmt.Errorf("error writing tar header for '%s': %v", header.Name, err)
+		}
+
+		// #nosec
+		if _, err := io.Copy(writer, reader); err != nil {
+			return fmt.Errorf("error copying '%s': %v", header.Name, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package archive
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/metrics"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__PathRoots(t *testing.T) {
+	home := filepath.Join(os.TempDir(), "home", "semaphore")
+	roots := pathRoots{Home: home, WorkingDirectory: filepath.Join(home, "project")}
+
+	t.Run("relative paths are kept", func(t *testing.T) {
+		_, _, ok := roots.relativize(filepath.Join("vendor", "bundle"))
+		assert.False(t, ok)
+	})
+
+	t.Run("paths outside of roots are kept", func(t *testing.T) {
+		_, _, ok := roots.relativize(filepath.Join(os.TempDir(), "other"))
+		assert.False(t, ok)
+	})
+
+	t.Run("filesystem root is never a root", func(t *testing.T) {
+		rootDir := filepath.VolumeName(os.TempDir()) + string(os.PathSeparator)
+		_, _, ok := pathRoots{Home: home, WorkingDirectory: rootDir}.relativize(filepath.Join(rootDir, "opt", "tool"))
+		assert.False(t, ok)
+	})
+
+	t.Run("paths under home", func(t *testing.T) {
+		root, relative, ok := roots.relativize(filepath.Join(home, ".nvm", "nvm.sh"))
+		assert.True(t, ok)
+		assert.Equal(t, RootHome, root)
+		assert.Equal(t, ".nvm/nvm.sh", relative)
+	})
+
+	t.Run("most specific root is used", func(t *testing.T) {
+		root, relative, ok := roots.relativize(filepath.Join(home, "project", "vendor"))
+		assert.True(t, ok)
+		assert.Equal(t, RootWorkingDirectory, root)
+		assert.Equal(t, "vendor", relative)
+	})
+
+	t.Run("headers are resolved using the current roots", func(t *testing.T) {
+		header := &tar.Header{Typeflag: tar.TypeSymlink, Linkname: filepath.Join(home, ".nvm", "versions", "v20")}
+		roots.normalizeHeader(header, filepath.Join(home, ".nvm", "current"), false)
+		assert.Equal(t, map[string]string{
+			paxRootRecord:     RootHome,
+			paxPathRecord:     ".nvm/current",
+			paxLinkRootRecord: RootHome,
+			paxLinkPathRecord: ".nvm/versions/v20",
+		}, header.PAXRecords)
+
+		otherHome := filepath.Join(os.TempDir(), "home", "runner")
+		otherRoots := pathRoots{Home: otherHome, WorkingDirectory: filepath.Join(otherHome, "work")}
+		assert.NoError(t, otherRoots.resolveHeader(header))
+		assert.Equal(t, filepath.Join(otherHome, ".nvm", "current"), header.Name)
+		assert.Equal(t, filepath.Join(otherHome, ".nvm", "versions", "v20"), header.Linkname)
+	})
+
+	t.Run("directories keep their trailing separator", func(t *testing.T) {
+		header := &tar.Header{Typeflag: tar.TypeDir}
+		roots.normalizeHeader(header, filepath.Join(home, ".nvm"), true)
+		assert.Equal(t, ".nvm/", header.PAXRecords[paxPathRecord])
+
+		assert.NoError(t, roots.resolveHeader(header))
+		assert.Equal(t, filepath.Join(home, ".nvm")+string(os.PathSeparator), header.Name)
+	})
+
+	t.Run("unknown root", func(t *testing.T) {
+		header := &tar.Header{Name: "x", PAXRecords: map[string]string{paxRootRecord: "nope", paxPathRecord: "x"}}
+		assert.NotNil(t, roots.resolveHeader(header))
+	})
+}
+
+func Test__ArchiversRestoreUnderCurrentHome(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	originalHome := os.Getenv("HOME")
+	defer os.Setenv("HOME", originalHome)
+
+	metricsManager := metrics.NewNoOpMetricsManager()
+	archivers := []Archiver{
+		NewShellOutArchiver(metricsManager),
+		NewNativeArchiver(metricsManager, false),
+		NewNativeArchiver(metricsManager, true),
+	}
+
+	// Archives created by one archiver should be restored the same way by any other.
+	for _, compressing := range archivers {
+		for _, decompressing := range archivers {
+			t.Run(compressing.Method()+" to "+decompressing.Method(), func(t *testing.T) {
+				storeHome, _ := ioutil.TempDir(os.TempDir(), "*")
+				restoreHome, _ := ioutil.TempDir(os.TempDir(), "*")
+				cacheDir := filepath.Join(storeHome, ".nvm")
+				assert.NoError(t, os.MkdirAll(cacheDir, 0755))
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(cacheDir, "nvm.sh"), []byte("hello"), 0644))
+				assert.NoError(t, os.Symlink(filepath.Join(cacheDir, "nvm.sh"), filepath.Join(cacheDir, "current")))
+
+				os.Setenv("HOME", storeHome)
+				compressedFileName := tmpFileNameWithPrefix("abc0006")
+				assert.NoError(t, compressing.Compress(compressedFileName, cacheDir))
+
+				os.Setenv("HOME", restoreHome)
+				unpackedAt, err := decompressing.Decompress(compressedFileName)
+				assert.Nil(t, err)
+				assert.Equal(t, filepath.Join(restoreHome, ".nvm")+string(os.PathSeparator), unpackedAt)
+
+				content, err := ioutil.ReadFile(filepath.Join(restoreHome, ".nvm", "nvm.sh"))
+				assert.Nil(t, err)
+				assert.Equal(t, "hello", string(content))
+
+				target, err := os.Readlink(filepath.Join(restoreHome, ".nvm", "current"))
+				assert.Nil(t, err)
+				assert.Equal(t, filepath.Join(restoreHome, ".nvm", "nvm.sh"), target)
+
+				assert.NoError(t, os.RemoveAll(storeHome))
+				assert.NoError(t, os.RemoveAll(restoreHome))
+				assert.NoError(t, os.Remove(compressedFileName))
+			})
+		}
+	}
+}
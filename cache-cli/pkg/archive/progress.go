@@ -0,0 +1,71 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
+)
+
+// Reports the uncompressed bytes that went into the archive.
+// Finding the total means walking the whole tree a second time, so that is only done
+// if progress is enabled, and compression takes long enough for progress to be reported.
+// The returned function stops reporting progress.
+func compressProgress(src string) (*files.Progress, func()) {
+	progress := files.NewProgress(fmt.Sprintf("Compressing '%s'", src), -1)
+	if progress == nil {
+		return nil, func() {}
+	}
+
+	timer := time.AfterFunc(progress.Interval, func() {
+		if total, err := files.PathSize(src); err == nil {
+			progress.SetTotal(total)
+		}
+	})
+
+	return progress, func() {
+		timer.Stop()
+		progress.Finish()
+	}
+}
+
+// Reports the compressed bytes read from the archive.
+func unpackProgress(file *os.File) *files.Progress {
+	total := int64(-1)
+	if info, err := file.Stat(); err == nil {
+		total = info.Size()
+	}
+
+	return files.NewProgress(fmt.Sprintf("Unpacking '%s'", file.Name()), total)
+}
+
+// When compression happens in another process, we can only watch the archive grow.
+// The returned function stops watching it.
+func watchFileSize(path string, progress *files.Progress) func() {
+	if progress == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(progress.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if info, err := os.Stat(path); err == nil {
+					progress.Set(info.Size())
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		progress.Finish()
+	}
+}
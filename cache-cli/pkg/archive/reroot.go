@@ -0,0 +1,62 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Returns where an archive entry is restored, when restoring into dir.
+// Absolute paths, including their volume names, become relative to dir,
+// and entries that would end up outside of it are rejected.
+// If dir is empty, the entry is restored where it was when it was archived.
+func rerootPath(dir, name string) (string, error) {
+	if dir == "" {
+		return name, nil
+	}
+
+	relative := filepath.ToSlash(name[len(filepath.VolumeName(name)):])
+	relative = strings.TrimLeft(relative, "/")
+	path := filepath.Join(dir, filepath.FromSlash(relative))
+
+	rel, err := filepath.Rel(filepath.Clean(dir), path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("'%s' is outside of '%s'", name, dir)
+	}
+
+	// Directories are archived with a trailing separator, and we keep it.
+	if strings.HasSuffix(relative, "/") && relative != "/" {
+		path += string(os.PathSeparator)
+	}
+
+	return path, nil
+}
+
+// Returns where a symlink points to, when restoring into dir.
+// Absolute targets inside of the archived path are re-rooted like the entries themselves,
+// so restored links point at the restored files, and not at the original location.
+// Relative targets, and targets outside of the archived path, are kept.
+func rerootLink(dir, archivedPath, linkname string) string {
+	if dir == "" || !filepath.IsAbs(archivedPath) || !filepath.IsAbs(linkname) {
+		return linkname
+	}
+
+	rel, err := filepath.Rel(filepath.Clean(archivedPath), linkname)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return linkname
+	}
+
+	// Links are resolved relative to their own directory, so the target needs to be absolute.
+	absoluteDir, err := filepath.Abs(dir)
+	if err != nil {
+		return linkname
+	}
+
+	path, err := rerootPath(absoluteDir, linkname)
+	if err != nil {
+		return linkname
+	}
+
+	return path
+}
@@ -2,6 +2,7 @@ package archive
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"os/exec"
 	"path/filepath"
 
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
 	"github.com/semaphoreci/toolbox/cache-cli/pkg/metrics"
 	log "github.com/sirupsen/logrus"
 )
@@ -21,11 +23,24 @@ func NewShellOutArchiver(metricsManager metrics.MetricsManager) *ShellOutArchive
 	return &ShellOutArchiver{metricsManager: metricsManager}
 }
 
+func (a *ShellOutArchiver) Method() string {
+	return MethodShellOut
+}
+
 func (a *ShellOutArchiver) Compress(dst, src string) error {
 	if _, err := os.Stat(src); err != nil {
 		return fmt.Errorf("error finding '%s': %v", src, err)
 	}
 
+	// The archive size is only known when tar finishes, so we only report the compressed bytes written so far.
+	stopWatching := watchFileSize(dst, files.NewProgress(fmt.Sprintf("Compressing '%s'", src), -1))
+	defer stopWatching()
+
+	roots := currentPathRoots()
+	if _, _, ok := roots.relativize(src); ok {
+		return a.compressNormalized(dst, src, roots)
+	}
+
 	cmd := a.compressionCommand(dst, src)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -35,8 +50,80 @@ func (a *ShellOutArchiver) Compress(dst, src string) error {
 	return nil
 }
 
+// Paths under one of the roots are normalized the same way NativeArchiver does it,
+// so the archive can be restored by either archiver, on agents where the roots are somewhere else.
+// tar still walks the files, and gzip still compresses them, each in its own process,
+// and we only rewrite the headers of the uncompressed stream going from one to the other.
+// Paths that don't need to be rewritten are archived by tar alone, in Compress.
+func (a *ShellOutArchiver) compressNormalized(dst, src string, roots pathRoots) error {
+	// #nosec
+	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.FileMode(0644))
+	if err != nil {
+		return err
+	}
+
+	defer dstFile.Close()
+
+	// #nosec
+	tarCmd := exec.Command("tar", "cPf", "-", src)
+	var tarStderr bytes.Buffer
+	tarCmd.Stderr = &tarStderr
+	tarOutput, err := tarCmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	// #nosec
+	gzipCmd := exec.Command("gzip", "-c")
+	var gzipStderr bytes.Buffer
+	gzipCmd.Stderr = &gzipStderr
+	gzipCmd.Stdout = dstFile
+	gzipInput, err := gzipCmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := gzipCmd.Start(); err != nil {
+		return fmt.Errorf("error compressing %s: %v", src, err)
+	}
+
+	if err := tarCmd.Start(); err != nil {
+		_ = gzipInput.Close()
+		_ = gzipCmd.Wait()
+		return fmt.Errorf("error compressing %s: %v", src, err)
+	}
+
+	streamErr := roots.normalizeStream(tar.NewReader(tarOutput), tar.NewWriter(gzipInput))
+
+	// tar is only waited for after its output is consumed, or it would block writing it,
+	// and gzip only finishes once its input is closed.
+	_, _ = io.Copy(io.Discard, tarOutput)
+	tarErr := tarCmd.Wait()
+	_ = gzipInput.Close()
+	gzipErr := gzipCmd.Wait()
+
+	if tarErr != nil {
+		return fmt.Errorf("error compressing %s: %s, %v", src, tarStderr.String(), tarErr)
+	}
+
+	if streamErr != nil {
+		return fmt.Errorf("error compressing %s: %v", src, streamErr)
+	}
+
+	if gzipErr != nil {
+		return fmt.Errorf("error compressing %s: %s, %v", src, gzipStderr.String(), gzipErr)
+	}
+
+	return dstFile.Close()
+}
+
 func (a *ShellOutArchiver) Decompress(src string) (string, error) {
-	restorationPath, err := a.findRestorationPath(src)
+	return a.DecompressTo(src, "")
+}
+
+func (a *ShellOutArchiver) DecompressTo(src, dir string) (string, error) {
+	roots := currentPathRoots()
+	restorationPath, normalized, err := a.findRestorationPath(src, roots)
 	if err != nil {
 		if metricErr := a.metricsManager.LogEvent(metrics.CacheEvent{Command: metrics.CommandRestore, Corrupt: true}); metricErr != nil {
 			log.Errorf("Error publishing corruption metric: %v", metricErr)
@@ -45,7 +132,67 @@ func (a *ShellOutArchiver) Decompress(src string) (string, error) {
 		return "", fmt.Errorf("error finding restoration path: %v", err)
 	}
 
-	cmd := a.decompressionCmd(restorationPath, src)
+	// Normalized paths need to be resolved before tar sees them, and so do symlinks when restoring into dir,
+	// so the archive is decompressed by gzip, and we rewrite the headers on their way to tar.
+	rewrite := normalized || dir != ""
+	archivedPath := restorationPath
+	cmd := a.decompressionCmd(restorationPath, dir, !rewrite)
+	if dir != "" {
+		restorationPath, err = rerootPath(dir, restorationPath)
+		if err != nil {
+			return "", err
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("error creating directory '%s': %v", dir, err)
+		}
+	}
+
+	// #nosec
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("error opening '%s': %v", src, err)
+	}
+
+	defer srcFile.Close()
+
+	// The archive is fed through stdin, so we can report how much of it was already unpacked.
+	progress := unpackProgress(srcFile)
+	defer progress.Finish()
+
+	cmd.Stdin = files.NewProgressReader(srcFile, progress)
+
+	if rewrite {
+		// #nosec
+		gzipCmd := exec.Command("gzip", "-dc")
+		var gzipStderr bytes.Buffer
+		gzipCmd.Stdin = cmd.Stdin
+		gzipCmd.Stderr = &gzipStderr
+		gzipOutput, err := gzipCmd.StdoutPipe()
+		if err != nil {
+			return "", err
+		}
+
+		if err := gzipCmd.Start(); err != nil {
+			return "", fmt.Errorf("error decompressing '%s': %v", src, err)
+		}
+
+		pipeReader, pipeWriter := io.Pipe()
+		defer pipeReader.Close()
+
+		go func() {
+			streamErr := roots.resolveStream(tar.NewReader(gzipOutput), tar.NewWriter(pipeWriter), dir, archivedPath)
+			_, _ = io.Copy(io.Discard, gzipOutput)
+			if err := gzipCmd.Wait(); err != nil && streamErr == nil {
+				streamErr = fmt.Errorf("error decompressing '%s': %s, %v", src, gzipStderr.String(), err)
+			}
+
+			_ = pipeWriter.CloseWithError(streamErr)
+		}()
+
+		cmd.Stdin = pipeReader
+	}
+
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		if metricErr := a.metricsManager.LogEvent(metrics.CacheEvent{Command: metrics.CommandRestore, Corrupt: true}); metricErr != nil {
@@ -66,20 +213,31 @@ func (a *ShellOutArchiver) compressionCommand(dst, src string) *exec.Cmd {
 	return exec.Command("tar", "czf", dst, src) // #nosec G204 -- command is literal "tar"; dst/src are cache paths, not user-controlled commands
 }
 
-func (a *ShellOutArchiver) decompressionCmd(dst, tempFile string) *exec.Cmd {
+func (a *ShellOutArchiver) decompressionCmd(dst, dir string, compressed bool) *exec.Cmd {
+	flags := "x"
+	if compressed {
+		flags += "z"
+	}
+
+	// Without -P, tar strips leading slashes, and refuses entries going outside of dir.
+	if dir != "" {
+		return exec.Command("tar", flags+"f", "-", "-C", dir) // #nosec G204 -- command is literal "tar"; dir is the restore destination
+	}
+
 	if filepath.IsAbs(dst) {
-		return exec.Command("tar", "xzPf", tempFile, "-C", ".") // #nosec G204 -- command is literal "tar"; tempFile is internal temp path
+		return exec.Command("tar", flags+"Pf", "-", "-C", ".") // #nosec G204 -- command is literal "tar"
 	}
 
-	return exec.Command("tar", "xzf", tempFile, "-C", ".") // #nosec G204 -- command is literal "tar"; tempFile is internal temp path
+	return exec.Command("tar", flags+"f", "-", "-C", ".") // #nosec G204 -- command is literal "tar"
 }
 
-func (a *ShellOutArchiver) findRestorationPath(src string) (string, error) {
+// Also returns whether the archive has normalized paths in it.
+func (a *ShellOutArchiver) findRestorationPath(src string, roots pathRoots) (string, bool, error) {
 	// #nosec
 	file, err := os.Open(src)
 	if err != nil {
 		log.Errorf("error opening %s: %v", src, err)
-		return "", err
+		return "", false, err
 	}
 
 	// #nosec
@@ -88,7 +246,7 @@ func (a *ShellOutArchiver) findRestorationPath(src string) (string, error) {
 	gzipReader, err := gzip.NewReader(file)
 	if err != nil {
 		log.Errorf("error creating gzip reader: %v", err)
-		return "", err
+		return "", false, err
 	}
 
 	tr := tar.NewReader(gzipReader)
@@ -96,13 +254,19 @@ func (a *ShellOutArchiver) findRestorationPath(src string) (string, error) {
 	if err == io.EOF {
 		log.Warning("No files in archive.")
 		_ = gzipReader.Close()
-		return "", nil
+		return "", false, nil
 	}
 
 	if err != nil {
 		_ = gzipReader.Close()
-		return "", fmt.Errorf("error reading archive %s: %v", src, err)
+		return "", false, fmt.Errorf("error reading archive %s: %v", src, err)
+	}
+
+	normalized := isNormalized(header)
+	if err := roots.resolveHeader(header); err != nil {
+		_ = gzipReader.Close()
+		return "", false, err
 	}
 
-	return filepath.FromSlash(header.Name), gzipReader.Close()
+	return header.Name, normalized, gzipReader.Close()
 }
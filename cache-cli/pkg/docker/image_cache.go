@@ -0,0 +1,423 @@
+package docker
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+const ImageKeyPrefix = "docker-image-"
+const BlobKeyPrefix = "docker-blob-"
+
+var digestRegex = regexp.MustCompile(`^[a-z0-9]+:[a-f0-9]+$`)
+
+// Images are exported with docker save, which writes an OCI layout since Docker 25.
+// Every blob of the layout - layers, configs and manifests - is kept as a separate key, named after its digest,
+// so layers shared between images, or between versions of the same image, are only uploaded once.
+// The rest of the layout is kept in an image key, together with the list of blobs it needs.
+type ImageCache struct {
+	Storage storage.Storage
+	Docker  string
+}
+
+func NewImageCache(storage storage.Storage) *ImageCache {
+	return &ImageCache{Storage: storage, Docker: "docker"}
+}
+
+type imageIndex struct {
+	Image string            `json:"image"`
+	Files map[string][]byte `json:"files"`
+	Blobs []string          `json:"blobs"`
+}
+
+func ImageKey(image string) string {
+	replacer := strings.NewReplacer("/", "-", ":", "-", "@", "-")
+	return ImageKeyPrefix + replacer.Replace(image)
+}
+
+func blobKey(digest string) string {
+	return BlobKeyPrefix + strings.ReplaceAll(digest, ":", "-")
+}
+
+// Lists the images stored in the cache.
+func (c *ImageCache) Images() ([]string, error) {
+	keys, err := c.Storage.List()
+	if err != nil {
+		return nil, err
+	}
+
+	images := []string{}
+	for _, key := range keys {
+		if !strings.HasPrefix(key.Name, ImageKeyPrefix) {
+			continue
+		}
+
+		index, err := c.restoreIndex(key.Name)
+		if err != nil {
+			log.Errorf("Error reading '%s': %v", key.Name, err)
+			continue
+		}
+
+		images = append(images, index.Image)
+	}
+
+	return images, nil
+}
+
+func (c *ImageCache) Store(image string) error {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "docker-save-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(tempDir)
+
+	log.Infof("Exporting image '%s'...", image)
+	savedPath := path.Join(tempDir, "image.tar")
+	// #nosec
+	output, err := exec.Command(c.Docker, "save", "-o", savedPath, image).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error exporting image '%s': %s, %v", image, strings.TrimSpace(string(output)), err)
+	}
+
+	// #nosec
+	saved, err := os.Open(savedPath)
+	if err != nil {
+		return err
+	}
+
+	defer saved.Close()
+
+	index := imageIndex{Image: image, Files: map[string][]byte{}, Blobs: []string{}}
+	uploaded := 0
+	reader := tar.NewReader(saved)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("error reading exported image '%s': %v", image, err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		digest, isBlob := blobDigest(header.Name)
+		if !isBlob {
+			content, err := ioutil.ReadAll(reader)
+			if err != nil {
+				return err
+			}
+
+			index.Files[header.Name] = content
+			continue
+		}
+
+		index.Blobs = append(index.Blobs, digest)
+		stored, err := c.storeBlob(digest, reader)
+		if err != nil {
+			return fmt.Errorf("error storing blob '%s': %v", digest, err)
+		}
+
+		if stored {
+			uploaded++
+		}
+	}
+
+	if _, ok := index.Files["oci-layout"]; !ok {
+		return fmt.Errorf("'%s save' did not export '%s' as an OCI layout - Docker 25 or newer is required", c.Docker, image)
+	}
+
+	err = c.storeIndex(image, &index)
+	if err != nil {
+		return fmt.Errorf("error storing image '%s': %v", image, err)
+	}
+
+	log.Infof("Image '%s' stored: %d blobs uploaded, %d already in the cache.", image, uploaded, len(index.Blobs)-uploaded)
+	return nil
+}
+
+// Blobs are kept in the layout as blobs/<algorithm>/<hex>.
+func blobDigest(name string) (string, bool) {
+	parts := strings.Split(path.Clean(name), "/")
+	if len(parts) != 3 || parts[0] != "blobs" {
+		return "", false
+	}
+
+	digest := parts[1] + ":" + parts[2]
+	return digest, digestRegex.MatchString(digest)
+}
+
+func (c *ImageCache) storeBlob(digest string, reader io.Reader) (bool, error) {
+	key := blobKey(digest)
+	ok, err := c.Storage.HasKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	if ok {
+		log.Debugf("Blob '%s' is already in the cache.", digest)
+		return false, nil
+	}
+
+	tempFile, err := ioutil.TempFile(os.TempDir(), "docker-blob-*")
+	if err != nil {
+		return false, err
+	}
+
+	defer os.Remove(tempFile.Name())
+
+	_, err = io.Copy(tempFile, reader)
+	if err != nil {
+		_ = tempFile.Close()
+		return false, err
+	}
+
+	err = tempFile.Close()
+	if err != nil {
+		return false, err
+	}
+
+	return true, c.Storage.Store(key, tempFile.Name())
+}
+
+// The same tag might point to a different image by now, so the image key is always replaced.
+func (c *ImageCache) storeIndex(image string, index *imageIndex) error {
+	content, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := ioutil.TempFile(os.TempDir(), "docker-image-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(content)
+	if err != nil {
+		_ = tempFile.Close()
+		return err
+	}
+
+	err = tempFile.Close()
+	if err != nil {
+		return err
+	}
+
+	key := ImageKey(image)
+	if ok, _ := c.Storage.HasKey(key); ok {
+		return c.Storage.Replace(key, tempFile.Name())
+	}
+
+	return c.Storage.Store(key, tempFile.Name())
+}
+
+// Returns false if the image is not in the cache.
+func (c *ImageCache) Restore(image string) (bool, error) {
+	key := ImageKey(image)
+	if ok, err := c.Storage.HasKey(key); err != nil || !ok {
+		return false, err
+	}
+
+	// #nosec
+	if err := exec.Command(c.Docker, "image", "inspect", image).Run(); err == nil {
+		log.Infof("Image '%s' is already present, skipping.", image)
+		return true, nil
+	}
+
+	index, err := c.restoreIndex(key)
+	if err != nil {
+		return true, fmt.Errorf("error reading image '%s': %v", image, err)
+	}
+
+	// Blobs are evicted independently of the image key,
+	// so an image whose blobs are not all in the cache anymore is the same as a missing image.
+	missing, err := c.missingBlobs(index)
+	if err != nil {
+		return true, fmt.Errorf("error reading image '%s': %v", image, err)
+	}
+
+	if missing > 0 {
+		log.Infof("Image '%s' is missing %d of its %d blobs in the cache, skipping.", image, missing, len(index.Blobs))
+		return false, nil
+	}
+
+	log.Infof("Loading image '%s' (%d blobs)...", image, len(index.Blobs))
+
+	// The layout is streamed to docker load, so it is never written to disk as a whole.
+	pipeReader, pipeWriter := io.Pipe()
+	// #nosec
+	cmd := exec.Command(c.Docker, "load")
+	cmd.Stdin = pipeReader
+	go func() {
+		_ = pipeWriter.CloseWithError(c.writeLayout(index, pipeWriter))
+	}()
+
+	output, err := cmd.CombinedOutput()
+	_ = pipeReader.Close()
+	if err != nil {
+		return true, fmt.Errorf("error loading image '%s': %s, %v", image, strings.TrimSpace(string(output)), err)
+	}
+
+	log.Infof("Image '%s' restored.", image)
+	return true, nil
+}
+
+func (c *ImageCache) restoreIndex(key string) (*imageIndex, error) {
+	file, err := c.Storage.Restore(key)
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(file.Name())
+
+	// #nosec
+	content, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	var index imageIndex
+	err = json.Unmarshal(content, &index)
+	if err != nil {
+		return nil, err
+	}
+
+	return &index, nil
+}
+
+func (c *ImageCache) missingBlobs(index *imageIndex) (int, error) {
+	missing := 0
+	for _, digest := range index.Blobs {
+		ok, err := c.Storage.HasKey(blobKey(digest))
+		if err != nil {
+			return 0, err
+		}
+
+		if !ok {
+			missing++
+		}
+	}
+
+	return missing, nil
+}
+
+func (c *ImageCache) writeLayout(index *imageIndex, w io.Writer) error {
+	writer := tar.NewWriter(w)
+	directories := map[string]bool{"blobs/": true}
+	for _, digest := range index.Blobs {
+		directories[fmt.Sprintf("blobs/%s/", strings.SplitN(digest, ":", 2)[0])] = true
+	}
+
+	for _, name := range sortedNames(directories) {
+		err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0755, Typeflag: tar.TypeDir})
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, content := range index.Files {
+		err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		if err != nil {
+			return err
+		}
+
+		if _, err := writer.Write(content); err != nil {
+			return err
+		}
+	}
+
+	for _, digest := range index.Blobs {
+		err := c.writeBlob(writer, digest)
+		if err != nil {
+			return fmt.Errorf("error restoring blob '%s': %v", digest, err)
+		}
+	}
+
+	return writer.Close()
+}
+
+func (c *ImageCache) writeBlob(writer *tar.Writer, digest string) error {
+	if !digestRegex.MatchString(digest) {
+		return fmt.Errorf("invalid digest")
+	}
+
+	parts := strings.SplitN(digest, ":", 2)
+	file, err := c.Storage.Restore(blobKey(digest))
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	// #nosec
+	blob, err := os.Open(file.Name())
+	if err != nil {
+		return err
+	}
+
+	defer blob.Close()
+
+	// A corrupted layer should not end up in the image.
+	if parts[0] == "sha256" {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, blob); err != nil {
+			return err
+		}
+
+		if actual := hex.EncodeToString(hash.Sum(nil)); actual != parts[1] {
+			return fmt.Errorf("sha256 digest of the blob is %s", actual)
+		}
+
+		if _, err := blob.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	info, err := blob.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteHeader(&tar.Header{
+		Name:     path.Join("blobs", parts[0], parts[1]),
+		Mode:     0644,
+		Size:     info.Size(),
+		Typeflag: tar.TypeReg,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, blob)
+	return err
+}
+
+func sortedNames(names map[string]bool) []string {
+	sorted := []string{}
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,311 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	assert "github.com/stretchr/testify/assert"
+)
+
+// Keeps keys in memory, so images can be stored without a real backend.
+type memoryStorage struct {
+	mutex     sync.Mutex
+	keys      map[string][]byte
+	stored    []string
+	hasKeyErr error
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{keys: map[string][]byte{}}
+}
+
+func (s *memoryStorage) List() ([]storage.CacheKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keys := []storage.CacheKey{}
+	for name, content := range s.keys {
+		keys = append(keys, storage.CacheKey{Name: name, Size: int64(len(content))})
+	}
+
+	return keys, nil
+}
+
+func (s *memoryStorage) HasKey(key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.hasKeyErr != nil {
+		return false, s.hasKeyErr
+	}
+
+	_, ok := s.keys[key]
+	return ok, nil
+}
+
+func (s *memoryStorage) Store(key, path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys[key] = content
+	s.stored = append(s.stored, key)
+	return nil
+}
+
+func (s *memoryStorage) Replace(key, path string) error {
+	return s.Store(key, path)
+}
+
+func (s *memoryStorage) AcquireLock(key string) (bool, error) {
+	return true, nil
+}
+
+func (s *memoryStorage) RefreshLock(key string) error {
+	return nil
+}
+
+func (s *memoryStorage) ReleaseLock(key string) error {
+	return nil
+}
+
+func (s *memoryStorage) Restore(key string) (*os.File, error) {
+	s.mutex.Lock()
+	content, ok := s.keys[key]
+	s.mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("key '%s' does not exist", key)
+	}
+
+	file, err := ioutil.TempFile(os.TempDir(), "*")
+	if err != nil {
+		return nil, err
+	}
+
+	_, _ = file.Write(content)
+	return file, file.Close()
+}
+
+func (s *memoryStorage) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.keys, key)
+	return nil
+}
+
+func (s *memoryStorage) DeleteMany(keys []storage.CacheKey) error {
+	for _, key := range keys {
+		_ = s.Delete(key.Name)
+	}
+
+	return nil
+}
+
+func (s *memoryStorage) Clear() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys = map[string][]byte{}
+	return nil
+}
+
+func (s *memoryStorage) Usage() (*storage.UsageSummary, error) {
+	return &storage.UsageSummary{Free: -1}, nil
+}
+
+func (s *memoryStorage) IsNotEmpty() (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.keys) > 0, nil
+}
+
+func (s *memoryStorage) Config() storage.StorageConfig {
+	return storage.StorageConfig{SortKeysBy: storage.SortByStoreTime}
+}
+
+// The fake docker exports the layout in $FAKE_DOCKER_DIR/<image>.tar,
+// and keeps what is loaded in $FAKE_DOCKER_DIR/loaded.tar.
+const fakeDocker = `#!/bin/sh
+case "$1" in
+  save) cp "$FAKE_DOCKER_DIR/$4.tar" "$3" ;;
+  image) exit 1 ;;
+  load) cat > "$FAKE_DOCKER_DIR/loaded.tar" ;;
+esac
+`
+
+func writeLayout(t *testing.T, path string, blobs ...string) {
+	file, err := os.Create(path)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	writer := tar.NewWriter(file)
+	write := func(name string, content []byte) {
+		assert.Nil(t, writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := writer.Write(content)
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, writer.WriteHeader(&tar.Header{Name: "blobs/", Mode: 0755, Typeflag: tar.TypeDir}))
+	write("oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`))
+	write("index.json", []byte(`{"schemaVersion":2}`))
+	for _, blob := range blobs {
+		write(fmt.Sprintf("blobs/sha256/%x", sha256.Sum256([]byte(blob))), []byte(blob))
+	}
+
+	assert.Nil(t, writer.Close())
+}
+
+func readLayout(t *testing.T, path string) []string {
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	names := []string{}
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		assert.Nil(t, err)
+		if header.Typeflag == tar.TypeReg {
+			names = append(names, header.Name)
+		}
+	}
+
+	return names
+}
+
+func newFakeDocker(t *testing.T) (string, string) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "*")
+	docker := filepath.Join(dir, "docker")
+	assert.Nil(t, ioutil.WriteFile(docker, []byte(fakeDocker), 0755))
+	os.Setenv("FAKE_DOCKER_DIR", dir)
+	return dir, docker
+}
+
+func Test__StoreAndRestoreImages(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	dir, docker := newFakeDocker(t)
+	defer os.RemoveAll(dir)
+
+	writeLayout(t, filepath.Join(dir, "app-1.tar"), "base layer", "app layer 1")
+	writeLayout(t, filepath.Join(dir, "app-2.tar"), "base layer", "app layer 2")
+
+	remote := newMemoryStorage()
+	imageCache := NewImageCache(remote)
+	imageCache.Docker = docker
+
+	t.Run("layers are only uploaded once", func(t *testing.T) {
+		assert.Nil(t, imageCache.Store("app-1"))
+		assert.Len(t, remote.stored, 3)
+
+		remote.stored = nil
+		assert.Nil(t, imageCache.Store("app-2"))
+		assert.Equal(t, []string{
+			fmt.Sprintf("docker-blob-sha256-%x", sha256.Sum256([]byte("app layer 2"))),
+			"docker-image-app-2",
+		}, remote.stored)
+
+		images, err := imageCache.Images()
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, []string{"app-1", "app-2"}, images)
+	})
+
+	t.Run("images are loaded from the cache", func(t *testing.T) {
+		found, err := imageCache.Restore("app-2")
+		assert.True(t, found)
+		assert.Nil(t, err)
+
+		assert.ElementsMatch(t, []string{
+			fmt.Sprintf("blobs/sha256/%x", sha256.Sum256([]byte("app layer 2"))),
+			fmt.Sprintf("blobs/sha256/%x", sha256.Sum256([]byte("base layer"))),
+			"index.json",
+			"oci-layout",
+		}, readLayout(t, filepath.Join(dir, "loaded.tar")))
+	})
+
+	t.Run("missing images", func(t *testing.T) {
+		found, err := imageCache.Restore("app-3")
+		assert.False(t, found)
+		assert.Nil(t, err)
+	})
+
+	t.Run("corrupted layers are not loaded", func(t *testing.T) {
+		key := fmt.Sprintf("docker-blob-sha256-%x", sha256.Sum256([]byte("app layer 1")))
+		remote.keys[key] = []byte("something else")
+
+		found, err := imageCache.Restore("app-1")
+		assert.True(t, found)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("images with evicted layers are missing", func(t *testing.T) {
+		os.Remove(filepath.Join(dir, "loaded.tar"))
+		delete(remote.keys, fmt.Sprintf("docker-blob-sha256-%x", sha256.Sum256([]byte("app layer 2"))))
+
+		found, err := imageCache.Restore("app-2")
+		assert.False(t, found)
+		assert.Nil(t, err)
+		assert.NoFileExists(t, filepath.Join(dir, "loaded.tar"))
+	})
+}
+
+func Test__StoreFailsIfBlobsCannotBeChecked(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	dir, docker := newFakeDocker(t)
+	defer os.RemoveAll(dir)
+
+	writeLayout(t, filepath.Join(dir, "app-1.tar"), "base layer")
+
+	remote := newMemoryStorage()
+	remote.hasKeyErr = fmt.Errorf("connection lost")
+	imageCache := NewImageCache(remote)
+	imageCache.Docker = docker
+
+	err := imageCache.Store("app-1")
+	assert.ErrorContains(t, err, "connection lost")
+	assert.Empty(t, remote.stored)
+}
+
+func Test__StoreRequiresOCILayout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	dir, docker := newFakeDocker(t)
+	defer os.RemoveAll(dir)
+
+	legacy := bytes.Buffer{}
+	writer := tar.NewWriter(&legacy)
+	assert.Nil(t, writer.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: 2, Typeflag: tar.TypeReg}))
+	_, _ = writer.Write([]byte("[]"))
+	assert.Nil(t, writer.Close())
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "legacy.tar"), legacy.Bytes(), 0644))
+
+	remote := newMemoryStorage()
+	imageCache := NewImageCache(remote)
+	imageCache.Docker = docker
+
+	err := imageCache.Store("legacy")
+	assert.Contains(t, err.Error(), "OCI layout")
+	assert.NotContains(t, remote.keys, "docker-image-legacy")
+}
@@ -0,0 +1,105 @@
+package files
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var sharedLimiter *RateLimiter
+var sharedLimiterOnce sync.Once
+
+// SharedRateLimiter returns the limiter configured with SEMAPHORE_CACHE_MAX_BANDWIDTH.
+// All transfers in the process use the same one, so parallel transfers share the bandwidth.
+// A nil *RateLimiter is returned if no limit is configured.
+func SharedRateLimiter() *RateLimiter {
+	sharedLimiterOnce.Do(func() {
+		value := os.Getenv("SEMAPHORE_CACHE_MAX_BANDWIDTH")
+		if value == "" {
+			return
+		}
+
+		bytesPerSecond, err := ParseBandwidth(value)
+		if err != nil {
+			log.Errorf("Ignoring SEMAPHORE_CACHE_MAX_BANDWIDTH: %v", err)
+			return
+		}
+
+		log.Infof("Limiting cache transfers to %s/s.", HumanReadableSize(bytesPerSecond))
+		sharedLimiter = NewRateLimiter(bytesPerSecond)
+	})
+
+	return sharedLimiter
+}
+
+// Parses bandwidths like 50MB/s, 50M/s or 50M, using the same units as ParseSize.
+func ParseBandwidth(value string) (int64, error) {
+	size := strings.TrimSpace(value)
+	lowercase := strings.ToLower(size)
+	if strings.HasSuffix(lowercase, "/s") {
+		size = size[:len(size)-2]
+	}
+
+	bytesPerSecond, err := ParseSize(size)
+	if err != nil || bytesPerSecond <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth '%s'", value)
+	}
+
+	return bytesPerSecond, nil
+}
+
+// RateLimiter is a token bucket, holding at most one second worth of bytes.
+// Transfers can go over what is available, but every transfer after that has to wait for it.
+// A nil *RateLimiter is valid, and never waits.
+type RateLimiter struct {
+	BytesPerSecond int64
+
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+	now    func() time.Time
+	sleep  func(time.Duration)
+}
+
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	return &RateLimiter{
+		BytesPerSecond: bytesPerSecond,
+		tokens:         float64(bytesPerSecond),
+		last:           time.Now(),
+		now:            time.Now,
+		sleep:          time.Sleep,
+	}
+}
+
+// Wait blocks until n bytes can be transferred.
+func (l *RateLimiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.sleep(l.reserve(n))
+}
+
+func (l *RateLimiter) reserve(n int) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	rate := float64(l.BytesPerSecond)
+	l.tokens += now.Sub(l.last).Seconds() * rate
+	if l.tokens > rate {
+		l.tokens = rate
+	}
+
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / rate * float64(time.Second))
+}
@@ -0,0 +1,68 @@
+package files
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__ParseBandwidth(t *testing.T) {
+	t.Run("with unit per second", func(t *testing.T) {
+		bandwidth, err := ParseBandwidth("50MB/s")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(50*1024*1024), bandwidth)
+	})
+
+	t.Run("without per second", func(t *testing.T) {
+		bandwidth, err := ParseBandwidth("1.5k")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1536), bandwidth)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ParseBandwidth("fast")
+		assert.NotNil(t, err)
+
+		_, err = ParseBandwidth("0MB/s")
+		assert.NotNil(t, err)
+	})
+}
+
+func Test__RateLimiter(t *testing.T) {
+	clock := time.Now()
+	slept := time.Duration(0)
+
+	limiter := NewRateLimiter(1000)
+	limiter.last = clock
+	limiter.now = func() time.Time { return clock }
+	limiter.sleep = func(d time.Duration) { slept += d }
+
+	t.Run("does not wait while there are tokens available", func(t *testing.T) {
+		limiter.Wait(1000)
+		assert.Equal(t, time.Duration(0), slept)
+	})
+
+	t.Run("waits when tokens run out", func(t *testing.T) {
+		limiter.Wait(500)
+		assert.Equal(t, 500*time.Millisecond, slept)
+	})
+
+	t.Run("transfers sharing the limiter wait for each other", func(t *testing.T) {
+		slept = 0
+		limiter.Wait(500)
+		assert.Equal(t, time.Second, slept)
+	})
+
+	t.Run("tokens are refilled over time", func(t *testing.T) {
+		slept = 0
+		clock = clock.Add(5 * time.Second)
+		limiter.Wait(1000)
+		assert.Equal(t, time.Duration(0), slept)
+	})
+
+	t.Run("nil limiter never waits", func(t *testing.T) {
+		var limiter *RateLimiter
+		limiter.Wait(1000)
+	})
+}
@@ -1,45 +1,343 @@
 package files
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultHTTPConnectTimeout = 10 * time.Second
+	DefaultHTTPReadTimeout    = time.Minute
+	DefaultHTTPRetries        = 3
+	DefaultHTTPBackoff        = time.Second
 )
 
+type HTTPDownloadOptions struct {
+	// How long to wait for the connection to be established and for the response headers.
+	ConnectTimeout time.Duration
+
+	// The download is interrupted if no data is received for this long.
+	ReadTimeout time.Duration
+
+	// How many times an interrupted download is retried, and how long to wait before the first retry.
+	// The wait doubles for every retry after that.
+	Retries int
+	Backoff time.Duration
+}
+
+// Options are configured with the SEMAPHORE_CACHE_CDN_CONNECT_TIMEOUT, SEMAPHORE_CACHE_CDN_READ_TIMEOUT,
+// SEMAPHORE_CACHE_CDN_RETRIES and SEMAPHORE_CACHE_CDN_BACKOFF environment variables.
+// Invalid values are ignored, and the defaults are used instead.
+func HTTPDownloadOptionsFromEnv() HTTPDownloadOptions {
+	return HTTPDownloadOptions{
+		ConnectTimeout: durationFromEnv("SEMAPHORE_CACHE_CDN_CONNECT_TIMEOUT", DefaultHTTPConnectTimeout),
+		ReadTimeout:    durationFromEnv("SEMAPHORE_CACHE_CDN_READ_TIMEOUT", DefaultHTTPReadTimeout),
+		Retries:        intFromEnv("SEMAPHORE_CACHE_CDN_RETRIES", DefaultHTTPRetries),
+		Backoff:        durationFromEnv("SEMAPHORE_CACHE_CDN_BACKOFF", DefaultHTTPBackoff),
+	}
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+
+	return value
+}
+
+func intFromEnv(name string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value < 0 {
+		return defaultValue
+	}
+
+	return value
+}
+
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("failed to download file: %s", e.Status)
+}
+
+// Errors from the server side might go away if we try again,
+// but a missing key or wrong credentials won't.
+func (e *HTTPStatusError) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout
+}
+
 func DownloadFromHTTP(URL, username, password, key string) (*os.File, error) {
-	client := &http.Client{}
-	downloadURL := fmt.Sprintf("%s/%s", URL, key)
-	req, err := http.NewRequest("GET", downloadURL, nil)
+	return DownloadFromHTTPWithOptions(URL, username, password, key, HTTPDownloadOptionsFromEnv())
+}
+
+// Downloads the key into a temporary file.
+// If the download is interrupted, it is resumed from where it stopped, using a Range request.
+// The request uses If-Range, so if the key changed in the meantime, the download starts over.
+func DownloadFromHTTPWithOptions(URL, username, password, key string, options HTTPDownloadOptions) (*os.File, error) {
+	localFile, err := os.CreateTemp(os.TempDir(), fmt.Sprintf("%s-*", key))
 	if err != nil {
 		return nil, err
 	}
 
-	req.SetBasicAuth(username, password)
-	resp, err := client.Do(req)
+	download := &httpDownload{
+		client:   newHTTPClient(options),
+		url:      fmt.Sprintf("%s/%s", URL, key),
+		key:      key,
+		username: username,
+		password: password,
+		file:     localFile,
+		options:  options,
+	}
+
+	err = download.run()
+	download.progress.Finish()
 	if err != nil {
+		_ = localFile.Close()
+		_ = os.Remove(localFile.Name())
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to download file: %s", resp.Status)
+	return localFile, localFile.Close()
+}
+
+func newHTTPClient(options HTTPDownloadOptions) *http.Client {
+	dialer := &net.Dialer{Timeout: options.ConnectTimeout}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   options.ConnectTimeout,
+			ResponseHeaderTimeout: options.ConnectTimeout,
+		},
 	}
+}
 
-	localFile, err := os.CreateTemp(os.TempDir(), fmt.Sprintf("%s-*", key))
+type httpDownload struct {
+	client   *http.Client
+	url      string
+	key      string
+	username string
+	password string
+	file     *os.File
+	options  HTTPDownloadOptions
+	progress *Progress
+	written  int64
+
+	// ETag or Last-Modified of the file being downloaded, sent in If-Range when resuming.
+	validator string
+}
+
+func (d *httpDownload) run() error {
+	for attempt := 0; ; attempt++ {
+		err := d.attempt()
+		if err == nil {
+			return nil
+		}
+
+		if !isRetryable(err) || attempt >= d.options.Retries {
+			return err
+		}
+
+		wait := d.options.Backoff << attempt
+		if d.written > 0 {
+			log.Infof("Error downloading '%s': %v - resuming from %s in %v (%d/%d)...", d.key, err, HumanReadableSize(d.written), wait, attempt+1, d.options.Retries)
+		} else {
+			log.Infof("Error downloading '%s': %v - retrying in %v (%d/%d)...", d.key, err, wait, attempt+1, d.options.Retries)
+		}
+
+		time.Sleep(wait)
+	}
+}
+
+func (d *httpDownload) attempt() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", d.url, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	_, err = localFile.ReadFrom(resp.Body)
+	req.SetBasicAuth(d.username, d.password)
+
+	// Without a validator, we can't know if the rest of the file belongs to the same version of it.
+	if d.written > 0 && d.validator == "" {
+		if err := d.restart("Server does not identify the file version"); err != nil {
+			return err
+		}
+	}
+
+	if d.written > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", d.written))
+		req.Header.Set("If-Range", d.validator)
+	}
+
+	resp, err := d.client.Do(req)
 	if err != nil {
-		_ = localFile.Close()
-		return nil, err
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && d.written > 0:
+		// The server is sending the rest of the file, but it should start where we stopped.
+		if start, _, ok := parseContentRange(resp.Header.Get("Content-Range")); !ok || start != d.written {
+			if err := d.restart("Server sent an unexpected range"); err != nil {
+				return err
+			}
+
+			return fmt.Errorf("unexpected Content-Range '%s'", resp.Header.Get("Content-Range"))
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && d.written > 0:
+		// The connection was interrupted after the last byte, so there is nothing left to download.
+		if _, total, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && total == d.written {
+			return nil
+		}
+
+		if err := d.restart("Server can't resume the download"); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("unexpected response when resuming: %s", resp.Status)
+	case resp.StatusCode == http.StatusOK:
+		if err := d.restart("Server does not support resuming downloads"); err != nil {
+			return err
+		}
+
+		d.validator = responseValidator(resp)
+	default:
+		return &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	if d.progress == nil {
+		total := int64(-1)
+		if resp.ContentLength >= 0 {
+			total = d.written + resp.ContentLength
+		}
+
+		d.progress = NewProgress(fmt.Sprintf("Downloading '%s'", d.key), total)
+	}
+
+	// If no data is received for a while, the request is canceled.
+	timer := time.AfterFunc(d.options.ReadTimeout, cancel)
+	defer timer.Stop()
+
+	reader := NewProgressReader(&idleTimeoutReader{reader: resp.Body, timer: timer, timeout: d.options.ReadTimeout}, d.progress)
+	reader.Limiter = SharedRateLimiter()
+	n, err := io.Copy(d.file, reader)
+	d.written += n
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("no data received for %v", d.options.ReadTimeout)
+	}
+
+	return err
+}
+
+// If the server doesn't support Range requests, or the file changed, the whole file is sent again.
+func (d *httpDownload) restart(reason string) error {
+	if d.written == 0 {
+		return nil
+	}
+
+	log.Infof("%s, downloading '%s' from the start.", reason, d.key)
+	if err := d.file.Truncate(0); err != nil {
+		return err
+	}
+
+	if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	d.written = 0
+	d.progress.Set(0)
+	return nil
+}
+
+// If-Range only accepts strong ETags, so Last-Modified is used for weak ones.
+func responseValidator(resp *http.Response) string {
+	etag := resp.Header.Get("ETag")
+	if etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
 	}
 
-	err = resp.Body.Close()
+	return resp.Header.Get("Last-Modified")
+}
+
+// Parses a Content-Range header like 'bytes 100-199/200' or 'bytes */200'.
+// The start is -1 if not present, and the total is -1 if unknown.
+func parseContentRange(value string) (int64, int64, bool) {
+	value, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, 0, false
+	}
+
+	byteRange, totalValue, ok := strings.Cut(value, "/")
+	if !ok {
+		return 0, 0, false
+	}
+
+	total := int64(-1)
+	if totalValue != "*" {
+		parsed, err := strconv.ParseInt(totalValue, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+
+		total = parsed
+	}
+
+	if byteRange == "*" {
+		return -1, total, true
+	}
+
+	startValue, _, ok := strings.Cut(byteRange, "-")
+	if !ok {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(startValue, 10, 64)
 	if err != nil {
-		_ = localFile.Close()
-		return nil, err
+		return 0, 0, false
 	}
 
-	return localFile, localFile.Close()
+	return start, total, true
+}
+
+func isRetryable(err error) bool {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Retryable()
+	}
+
+	return true
+}
+
+type idleTimeoutReader struct {
+	reader  io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+
+	return n, err
 }
@@ -1,9 +1,17 @@
-package files
+package files_test
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
-	"testing"
 	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
 	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
 	"github.com/stretchr/testify/require"
 )
@@ -27,7 +35,7 @@ func Test__DownloadFromHTTP(t *testing.T) {
 	require.NoError(t, sftpStorage.Store("abc", "testdata/test.txt"))
 
 	t.Run("download works", func(t *testing.T) {
-		f, err := DownloadFromHTTP("http://sftp-server:80", "test", "test", "abc")
+		f, err := files.DownloadFromHTTP("http://sftp-server:80", "test", "test", "abc")
 		require.NoError(t, err)
 		require.FileExists(t, f.Name())
 
@@ -37,22 +45,283 @@ func Test__DownloadFromHTTP(t *testing.T) {
 	})
 
 	t.Run("download fails if URL is not reachable", func(t *testing.T) {
-		_, err := DownloadFromHTTP("http://sftp-server:801", "test", "test", "abc")
+		_, err := files.DownloadFromHTTP("http://sftp-server:801", "test", "test", "abc")
 		require.ErrorContains(t, err, "connection refused")
 	})
 
 	t.Run("download fails if username is invalid", func(t *testing.T) {
-		_, err := DownloadFromHTTP("http://sftp-server:80", "wrong", "test", "abc")
+		_, err := files.DownloadFromHTTP("http://sftp-server:80", "wrong", "test", "abc")
 		require.ErrorContains(t, err, "failed to download file: 401 Unauthorized")
 	})
 
 	t.Run("download fails if password is wrong", func(t *testing.T) {
-		_, err := DownloadFromHTTP("http://sftp-server:80", "test", "wrong", "abc")
+		_, err := files.DownloadFromHTTP("http://sftp-server:80", "test", "wrong", "abc")
 		require.ErrorContains(t, err, "failed to download file: 401 Unauthorized")
 	})
 
 	t.Run("download fails if file does not exist", func(t *testing.T) {
-		_, err := DownloadFromHTTP("http://sftp-server:80", "test", "test", "does-not-exist")
+		_, err := files.DownloadFromHTTP("http://sftp-server:80", "test", "test", "does-not-exist")
+		require.ErrorContains(t, err, "failed to download file: 404 Not Found")
+	})
+}
+
+func testDownloadOptions() files.HTTPDownloadOptions {
+	return files.HTTPDownloadOptions{
+		ConnectTimeout: time.Second,
+		ReadTimeout:    time.Second,
+		Retries:        2,
+		Backoff:        time.Millisecond,
+	}
+}
+
+// Sends the headers for the whole content, but closes the connection after half of it.
+func interruptResponse(t *testing.T, w http.ResponseWriter, content string) {
+	interruptResponseAfter(t, w, content, len(content)/2)
+}
+
+func interruptResponseAfter(t *testing.T, w http.ResponseWriter, content string, length int) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(content[:length]))
+	w.(http.Flusher).Flush()
+
+	conn, _, err := w.(http.Hijacker).Hijack()
+	require.NoError(t, err)
+	_ = conn.Close()
+}
+
+func Test__DownloadFromHTTPWithOptions(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+
+	t.Run("resumes interrupted download", func(t *testing.T) {
+		ranges := []string{}
+		ifRanges := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ranges = append(ranges, r.Header.Get("Range"))
+			ifRanges = append(ifRanges, r.Header.Get("If-Range"))
+			w.Header().Set("ETag", `"v1"`)
+			if len(ranges) == 1 {
+				interruptResponse(t, w, content)
+				return
+			}
+
+			http.ServeContent(w, r, "abc", time.Now(), strings.NewReader(content))
+		}))
+
+		defer server.Close()
+
+		f, err := files.DownloadFromHTTPWithOptions(server.URL, "test", "test", "abc", testDownloadOptions())
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+
+		downloaded, err := os.ReadFile(f.Name())
+		require.NoError(t, err)
+		require.Equal(t, content, string(downloaded))
+		require.Equal(t, []string{"", "bytes=5000-"}, ranges)
+		require.Equal(t, []string{"", `"v1"`}, ifRanges)
+	})
+
+	t.Run("uses Last-Modified if there is no strong ETag", func(t *testing.T) {
+		modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		ifRanges := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ifRanges = append(ifRanges, r.Header.Get("If-Range"))
+			w.Header().Set("ETag", `W/"v1"`)
+			w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+			if len(ifRanges) == 1 {
+				interruptResponse(t, w, content)
+				return
+			}
+
+			http.ServeContent(w, r, "abc", modTime, strings.NewReader(content))
+		}))
+
+		defer server.Close()
+
+		f, err := files.DownloadFromHTTPWithOptions(server.URL, "test", "test", "abc", testDownloadOptions())
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+
+		downloaded, err := os.ReadFile(f.Name())
+		require.NoError(t, err)
+		require.Equal(t, content, string(downloaded))
+		require.Equal(t, []string{"", modTime.Format(http.TimeFormat)}, ifRanges)
+	})
+
+	t.Run("starts over if the file changed", func(t *testing.T) {
+		changed := strings.Repeat("abcdefghij", 1000)
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				w.Header().Set("ETag", `"v1"`)
+				interruptResponse(t, w, content)
+				return
+			}
+
+			w.Header().Set("ETag", `"v2"`)
+			http.ServeContent(w, r, "abc", time.Now(), strings.NewReader(changed))
+		}))
+
+		defer server.Close()
+
+		f, err := files.DownloadFromHTTPWithOptions(server.URL, "test", "test", "abc", testDownloadOptions())
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+
+		downloaded, err := os.ReadFile(f.Name())
+		require.NoError(t, err)
+		require.Equal(t, changed, string(downloaded))
+	})
+
+	t.Run("starts over if the range sent is not the one requested", func(t *testing.T) {
+		ranges := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ranges = append(ranges, r.Header.Get("Range"))
+			w.Header().Set("ETag", `"v1"`)
+			switch len(ranges) {
+			case 1:
+				interruptResponse(t, w, content)
+			case 2:
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+				w.WriteHeader(http.StatusPartialContent)
+				_, _ = w.Write([]byte(content))
+			default:
+				_, _ = w.Write([]byte(content))
+			}
+		}))
+
+		defer server.Close()
+
+		f, err := files.DownloadFromHTTPWithOptions(server.URL, "test", "test", "abc", testDownloadOptions())
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+
+		downloaded, err := os.ReadFile(f.Name())
+		require.NoError(t, err)
+		require.Equal(t, content, string(downloaded))
+		require.Equal(t, []string{"", "bytes=5000-", ""}, ranges)
+	})
+
+	t.Run("download interrupted after the last byte is complete", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("ETag", `"v1"`)
+			if requests == 1 {
+				// The whole content is sent, but the connection is closed before the response ends.
+				interruptResponseAfter(t, w, content+"?", len(content))
+				return
+			}
+
+			http.ServeContent(w, r, "abc", time.Now(), strings.NewReader(content))
+		}))
+
+		defer server.Close()
+
+		f, err := files.DownloadFromHTTPWithOptions(server.URL, "test", "test", "abc", testDownloadOptions())
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+
+		downloaded, err := os.ReadFile(f.Name())
+		require.NoError(t, err)
+		require.Equal(t, content, string(downloaded))
+		require.Equal(t, 2, requests)
+	})
+
+	t.Run("starts over if server does not support ranges", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				interruptResponse(t, w, content)
+				return
+			}
+
+			_, _ = w.Write([]byte(content))
+		}))
+
+		defer server.Close()
+
+		f, err := files.DownloadFromHTTPWithOptions(server.URL, "test", "test", "abc", testDownloadOptions())
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+
+		downloaded, err := os.ReadFile(f.Name())
+		require.NoError(t, err)
+		require.Equal(t, content, string(downloaded))
+	})
+
+	t.Run("retries server errors", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			_, _ = w.Write([]byte(content))
+		}))
+
+		defer server.Close()
+
+		f, err := files.DownloadFromHTTPWithOptions(server.URL, "test", "test", "abc", testDownloadOptions())
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+		require.Equal(t, 3, requests)
+	})
+
+	t.Run("gives up after all retries", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+
+		defer server.Close()
+
+		_, err := files.DownloadFromHTTPWithOptions(server.URL, "test", "test", "abc", testDownloadOptions())
+		require.ErrorContains(t, err, "failed to download file: 502 Bad Gateway")
+		require.Equal(t, 3, requests)
+	})
+
+	t.Run("does not retry missing keys", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusNotFound)
+		}))
+
+		defer server.Close()
+
+		_, err := files.DownloadFromHTTPWithOptions(server.URL, "test", "test", "abc", testDownloadOptions())
 		require.ErrorContains(t, err, "failed to download file: 404 Not Found")
+		require.Equal(t, 1, requests)
+	})
+
+	t.Run("retries if no data is received", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+				return
+			}
+
+			_, _ = w.Write([]byte(content))
+		}))
+
+		defer server.Close()
+
+		options := testDownloadOptions()
+		options.ReadTimeout = 50 * time.Millisecond
+		f, err := files.DownloadFromHTTPWithOptions(server.URL, "test", "test", "abc", options)
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+		require.Equal(t, 2, requests)
 	})
 }
@@ -1,9 +1,13 @@
 package files
 
 import (
+	"crypto/md5" // #nosec
+	"encoding/hex"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -19,13 +23,45 @@ var lockFiles = []string{
 	"pom.xml",
 	"Podfile.lock",
 	"go.sum",
+	"Cargo.lock",
+	"pnpm-lock.yaml",
+	"poetry.lock",
+	"Pipfile.lock",
+	"uv.lock",
+	"gradle/wrapper/gradle-wrapper.properties",
+	"gradle.lockfile",
+	"build.sbt",
+	"packages.lock.json",
+	"Package.resolved",
+	"bun.lockb",
+	"pubspec.lock",
 }
 
+// When looking for lock files recursively, these directories are never descended into,
+// since they usually hold installed dependencies or build output, not projects.
+var DefaultIgnoredDirectories = []string{
+	".git",
+	"node_modules",
+	"vendor",
+	"deps",
+	"_build",
+	"target",
+	".build",
+}
+
+const DefaultMaxDepth = 3
+
 type LookupOptions struct {
 	LookupDirectory string
 	HomeDirectory   string
 	GitBranch       string
 	Restore         bool
+
+	// If Recursive is set, subdirectories up to MaxDepth levels deep are also searched.
+	// Directories whose names match one of the IgnoreDirectories patterns are skipped.
+	Recursive         bool
+	MaxDepth          int
+	IgnoreDirectories []string
 }
 
 type LookupResult struct {
@@ -44,19 +80,174 @@ func Lookup(options LookupOptions) []LookupResult {
 		lookupDirectory, _ = os.Getwd()
 	}
 
-	results := []LookupResult{}
-	for _, lockFile := range lockFiles {
-		lockFilePath := fmt.Sprintf("%s/%s", lookupDirectory, lockFile)
-		if _, err := os.Stat(lockFilePath); err == nil {
-			resultForFile := resultForfile(lockFilePath, options)
-			results = append(results, *resultForFile)
+	directories := []string{"."}
+	if options.Recursive {
+		directories = append(directories, findProjectDirectories(lookupDirectory, options)...)
+	}
+
+	detected := []*detectedLockFile{}
+	for _, directory := range directories {
+		for _, lockFile := range lockFiles {
+			lockFilePath := filepath.Join(lookupDirectory, directory, filepath.FromSlash(lockFile))
+			if _, err := os.Stat(lockFilePath); err == nil {
+				resultForFile := resultForfile(lockFilePath, directory, options)
+				if resultForFile != nil {
+					detected = append(detected, resultForFile)
+				}
+			}
 		}
 	}
 
+	results := []LookupResult{}
+	for _, file := range mergeSharedPaths(detected) {
+		results = append(results, file.result(options))
+	}
+
 	return results
 }
 
-func resultForfile(filePath string, options LookupOptions) *LookupResult {
+// A lock file detected, with the paths it should be cached into.
+// Keys are only generated after entries for the same path are merged.
+type detectedLockFile struct {
+	DetectedFile string
+	Entries      []*detectedEntry
+}
+
+type detectedEntry struct {
+	KeyPrefix string
+	Path      string
+	Checksums []string
+}
+
+// Different lock files can point to the same path, like yarn.lock and package-lock.json,
+// or .nvmrc files in different projects. Each path is only cached once,
+// with the first entry found for it, and a checksum covering all the lock files pointing to it.
+func mergeSharedPaths(detected []*detectedLockFile) []*detectedLockFile {
+	entriesByPath := map[string]*detectedEntry{}
+	merged := []*detectedLockFile{}
+	for _, file := range detected {
+		entries := []*detectedEntry{}
+		for _, entry := range file.Entries {
+			path := filepath.Clean(entry.Path)
+			if existing, ok := entriesByPath[path]; ok {
+				existing.Checksums = append(existing.Checksums, entry.Checksums...)
+				continue
+			}
+
+			entriesByPath[path] = entry
+			entries = append(entries, entry)
+		}
+
+		if len(entries) > 0 {
+			file.Entries = entries
+			merged = append(merged, file)
+		}
+	}
+
+	return merged
+}
+
+func (f *detectedLockFile) result(options LookupOptions) LookupResult {
+	gitBranch := options.GitBranch
+	if gitBranch == "" {
+		gitBranch = "master"
+	}
+
+	gitBranch = keySegmentEscaper.Replace(gitBranch)
+
+	entries := []LookupResultEntry{}
+	for _, entry := range f.Entries {
+		checksum := entry.checksum()
+		if options.Restore {
+			entries = append(entries, LookupResultEntry{
+				Path: entry.Path,
+				Keys: keysForRestore(entry.KeyPrefix, gitBranch, checksum),
+			})
+		} else {
+			key := fmt.Sprintf("%s-%s-%s", entry.KeyPrefix, gitBranch, checksum)
+			entries = append(entries, LookupResultEntry{
+				Keys: []string{key},
+				Path: entry.Path,
+			})
+		}
+	}
+
+	return LookupResult{
+		DetectedFile: f.DetectedFile,
+		Entries:      entries,
+	}
+}
+
+func (e *detectedEntry) checksum() string {
+	if len(e.Checksums) == 1 {
+		return e.Checksums[0]
+	}
+
+	// #nosec
+	hash := md5.Sum([]byte(strings.Join(e.Checksums, "-")))
+	return hex.EncodeToString(hash[:])
+}
+
+// Returns all subdirectories of lookupDirectory, relative to it,
+// that are not deeper than the configured depth and are not ignored.
+func findProjectDirectories(lookupDirectory string, options LookupOptions) []string {
+	maxDepth := options.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	ignored := options.IgnoreDirectories
+	if ignored == nil {
+		ignored = DefaultIgnoredDirectories
+	}
+
+	directories := []string{}
+	err := filepath.WalkDir(lookupDirectory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			log.Warnf("Error reading '%s' while looking for lock files: %v", path, err)
+			return nil
+		}
+
+		if !entry.IsDir() || path == lookupDirectory {
+			return nil
+		}
+
+		if isIgnoredDirectory(entry.Name(), ignored) {
+			return filepath.SkipDir
+		}
+
+		relativePath, err := filepath.Rel(lookupDirectory, path)
+		if err != nil {
+			return err
+		}
+
+		depth := len(strings.Split(filepath.ToSlash(relativePath), "/"))
+		if depth > maxDepth {
+			return filepath.SkipDir
+		}
+
+		directories = append(directories, relativePath)
+		return nil
+	})
+
+	if err != nil {
+		log.Errorf("Error looking for lock files in '%s': %v", lookupDirectory, err)
+	}
+
+	return directories
+}
+
+func isIgnoredDirectory(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func resultForfile(filePath, directory string, options LookupOptions) *detectedLockFile {
 	homedir := options.HomeDirectory
 	if homedir == "" {
 		homedir, _ = os.UserHomeDir()
@@ -66,48 +257,102 @@ func resultForfile(filePath string, options LookupOptions) *LookupResult {
 
 	switch file {
 	case ".nvmrc":
-		return buildResult(filePath, options, []buildResultRequest{
+		return buildResult(filePath, directory, []buildResultRequest{
 			{"nvm", fmt.Sprintf("%s/.nvm", homedir)},
 		})
 	case "Gemfile.lock":
-		return buildResult(filePath, options, []buildResultRequest{
+		return buildResult(filePath, directory, []buildResultRequest{
 			{"gems", "vendor/bundle"},
 		})
 	case "package-lock.json":
-		return buildResult(filePath, options, []buildResultRequest{
+		return buildResult(filePath, directory, []buildResultRequest{
 			{"node-modules", "node_modules"},
 		})
 	case "yarn.lock":
-		return buildResult(filePath, options, []buildResultRequest{
+		return buildResult(filePath, directory, []buildResultRequest{
 			{"yarn-cache", fmt.Sprintf("%s/.cache/yarn", homedir)},
 			{"node-modules", "node_modules"},
 		})
 	case "mix.lock":
-		return buildResult(filePath, options, []buildResultRequest{
+		return buildResult(filePath, directory, []buildResultRequest{
 			{"mix-deps", "deps"},
 			{"mix-build", "_build"},
 		})
 	case "requirements.txt":
-		return buildResult(filePath, options, []buildResultRequest{
+		return buildResult(filePath, directory, []buildResultRequest{
 			{"requirements", ".pip_cache"},
 		})
 	case "composer.lock":
-		return buildResult(filePath, options, []buildResultRequest{
+		return buildResult(filePath, directory, []buildResultRequest{
 			{"composer", "vendor"},
 		})
 	case "pom.xml":
-		return buildResult(filePath, options, []buildResultRequest{
+		return buildResult(filePath, directory, []buildResultRequest{
 			{"maven", ".m2"},
 			{"maven-target", "target"},
 		})
 	case "Podfile.lock":
-		return buildResult(filePath, options, []buildResultRequest{
+		return buildResult(filePath, directory, []buildResultRequest{
 			{"pods", "Pods"},
 		})
 	case "go.sum":
-		return buildResult(filePath, options, []buildResultRequest{
+		return buildResult(filePath, directory, []buildResultRequest{
 			{"go", fmt.Sprintf("%s/go/pkg/mod", homedir)},
 		})
+	case "Cargo.lock":
+		return buildResult(filePath, directory, []buildResultRequest{
+			{"cargo-registry", fmt.Sprintf("%s/.cargo/registry", homedir)},
+			{"cargo-git", fmt.Sprintf("%s/.cargo/git", homedir)},
+			{"cargo-target", "target"},
+		})
+	case "pnpm-lock.yaml":
+		return buildResult(filePath, directory, []buildResultRequest{
+			{"pnpm-store", fmt.Sprintf("%s/.local/share/pnpm/store", homedir)},
+			{"node-modules", "node_modules"},
+		})
+	case "poetry.lock":
+		return buildResult(filePath, directory, []buildResultRequest{
+			{"poetry", fmt.Sprintf("%s/.cache/pypoetry", homedir)},
+		})
+	case "Pipfile.lock":
+		return buildResult(filePath, directory, []buildResultRequest{
+			{"pipenv", fmt.Sprintf("%s/.cache/pipenv", homedir)},
+		})
+	case "uv.lock":
+		return buildResult(filePath, directory, []buildResultRequest{
+			{"uv", fmt.Sprintf("%s/.cache/uv", homedir)},
+		})
+	case "gradle-wrapper.properties":
+		return buildResult(filePath, directory, []buildResultRequest{
+			{"gradle-wrapper", fmt.Sprintf("%s/.gradle/wrapper", homedir)},
+		})
+	case "gradle.lockfile":
+		return buildResult(filePath, directory, []buildResultRequest{
+			{"gradle-caches", fmt.Sprintf("%s/.gradle/caches", homedir)},
+		})
+	case "build.sbt":
+		return buildResult(filePath, directory, []buildResultRequest{
+			{"sbt", fmt.Sprintf("%s/.sbt", homedir)},
+			{"ivy2", fmt.Sprintf("%s/.ivy2/cache", homedir)},
+			{"coursier", fmt.Sprintf("%s/.cache/coursier", homedir)},
+		})
+	case "packages.lock.json":
+		return buildResult(filePath, directory, []buildResultRequest{
+			{"nuget", fmt.Sprintf("%s/.nuget/packages", homedir)},
+		})
+	case "Package.resolved":
+		return buildResult(filePath, directory, []buildResultRequest{
+			{"swiftpm", ".build"},
+		})
+	case "bun.lockb":
+		return buildResult(filePath, directory, []buildResultRequest{
+			{"bun", fmt.Sprintf("%s/.bun/install/cache", homedir)},
+			{"node-modules", "node_modules"},
+		})
+	case "pubspec.lock":
+		return buildResult(filePath, directory, []buildResultRequest{
+			{"pub", fmt.Sprintf("%s/.pub-cache", homedir)},
+		})
 	default:
 		fmt.Printf("Missing branch for %s - this should never happen!\n", file)
 		return nil
@@ -119,52 +364,73 @@ type buildResultRequest struct {
 	Path      string
 }
 
-func buildResult(filePath string, options LookupOptions, entries []buildResultRequest) *LookupResult {
-	gitBranch := options.GitBranch
-	if gitBranch == "" {
-		gitBranch = "master"
-	}
-
+func buildResult(filePath, directory string, entries []buildResultRequest) *detectedLockFile {
 	checksum, err := GenerateChecksum(filePath)
 	if err != nil {
 		log.Errorf("Error generating checksum for %s: %v", filePath, err)
 		return nil
 	}
 
-	newEntries := []LookupResultEntry{}
+	newEntries := []*detectedEntry{}
 	for _, entry := range entries {
-		if options.Restore {
-			newEntries = append(newEntries, LookupResultEntry{
-				Path: filepath.FromSlash(entry.Path),
-				Keys: keysForRestore(entry.KeyPrefix, gitBranch, checksum),
-			})
-		} else {
-			key := fmt.Sprintf("%s-%s-%s", entry.KeyPrefix, gitBranch, checksum)
-			newEntries = append(newEntries, LookupResultEntry{
-				Keys: []string{key},
-				Path: filepath.FromSlash(entry.Path),
-			})
-		}
+		newEntries = append(newEntries, &detectedEntry{
+			KeyPrefix: scopedKeyPrefix(entry.KeyPrefix, directory),
+			Path:      scopedPath(entry.Path, directory),
+			Checksums: []string{checksum},
+		})
 	}
 
-	return &LookupResult{
-		DetectedFile: filepath.Base(filePath),
+	detectedFile := filepath.Base(filePath)
+	if directory != "." {
+		detectedFile = filepath.ToSlash(filepath.Join(directory, detectedFile))
+	}
+
+	return &detectedLockFile{
+		DetectedFile: detectedFile,
 		Entries:      newEntries,
 	}
 }
 
+// Parts of a key are joined with '-', so '-', '/' and '_' in them are escaped with '_'.
+// Escaped text never contains a '-' that is not escaped, so fallback keys ending with '-'
+// never match keys for a different branch, like 'main' and 'main-foo'.
+var keySegmentEscaper = strings.NewReplacer("_", "__", "-", "_-", "/", "_s")
+
+// Lock files found in subdirectories get keys scoped by their relative path,
+// so projects in the same repository do not overwrite each other's caches.
+// The scope ends with '_.', which escaped text never contains,
+// so keys for the root directory and for subdirectories never match each other's fallback keys.
+func scopedKeyPrefix(keyPrefix, directory string) string {
+	if directory == "." {
+		return keyPrefix
+	}
+
+	return fmt.Sprintf("%s-%s_.", keyPrefix, keySegmentEscaper.Replace(filepath.ToSlash(directory)))
+}
+
+// Relative cache paths are resolved against the directory where the lock file was found.
+// Absolute paths, like the ones inside the home directory, are shared between projects.
+func scopedPath(path, directory string) string {
+	path = filepath.FromSlash(path)
+	if directory == "." || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(directory, path)
+}
+
 func keysForRestore(keyPrefix, gitBranch, checksum string) []string {
 	keys := []string{
 		fmt.Sprintf("%s-%s-%s", keyPrefix, gitBranch, checksum),
-		fmt.Sprintf("%s-%s", keyPrefix, gitBranch),
+		fmt.Sprintf("%s-%s-", keyPrefix, gitBranch),
 	}
 
 	if gitBranch != "master" {
-		keys = append(keys, fmt.Sprintf("%s-master", keyPrefix))
+		keys = append(keys, fmt.Sprintf("%s-master-", keyPrefix))
 	}
 
 	if gitBranch != "main" {
-		keys = append(keys, fmt.Sprintf("%s-main", keyPrefix))
+		keys = append(keys, fmt.Sprintf("%s-main-", keyPrefix))
 	}
 
 	return keys
@@ -2,9 +2,11 @@ package files
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	assert "github.com/stretchr/testify/assert"
@@ -192,6 +194,228 @@ func Test__LookupStore(t *testing.T) {
 		})
 	})
 
+	t.Run("finds Cargo.lock", func(t *testing.T) {
+		checksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/cargo/Cargo.lock", rootPath))
+		assert.Nil(t, err)
+
+		lookupDirectory := fmt.Sprintf("%s/test/autocache/cargo", rootPath)
+		assertLookupResults(t, Lookup(LookupOptions{Restore: false, LookupDirectory: lookupDirectory}), []LookupResult{
+			{
+				DetectedFile: "Cargo.lock",
+				Entries: []LookupResultEntry{
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.cargo/registry", homedir)),
+						Keys: []string{fmt.Sprintf("cargo-registry-master-%s", checksum)},
+					},
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.cargo/git", homedir)),
+						Keys: []string{fmt.Sprintf("cargo-git-master-%s", checksum)},
+					},
+					{Path: "target", Keys: []string{fmt.Sprintf("cargo-target-master-%s", checksum)}},
+				},
+			},
+		})
+	})
+
+	t.Run("finds pnpm-lock.yaml", func(t *testing.T) {
+		checksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/pnpm/pnpm-lock.yaml", rootPath))
+		assert.Nil(t, err)
+
+		lookupDirectory := fmt.Sprintf("%s/test/autocache/pnpm", rootPath)
+		assertLookupResults(t, Lookup(LookupOptions{Restore: false, LookupDirectory: lookupDirectory}), []LookupResult{
+			{
+				DetectedFile: "pnpm-lock.yaml",
+				Entries: []LookupResultEntry{
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.local/share/pnpm/store", homedir)),
+						Keys: []string{fmt.Sprintf("pnpm-store-master-%s", checksum)},
+					},
+					{Path: "node_modules", Keys: []string{fmt.Sprintf("node-modules-master-%s", checksum)}},
+				},
+			},
+		})
+	})
+
+	t.Run("finds poetry.lock", func(t *testing.T) {
+		checksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/poetry/poetry.lock", rootPath))
+		assert.Nil(t, err)
+
+		lookupDirectory := fmt.Sprintf("%s/test/autocache/poetry", rootPath)
+		assertLookupResults(t, Lookup(LookupOptions{Restore: false, LookupDirectory: lookupDirectory}), []LookupResult{
+			{
+				DetectedFile: "poetry.lock",
+				Entries: []LookupResultEntry{
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.cache/pypoetry", homedir)),
+						Keys: []string{fmt.Sprintf("poetry-master-%s", checksum)},
+					},
+				},
+			},
+		})
+	})
+
+	t.Run("finds Pipfile.lock", func(t *testing.T) {
+		checksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/pipenv/Pipfile.lock", rootPath))
+		assert.Nil(t, err)
+
+		lookupDirectory := fmt.Sprintf("%s/test/autocache/pipenv", rootPath)
+		assertLookupResults(t, Lookup(LookupOptions{Restore: false, LookupDirectory: lookupDirectory}), []LookupResult{
+			{
+				DetectedFile: "Pipfile.lock",
+				Entries: []LookupResultEntry{
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.cache/pipenv", homedir)),
+						Keys: []string{fmt.Sprintf("pipenv-master-%s", checksum)},
+					},
+				},
+			},
+		})
+	})
+
+	t.Run("finds uv.lock", func(t *testing.T) {
+		checksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/uv/uv.lock", rootPath))
+		assert.Nil(t, err)
+
+		lookupDirectory := fmt.Sprintf("%s/test/autocache/uv", rootPath)
+		assertLookupResults(t, Lookup(LookupOptions{Restore: false, LookupDirectory: lookupDirectory}), []LookupResult{
+			{
+				DetectedFile: "uv.lock",
+				Entries: []LookupResultEntry{
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.cache/uv", homedir)),
+						Keys: []string{fmt.Sprintf("uv-master-%s", checksum)},
+					},
+				},
+			},
+		})
+	})
+
+	t.Run("finds gradle wrapper and gradle.lockfile", func(t *testing.T) {
+		wrapperChecksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/gradle/gradle/wrapper/gradle-wrapper.properties", rootPath))
+		assert.Nil(t, err)
+
+		lockfileChecksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/gradle/gradle.lockfile", rootPath))
+		assert.Nil(t, err)
+
+		lookupDirectory := fmt.Sprintf("%s/test/autocache/gradle", rootPath)
+		assertLookupResults(t, Lookup(LookupOptions{Restore: false, LookupDirectory: lookupDirectory}), []LookupResult{
+			{
+				DetectedFile: "gradle-wrapper.properties",
+				Entries: []LookupResultEntry{
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.gradle/wrapper", homedir)),
+						Keys: []string{fmt.Sprintf("gradle-wrapper-master-%s", wrapperChecksum)},
+					},
+				},
+			},
+			{
+				DetectedFile: "gradle.lockfile",
+				Entries: []LookupResultEntry{
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.gradle/caches", homedir)),
+						Keys: []string{fmt.Sprintf("gradle-caches-master-%s", lockfileChecksum)},
+					},
+				},
+			},
+		})
+	})
+
+	t.Run("finds build.sbt", func(t *testing.T) {
+		checksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/sbt/build.sbt", rootPath))
+		assert.Nil(t, err)
+
+		lookupDirectory := fmt.Sprintf("%s/test/autocache/sbt", rootPath)
+		assertLookupResults(t, Lookup(LookupOptions{Restore: false, LookupDirectory: lookupDirectory}), []LookupResult{
+			{
+				DetectedFile: "build.sbt",
+				Entries: []LookupResultEntry{
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.sbt", homedir)),
+						Keys: []string{fmt.Sprintf("sbt-master-%s", checksum)},
+					},
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.ivy2/cache", homedir)),
+						Keys: []string{fmt.Sprintf("ivy2-master-%s", checksum)},
+					},
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.cache/coursier", homedir)),
+						Keys: []string{fmt.Sprintf("coursier-master-%s", checksum)},
+					},
+				},
+			},
+		})
+	})
+
+	t.Run("finds packages.lock.json", func(t *testing.T) {
+		checksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/nuget/packages.lock.json", rootPath))
+		assert.Nil(t, err)
+
+		lookupDirectory := fmt.Sprintf("%s/test/autocache/nuget", rootPath)
+		assertLookupResults(t, Lookup(LookupOptions{Restore: false, LookupDirectory: lookupDirectory}), []LookupResult{
+			{
+				DetectedFile: "packages.lock.json",
+				Entries: []LookupResultEntry{
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.nuget/packages", homedir)),
+						Keys: []string{fmt.Sprintf("nuget-master-%s", checksum)},
+					},
+				},
+			},
+		})
+	})
+
+	t.Run("finds Package.resolved", func(t *testing.T) {
+		checksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/swiftpm/Package.resolved", rootPath))
+		assert.Nil(t, err)
+
+		lookupDirectory := fmt.Sprintf("%s/test/autocache/swiftpm", rootPath)
+		assertLookupResults(t, Lookup(LookupOptions{Restore: false, LookupDirectory: lookupDirectory}), []LookupResult{
+			{
+				DetectedFile: "Package.resolved",
+				Entries: []LookupResultEntry{
+					{Path: ".build", Keys: []string{fmt.Sprintf("swiftpm-master-%s", checksum)}},
+				},
+			},
+		})
+	})
+
+	t.Run("finds bun.lockb", func(t *testing.T) {
+		checksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/bun/bun.lockb", rootPath))
+		assert.Nil(t, err)
+
+		lookupDirectory := fmt.Sprintf("%s/test/autocache/bun", rootPath)
+		assertLookupResults(t, Lookup(LookupOptions{Restore: false, LookupDirectory: lookupDirectory}), []LookupResult{
+			{
+				DetectedFile: "bun.lockb",
+				Entries: []LookupResultEntry{
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.bun/install/cache", homedir)),
+						Keys: []string{fmt.Sprintf("bun-master-%s", checksum)},
+					},
+					{Path: "node_modules", Keys: []string{fmt.Sprintf("node-modules-master-%s", checksum)}},
+				},
+			},
+		})
+	})
+
+	t.Run("finds pubspec.lock", func(t *testing.T) {
+		checksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/dart/pubspec.lock", rootPath))
+		assert.Nil(t, err)
+
+		lookupDirectory := fmt.Sprintf("%s/test/autocache/dart", rootPath)
+		assertLookupResults(t, Lookup(LookupOptions{Restore: false, LookupDirectory: lookupDirectory}), []LookupResult{
+			{
+				DetectedFile: "pubspec.lock",
+				Entries: []LookupResultEntry{
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.pub-cache", homedir)),
+						Keys: []string{fmt.Sprintf("pub-master-%s", checksum)},
+					},
+				},
+			},
+		})
+	})
+
 	t.Run("finds requirements.txt and package-lock.json", func(t *testing.T) {
 		requirementsChecksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/multiple-files/requirements.txt", rootPath))
 		assert.Nil(t, err)
@@ -243,10 +467,10 @@ func Test__LookupRestore(t *testing.T) {
 					{
 						Path: filepath.FromSlash(fmt.Sprintf("%s/.nvm", homedir)),
 						Keys: []string{
-							fmt.Sprintf("nvm-some-branch-%s", checksum),
-							"nvm-some-branch",
-							"nvm-master",
-							"nvm-main",
+							fmt.Sprintf("nvm-some_-branch-%s", checksum),
+							"nvm-some_-branch-",
+							"nvm-master-",
+							"nvm-main-",
 						},
 					},
 				},
@@ -266,10 +490,10 @@ func Test__LookupRestore(t *testing.T) {
 					{
 						Path: filepath.FromSlash("vendor/bundle"),
 						Keys: []string{
-							fmt.Sprintf("gems-some-branch-%s", checksum),
-							"gems-some-branch",
-							"gems-master",
-							"gems-main",
+							fmt.Sprintf("gems-some_-branch-%s", checksum),
+							"gems-some_-branch-",
+							"gems-master-",
+							"gems-main-",
 						},
 					},
 				},
@@ -287,10 +511,10 @@ func Test__LookupRestore(t *testing.T) {
 				DetectedFile: "package-lock.json",
 				Entries: []LookupResultEntry{
 					{Path: "node_modules", Keys: []string{
-						fmt.Sprintf("node-modules-some-branch-%s", checksum),
-						"node-modules-some-branch",
-						"node-modules-master",
-						"node-modules-main",
+						fmt.Sprintf("node-modules-some_-branch-%s", checksum),
+						"node-modules-some_-branch-",
+						"node-modules-master-",
+						"node-modules-main-",
 					}},
 				},
 			},
@@ -307,10 +531,10 @@ func Test__LookupRestore(t *testing.T) {
 				DetectedFile: "requirements.txt",
 				Entries: []LookupResultEntry{
 					{Path: ".pip_cache", Keys: []string{
-						fmt.Sprintf("requirements-some-branch-%s", checksum),
-						"requirements-some-branch",
-						"requirements-master",
-						"requirements-main",
+						fmt.Sprintf("requirements-some_-branch-%s", checksum),
+						"requirements-some_-branch-",
+						"requirements-master-",
+						"requirements-main-",
 					}},
 				},
 			},
@@ -327,10 +551,10 @@ func Test__LookupRestore(t *testing.T) {
 				DetectedFile: "composer.lock",
 				Entries: []LookupResultEntry{
 					{Path: "vendor", Keys: []string{
-						fmt.Sprintf("composer-some-branch-%s", checksum),
-						"composer-some-branch",
-						"composer-master",
-						"composer-main",
+						fmt.Sprintf("composer-some_-branch-%s", checksum),
+						"composer-some_-branch-",
+						"composer-master-",
+						"composer-main-",
 					}},
 				},
 			},
@@ -347,10 +571,10 @@ func Test__LookupRestore(t *testing.T) {
 				DetectedFile: "Podfile.lock",
 				Entries: []LookupResultEntry{
 					{Path: "Pods", Keys: []string{
-						fmt.Sprintf("pods-some-branch-%s", checksum),
-						"pods-some-branch",
-						"pods-master",
-						"pods-main",
+						fmt.Sprintf("pods-some_-branch-%s", checksum),
+						"pods-some_-branch-",
+						"pods-master-",
+						"pods-main-",
 					}},
 				},
 			},
@@ -369,10 +593,10 @@ func Test__LookupRestore(t *testing.T) {
 					{
 						Path: filepath.FromSlash(fmt.Sprintf("%s/go/pkg/mod", homedir)),
 						Keys: []string{
-							fmt.Sprintf("go-some-branch-%s", checksum),
-							"go-some-branch",
-							"go-master",
-							"go-main",
+							fmt.Sprintf("go-some_-branch-%s", checksum),
+							"go-some_-branch-",
+							"go-master-",
+							"go-main-",
 						},
 					},
 				},
@@ -392,19 +616,19 @@ func Test__LookupRestore(t *testing.T) {
 					{
 						Path: filepath.FromSlash(fmt.Sprintf("%s/.cache/yarn", homedir)),
 						Keys: []string{
-							fmt.Sprintf("yarn-cache-some-branch-%s", checksum),
-							"yarn-cache-some-branch",
-							"yarn-cache-master",
-							"yarn-cache-main",
+							fmt.Sprintf("yarn-cache-some_-branch-%s", checksum),
+							"yarn-cache-some_-branch-",
+							"yarn-cache-master-",
+							"yarn-cache-main-",
 						},
 					},
 					{
 						Path: "node_modules",
 						Keys: []string{
-							fmt.Sprintf("node-modules-some-branch-%s", checksum),
-							"node-modules-some-branch",
-							"node-modules-master",
-							"node-modules-main",
+							fmt.Sprintf("node-modules-some_-branch-%s", checksum),
+							"node-modules-some_-branch-",
+							"node-modules-master-",
+							"node-modules-main-",
 						},
 					},
 				},
@@ -422,16 +646,16 @@ func Test__LookupRestore(t *testing.T) {
 				DetectedFile: "mix.lock",
 				Entries: []LookupResultEntry{
 					{Path: "deps", Keys: []string{
-						fmt.Sprintf("mix-deps-some-branch-%s", checksum),
-						"mix-deps-some-branch",
-						"mix-deps-master",
-						"mix-deps-main",
+						fmt.Sprintf("mix-deps-some_-branch-%s", checksum),
+						"mix-deps-some_-branch-",
+						"mix-deps-master-",
+						"mix-deps-main-",
 					}},
 					{Path: "_build", Keys: []string{
-						fmt.Sprintf("mix-build-some-branch-%s", checksum),
-						"mix-build-some-branch",
-						"mix-build-master",
-						"mix-build-main",
+						fmt.Sprintf("mix-build-some_-branch-%s", checksum),
+						"mix-build-some_-branch-",
+						"mix-build-master-",
+						"mix-build-main-",
 					}},
 				},
 			},
@@ -448,16 +672,74 @@ func Test__LookupRestore(t *testing.T) {
 				DetectedFile: "pom.xml",
 				Entries: []LookupResultEntry{
 					{Path: ".m2", Keys: []string{
-						fmt.Sprintf("maven-some-branch-%s", checksum),
-						"maven-some-branch",
-						"maven-master",
-						"maven-main",
+						fmt.Sprintf("maven-some_-branch-%s", checksum),
+						"maven-some_-branch-",
+						"maven-master-",
+						"maven-main-",
 					}},
 					{Path: "target", Keys: []string{
-						fmt.Sprintf("maven-target-some-branch-%s", checksum),
-						"maven-target-some-branch",
-						"maven-target-master",
-						"maven-target-main",
+						fmt.Sprintf("maven-target-some_-branch-%s", checksum),
+						"maven-target-some_-branch-",
+						"maven-target-master-",
+						"maven-target-main-",
+					}},
+				},
+			},
+		})
+	})
+
+	t.Run("finds Cargo.lock", func(t *testing.T) {
+		checksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/cargo/Cargo.lock", rootPath))
+		assert.Nil(t, err)
+
+		lookupDirectory := fmt.Sprintf("%s/test/autocache/cargo", rootPath)
+		assertLookupResults(t, Lookup(LookupOptions{Restore: true, GitBranch: "some-branch", LookupDirectory: lookupDirectory}), []LookupResult{
+			{
+				DetectedFile: "Cargo.lock",
+				Entries: []LookupResultEntry{
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.cargo/registry", homedir)),
+						Keys: []string{
+							fmt.Sprintf("cargo-registry-some_-branch-%s", checksum),
+							"cargo-registry-some_-branch-",
+							"cargo-registry-master-",
+							"cargo-registry-main-",
+						},
+					},
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/.cargo/git", homedir)),
+						Keys: []string{
+							fmt.Sprintf("cargo-git-some_-branch-%s", checksum),
+							"cargo-git-some_-branch-",
+							"cargo-git-master-",
+							"cargo-git-main-",
+						},
+					},
+					{Path: "target", Keys: []string{
+						fmt.Sprintf("cargo-target-some_-branch-%s", checksum),
+						"cargo-target-some_-branch-",
+						"cargo-target-master-",
+						"cargo-target-main-",
+					}},
+				},
+			},
+		})
+	})
+
+	t.Run("finds Package.resolved", func(t *testing.T) {
+		checksum, err := GenerateChecksum(fmt.Sprintf("%s/test/autocache/swiftpm/Package.resolved", rootPath))
+		assert.Nil(t, err)
+
+		lookupDirectory := fmt.Sprintf("%s/test/autocache/swiftpm", rootPath)
+		assertLookupResults(t, Lookup(LookupOptions{Restore: true, GitBranch: "some-branch", LookupDirectory: lookupDirectory}), []LookupResult{
+			{
+				DetectedFile: "Package.resolved",
+				Entries: []LookupResultEntry{
+					{Path: ".build", Keys: []string{
+						fmt.Sprintf("swiftpm-some_-branch-%s", checksum),
+						"swiftpm-some_-branch-",
+						"swiftpm-master-",
+						"swiftpm-main-",
 					}},
 				},
 			},
@@ -477,10 +759,10 @@ func Test__LookupRestore(t *testing.T) {
 				DetectedFile: "package-lock.json",
 				Entries: []LookupResultEntry{
 					{Path: "node_modules", Keys: []string{
-						fmt.Sprintf("node-modules-some-branch-%s", packageLockChecksum),
-						"node-modules-some-branch",
-						"node-modules-master",
-						"node-modules-main",
+						fmt.Sprintf("node-modules-some_-branch-%s", packageLockChecksum),
+						"node-modules-some_-branch-",
+						"node-modules-master-",
+						"node-modules-main-",
 					}},
 				},
 			},
@@ -488,10 +770,10 @@ func Test__LookupRestore(t *testing.T) {
 				DetectedFile: "requirements.txt",
 				Entries: []LookupResultEntry{
 					{Path: ".pip_cache", Keys: []string{
-						fmt.Sprintf("requirements-some-branch-%s", requirementsChecksum),
-						"requirements-some-branch",
-						"requirements-master",
-						"requirements-main",
+						fmt.Sprintf("requirements-some_-branch-%s", requirementsChecksum),
+						"requirements-some_-branch-",
+						"requirements-master-",
+						"requirements-main-",
 					}},
 				},
 			},
@@ -509,8 +791,8 @@ func Test__LookupRestore(t *testing.T) {
 				Entries: []LookupResultEntry{
 					{Path: "node_modules", Keys: []string{
 						fmt.Sprintf("node-modules-master-%s", checksum),
-						"node-modules-master",
-						"node-modules-main",
+						"node-modules-master-",
+						"node-modules-main-",
 					}},
 				},
 			},
@@ -528,8 +810,8 @@ func Test__LookupRestore(t *testing.T) {
 				Entries: []LookupResultEntry{
 					{Path: "node_modules", Keys: []string{
 						fmt.Sprintf("node-modules-main-%s", checksum),
-						"node-modules-main",
-						"node-modules-master",
+						"node-modules-main-",
+						"node-modules-master-",
 					}},
 				},
 			},
@@ -552,3 +834,201 @@ func assertLookupResults(t *testing.T, actualResults []LookupResult, expectedRes
 		}
 	}
 }
+
+func Test__LookupRecursive(t *testing.T) {
+	homedir, _ := os.UserHomeDir()
+
+	// TODO: find a better way to find the root path
+	_, b, _, _ := runtime.Caller(0)
+	testFilePath := filepath.Dir(b)
+	pkgPath := filepath.Dir(testFilePath)
+	rootPath := filepath.Dir(pkgPath)
+	lookupDirectory := fmt.Sprintf("%s/test/autocache/monorepo", rootPath)
+
+	gemfileChecksum, err := GenerateChecksum(fmt.Sprintf("%s/Gemfile.lock", lookupDirectory))
+	assert.Nil(t, err)
+
+	packageLockChecksum, err := GenerateChecksum(fmt.Sprintf("%s/services/api/package-lock.json", lookupDirectory))
+	assert.Nil(t, err)
+
+	goSumChecksum, err := GenerateChecksum(fmt.Sprintf("%s/services/worker/go.sum", lookupDirectory))
+	assert.Nil(t, err)
+
+	t.Run("only root directory is used if not recursive", func(t *testing.T) {
+		assertLookupResults(t, Lookup(LookupOptions{Restore: false, LookupDirectory: lookupDirectory}), []LookupResult{
+			{
+				DetectedFile: "Gemfile.lock",
+				Entries: []LookupResultEntry{
+					{Path: filepath.FromSlash("vendor/bundle"), Keys: []string{fmt.Sprintf("gems-master-%s", gemfileChecksum)}},
+				},
+			},
+		})
+	})
+
+	t.Run("finds lock files in subdirectories", func(t *testing.T) {
+		results := Lookup(LookupOptions{Restore: false, Recursive: true, LookupDirectory: lookupDirectory})
+		assertLookupResults(t, results, []LookupResult{
+			{
+				DetectedFile: "Gemfile.lock",
+				Entries: []LookupResultEntry{
+					{Path: filepath.FromSlash("vendor/bundle"), Keys: []string{fmt.Sprintf("gems-master-%s", gemfileChecksum)}},
+				},
+			},
+			{
+				DetectedFile: "services/api/package-lock.json",
+				Entries: []LookupResultEntry{
+					{
+						Path: filepath.FromSlash("services/api/node_modules"),
+						Keys: []string{fmt.Sprintf("node-modules-services_sapi_.-master-%s", packageLockChecksum)},
+					},
+				},
+			},
+			{
+				DetectedFile: "services/worker/go.sum",
+				Entries: []LookupResultEntry{
+					{
+						Path: filepath.FromSlash(fmt.Sprintf("%s/go/pkg/mod", homedir)),
+						Keys: []string{fmt.Sprintf("go-services_sworker_.-master-%s", goSumChecksum)},
+					},
+				},
+			},
+		})
+	})
+
+	t.Run("uses scoped keys for restore", func(t *testing.T) {
+		results := Lookup(LookupOptions{Restore: true, Recursive: true, GitBranch: "some-branch", LookupDirectory: lookupDirectory, MaxDepth: 2})
+		if assert.Len(t, results, 3) {
+			assert.Equal(t, "services/api/package-lock.json", results[1].DetectedFile)
+			assert.Equal(t, []string{
+				fmt.Sprintf("node-modules-services_sapi_.-some_-branch-%s", packageLockChecksum),
+				"node-modules-services_sapi_.-some_-branch-",
+				"node-modules-services_sapi_.-master-",
+				"node-modules-services_sapi_.-main-",
+			}, results[1].Entries[0].Keys)
+		}
+	})
+
+	t.Run("respects max depth", func(t *testing.T) {
+		results := Lookup(LookupOptions{Restore: false, Recursive: true, MaxDepth: 4, LookupDirectory: lookupDirectory})
+		if assert.Len(t, results, 4) {
+			assert.Equal(t, "tools/a/b/c/yarn.lock", results[3].DetectedFile)
+		}
+
+		results = Lookup(LookupOptions{Restore: false, Recursive: true, MaxDepth: 1, LookupDirectory: lookupDirectory})
+		assert.Len(t, results, 1)
+	})
+
+	t.Run("respects ignored directories", func(t *testing.T) {
+		results := Lookup(LookupOptions{Restore: false, Recursive: true, IgnoreDirectories: []string{"serv*"}, LookupDirectory: lookupDirectory})
+		if assert.Len(t, results, 2) {
+			assert.Equal(t, "Gemfile.lock", results[0].DetectedFile)
+			assert.Equal(t, "node_modules/some-package/package-lock.json", results[1].DetectedFile)
+		}
+	})
+}
+
+func Test__LookupSharedPaths(t *testing.T) {
+	lookupDirectory, _ := ioutil.TempDir("", "*")
+	defer os.RemoveAll(lookupDirectory)
+
+	homedir, _ := ioutil.TempDir("", "*")
+	defer os.RemoveAll(homedir)
+
+	writeLockFile := func(path, content string) string {
+		path = filepath.Join(lookupDirectory, filepath.FromSlash(path))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0600))
+		checksum, err := GenerateChecksum(path)
+		assert.Nil(t, err)
+		return checksum
+	}
+
+	packageLockChecksum := writeLockFile("package-lock.json", "package-lock")
+	yarnChecksum := writeLockFile("yarn.lock", "yarn")
+	apiChecksum := writeLockFile("services/api/.nvmrc", "v18")
+	otherApiChecksum := writeLockFile("services-api/.nvmrc", "v20")
+
+	results := Lookup(LookupOptions{Recursive: true, LookupDirectory: lookupDirectory, HomeDirectory: homedir})
+	assertLookupResults(t, results, []LookupResult{
+		{
+			DetectedFile: "package-lock.json",
+			Entries: []LookupResultEntry{
+				{
+					Path: "node_modules",
+					Keys: []string{fmt.Sprintf("node-modules-master-%s", combinedChecksum(packageLockChecksum, yarnChecksum))},
+				},
+			},
+		},
+		{
+			DetectedFile: "yarn.lock",
+			Entries: []LookupResultEntry{
+				{
+					Path: fmt.Sprintf("%s/.cache/yarn", homedir),
+					Keys: []string{fmt.Sprintf("yarn-cache-master-%s", yarnChecksum)},
+				},
+			},
+		},
+		{
+			DetectedFile: "services/api/.nvmrc",
+			Entries: []LookupResultEntry{
+				{
+					Path: filepath.FromSlash(fmt.Sprintf("%s/.nvm", homedir)),
+					Keys: []string{fmt.Sprintf("nvm-services_sapi_.-master-%s", combinedChecksum(apiChecksum, otherApiChecksum))},
+				},
+			},
+		},
+	})
+}
+
+func combinedChecksum(checksums ...string) string {
+	entry := detectedEntry{Checksums: checksums}
+	return entry.checksum()
+}
+
+func Test__ScopedKeyPrefix(t *testing.T) {
+	assert.Equal(t, "go", scopedKeyPrefix("go", "."))
+	assert.Equal(t, "go-services_sapi_.", scopedKeyPrefix("go", filepath.FromSlash("services/api")))
+	assert.Equal(t, "go-services_-api_.", scopedKeyPrefix("go", "services-api"))
+	assert.Equal(t, "go-services__api_.", scopedKeyPrefix("go", "services_api"))
+	assert.Equal(t, "go-services___-api_.", scopedKeyPrefix("go", "services_-api"))
+}
+
+// Restore keys are used as prefixes, so the fallback keys of one entry should never match keys stored by another.
+func Test__RestoreKeysDoNotMatchOtherEntries(t *testing.T) {
+	storeKey := func(directory, branch string) string {
+		entry := detectedLockFile{Entries: []*detectedEntry{{KeyPrefix: scopedKeyPrefix("go", directory), Checksums: []string{"d41d8cd98f00b204e9800998ecf8427e"}}}}
+		return entry.result(LookupOptions{GitBranch: branch}).Entries[0].Keys[0]
+	}
+
+	restoreKeys := func(directory, branch string) []string {
+		entry := detectedLockFile{Entries: []*detectedEntry{{KeyPrefix: scopedKeyPrefix("go", directory), Checksums: []string{"00000000000000000000000000000000"}}}}
+		return entry.result(LookupOptions{Restore: true, GitBranch: branch}).Entries[0].Keys
+	}
+
+	matches := func(keys []string, key string) bool {
+		for _, prefix := range keys {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	root := restoreKeys(".", "main")
+	assert.True(t, matches(root, storeKey(".", "main")))
+	assert.True(t, matches(root, storeKey(".", "master")))
+	assert.False(t, matches(root, storeKey(".", "main-foo")))
+	assert.False(t, matches(root, storeKey(".", "main_foo")))
+	assert.False(t, matches(root, storeKey(".", "main/foo")))
+	assert.False(t, matches(root, storeKey("main", "main")))
+	assert.False(t, matches(root, storeKey("services", "main")))
+	assert.False(t, matches(restoreKeys(".", "services"), storeKey("services", "main")))
+
+	subdirectory := restoreKeys("services", "main")
+	assert.True(t, matches(subdirectory, storeKey("services", "main")))
+	assert.False(t, matches(subdirectory, storeKey(".", "main")))
+	assert.False(t, matches(subdirectory, storeKey("services", "main-foo")))
+	assert.False(t, matches(subdirectory, storeKey(filepath.FromSlash("services/api"), "main")))
+	assert.False(t, matches(subdirectory, storeKey("services-api", "main")))
+}
@@ -0,0 +1,150 @@
+package files
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A RestoreManifest records what a path looked like right after it was restored from the cache,
+// so we can later tell if anything changed in it before storing it again.
+type RestoreManifest struct {
+	Key         string    `json:"key"`
+	Path        string    `json:"path"`
+	Fingerprint string    `json:"fingerprint"`
+	RestoredAt  time.Time `json:"restored_at"`
+}
+
+func DefaultManifestDirectory() string {
+	return filepath.Join(os.TempDir(), "cache_manifests")
+}
+
+func SaveRestoreManifest(directory, key, path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	fingerprint, err := Fingerprint(absPath)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(RestoreManifest{
+		Key:         key,
+		Path:        absPath,
+		Fingerprint: fingerprint,
+		RestoredAt:  time.Now(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(directory, 0700)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(manifestPath(directory, absPath), content, 0600)
+}
+
+// Returns nil if no manifest exists for the path.
+func FindRestoreManifest(directory, path string) (*RestoreManifest, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// #nosec
+	content, err := os.ReadFile(manifestPath(directory, absPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := RestoreManifest{}
+	err = json.Unmarshal(content, &manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+// Returns the manifest for the path, if the path was restored using the same key
+// and nothing in it changed since then. Otherwise, returns nil.
+// A path restored from a fallback key still needs to be stored under the key that missed.
+func UnchangedSinceRestore(directory, key, path string) (*RestoreManifest, error) {
+	manifest, err := FindRestoreManifest(directory, path)
+	if err != nil || manifest == nil {
+		return nil, err
+	}
+
+	if manifest.Key != key {
+		return nil, nil
+	}
+
+	fingerprint, err := Fingerprint(manifest.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if fingerprint != manifest.Fingerprint {
+		return nil, nil
+	}
+
+	return manifest, nil
+}
+
+// Fingerprint hashes the names, modes, sizes and modification times of everything in path.
+// Directory modification times are ignored, since not all archivers restore them.
+func Fingerprint(path string) (string, error) {
+	hash := sha256.New()
+	err := filepath.Walk(path, func(fileName string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(path, fileName)
+		if err != nil {
+			return err
+		}
+
+		entry := fmt.Sprintf("%s\x00%s", filepath.ToSlash(relativePath), info.Mode().String())
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(fileName)
+			if err != nil {
+				return err
+			}
+
+			entry = fmt.Sprintf("%s\x00%s", entry, link)
+		case info.Mode().IsRegular():
+			entry = fmt.Sprintf("%s\x00%d\x00%d", entry, info.Size(), info.ModTime().Unix())
+		}
+
+		_, err = hash.Write([]byte(entry + "\n"))
+		return err
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func manifestPath(directory, absPath string) string {
+	hash := sha256.Sum256([]byte(filepath.Clean(absPath)))
+	return filepath.Join(directory, hex.EncodeToString(hash[:16])+".json")
+}
@@ -0,0 +1,74 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__RestoreManifest(t *testing.T) {
+	manifestDir, _ := ioutil.TempDir(os.TempDir(), "*")
+	defer os.RemoveAll(manifestDir)
+
+	t.Run("no manifest", func(t *testing.T) {
+		manifest, err := UnchangedSinceRestore(manifestDir, "abc", "/tmp/this-path-does-not-exist")
+		assert.Nil(t, err)
+		assert.Nil(t, manifest)
+	})
+
+	t.Run("unchanged path", func(t *testing.T) {
+		tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+		defer os.RemoveAll(tempDir)
+		_ = ioutil.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("hello"), 0600)
+
+		assert.Nil(t, SaveRestoreManifest(manifestDir, "abc", tempDir+string(os.PathSeparator)))
+
+		manifest, err := UnchangedSinceRestore(manifestDir, "abc", tempDir)
+		assert.Nil(t, err)
+		if assert.NotNil(t, manifest) {
+			assert.Equal(t, "abc", manifest.Key)
+			assert.Equal(t, tempDir, manifest.Path)
+		}
+	})
+
+	t.Run("restored using another key", func(t *testing.T) {
+		tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+		defer os.RemoveAll(tempDir)
+		_ = ioutil.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("hello"), 0600)
+		assert.Nil(t, SaveRestoreManifest(manifestDir, "abc", tempDir))
+
+		manifest, err := UnchangedSinceRestore(manifestDir, "abd", tempDir)
+		assert.Nil(t, err)
+		assert.Nil(t, manifest)
+	})
+
+	t.Run("new file", func(t *testing.T) {
+		tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+		defer os.RemoveAll(tempDir)
+		_ = ioutil.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("hello"), 0600)
+		assert.Nil(t, SaveRestoreManifest(manifestDir, "abc", tempDir))
+
+		_ = ioutil.WriteFile(filepath.Join(tempDir, "b.txt"), []byte("hello"), 0600)
+		manifest, err := UnchangedSinceRestore(manifestDir, "abc", tempDir)
+		assert.Nil(t, err)
+		assert.Nil(t, manifest)
+	})
+
+	t.Run("modified file", func(t *testing.T) {
+		tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+		defer os.RemoveAll(tempDir)
+		fileName := filepath.Join(tempDir, "a.txt")
+		_ = ioutil.WriteFile(fileName, []byte("hello"), 0600)
+		assert.Nil(t, SaveRestoreManifest(manifestDir, "abc", tempDir))
+
+		later := time.Now().Add(time.Hour)
+		_ = os.Chtimes(fileName, later, later)
+		manifest, err := UnchangedSinceRestore(manifestDir, "abc", tempDir)
+		assert.Nil(t, err)
+		assert.Nil(t, manifest)
+	})
+}
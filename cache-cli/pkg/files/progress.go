@@ -0,0 +1,262 @@
+package files
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultProgressInterval = 10 * time.Second
+	TTYProgressInterval     = 500 * time.Millisecond
+)
+
+// Number of transfers currently reporting progress.
+// A single updating line only works if there's only one of them.
+var activeProgress int32
+
+// Progress reports how much of a transfer is done, its throughput and ETA.
+// On a TTY, it keeps updating a single line. Otherwise, it logs a line periodically,
+// so job logs are not flooded. Nothing is reported for transfers shorter than the interval.
+// A nil *Progress is valid, and reports nothing.
+type Progress struct {
+	Label    string
+	Total    int64
+	Interval time.Duration
+	TTY      bool
+	Output   io.Writer
+
+	done       int64
+	start      time.Time
+	lastReport time.Time
+	mutex      sync.Mutex
+	finished   bool
+	registered bool
+	now        func() time.Time
+}
+
+// Total should be -1 if unknown.
+// Progress reporting can be disabled with SEMAPHORE_CACHE_PROGRESS=false,
+// and the interval between lines changed with SEMAPHORE_CACHE_PROGRESS_INTERVAL.
+func NewProgress(label string, total int64) *Progress {
+	if os.Getenv("SEMAPHORE_CACHE_PROGRESS") == "false" {
+		return nil
+	}
+
+	tty := isTerminal(os.Stdout)
+	interval := DefaultProgressInterval
+	if tty {
+		interval = TTYProgressInterval
+	}
+
+	if value := os.Getenv("SEMAPHORE_CACHE_PROGRESS_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err == nil && parsed > 0 {
+			interval = parsed
+		}
+	}
+
+	atomic.AddInt32(&activeProgress, 1)
+	now := time.Now()
+	return &Progress{
+		Label:      label,
+		Total:      total,
+		Interval:   interval,
+		TTY:        tty,
+		Output:     os.Stdout,
+		start:      now,
+		lastReport: now,
+		registered: true,
+		now:        time.Now,
+	}
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *Progress) Add(n int64) {
+	if p == nil || n <= 0 {
+		return
+	}
+
+	atomic.AddInt64(&p.done, n)
+	p.maybeReport()
+}
+
+// Set is used when the amount of work done is observed, instead of counted.
+func (p *Progress) Set(n int64) {
+	if p == nil {
+		return
+	}
+
+	atomic.StoreInt64(&p.done, n)
+	p.maybeReport()
+}
+
+// SetTotal is used when the total is only known after the work started.
+func (p *Progress) SetTotal(total int64) {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.Total = total
+}
+
+func (p *Progress) Finish() {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.finished {
+		return
+	}
+
+	p.finished = true
+	if p.registered {
+		atomic.AddInt32(&activeProgress, -1)
+	}
+
+	// Clear the updating line, so the next message is not mixed with it.
+	if p.TTY && p.lastReport != p.start {
+		fmt.Fprint(p.Output, "\r\033[K")
+	}
+}
+
+func (p *Progress) maybeReport() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.now()
+	if p.finished || now.Sub(p.lastReport) < p.Interval {
+		return
+	}
+
+	p.lastReport = now
+	line := p.Line(now)
+	if p.TTY && atomic.LoadInt32(&activeProgress) <= 1 {
+		fmt.Fprintf(p.Output, "\r\033[K%s", line)
+		return
+	}
+
+	log.Info(line)
+}
+
+func (p *Progress) Line(now time.Time) string {
+	done := atomic.LoadInt64(&p.done)
+	elapsed := now.Sub(p.start)
+
+	var throughput float64
+	if elapsed > 0 {
+		throughput = float64(done) / elapsed.Seconds()
+	}
+
+	if p.Total <= 0 {
+		return fmt.Sprintf("%s: %s, %s/s", p.Label, HumanReadableSize(done), HumanReadableSize(int64(throughput)))
+	}
+
+	percentage := float64(done) * 100 / float64(p.Total)
+	eta := "unknown"
+	if throughput > 0 && done <= p.Total {
+		remaining := time.Duration(float64(p.Total-done) / throughput * float64(time.Second))
+		eta = remaining.Round(time.Second).String()
+	}
+
+	return fmt.Sprintf(
+		"%s: %s / %s (%.1f%%), %s/s, ETA %s",
+		p.Label,
+		HumanReadableSize(done),
+		HumanReadableSize(p.Total),
+		percentage,
+		HumanReadableSize(int64(throughput)),
+		eta,
+	)
+}
+
+// ProgressReader counts the bytes read through it.
+// If Limiter is set, reads are also throttled by it.
+type ProgressReader struct {
+	Reader   io.Reader
+	Progress *Progress
+	Limiter  *RateLimiter
+}
+
+func NewProgressReader(reader io.Reader, progress *Progress) *ProgressReader {
+	return &ProgressReader{Reader: reader, Progress: progress}
+}
+
+func (r *ProgressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.Progress.Add(int64(n))
+	r.Limiter.Wait(n)
+	return n, err
+}
+
+// ProgressFile counts the bytes read from and written to a local file.
+// Backend clients look for some of these methods to upload and download concurrently,
+// so all of them are kept. If Limiter is set, reads and writes are also throttled by it.
+type ProgressFile struct {
+	File     *os.File
+	Progress *Progress
+	Limiter  *RateLimiter
+}
+
+func NewProgressFile(file *os.File, progress *Progress) *ProgressFile {
+	return &ProgressFile{File: file, Progress: progress}
+}
+
+func (f *ProgressFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.Progress.Add(int64(n))
+	f.Limiter.Wait(n)
+	return n, err
+}
+
+func (f *ProgressFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	f.Progress.Add(int64(n))
+	f.Limiter.Wait(n)
+	return n, err
+}
+
+func (f *ProgressFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.Progress.Add(int64(n))
+	f.Limiter.Wait(n)
+	return n, err
+}
+
+func (f *ProgressFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(p, off)
+	f.Progress.Add(int64(n))
+	f.Limiter.Wait(n)
+	return n, err
+}
+
+func (f *ProgressFile) Seek(offset int64, whence int) (int64, error) {
+	return f.File.Seek(offset, whence)
+}
+
+func (f *ProgressFile) Size() int64 {
+	info, err := f.File.Stat()
+	if err != nil {
+		return -1
+	}
+
+	return info.Size()
+}
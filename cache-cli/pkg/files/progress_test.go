@@ -0,0 +1,121 @@
+package files
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func newTestProgress(total int64, tty bool, clock *time.Time) (*Progress, *bytes.Buffer) {
+	output := new(bytes.Buffer)
+	return &Progress{
+		Label:      "Uploading 'abc'",
+		Total:      total,
+		Interval:   time.Second,
+		TTY:        tty,
+		Output:     output,
+		start:      *clock,
+		lastReport: *clock,
+		now:        func() time.Time { return *clock },
+	}, output
+}
+
+func Test__ProgressLine(t *testing.T) {
+	clock := time.Now()
+
+	t.Run("with known total", func(t *testing.T) {
+		progress, _ := newTestProgress(100*1024*1024, false, &clock)
+		progress.done = 25 * 1024 * 1024
+		line := progress.Line(clock.Add(5 * time.Second))
+		assert.Equal(t, "Uploading 'abc': 25.0M / 100.0M (25.0%), 5.0M/s, ETA 15s", line)
+	})
+
+	t.Run("with unknown total", func(t *testing.T) {
+		progress, _ := newTestProgress(-1, false, &clock)
+		progress.done = 10 * 1024 * 1024
+		line := progress.Line(clock.Add(2 * time.Second))
+		assert.Equal(t, "Uploading 'abc': 10.0M, 5.0M/s", line)
+	})
+
+	t.Run("with total found later", func(t *testing.T) {
+		progress, _ := newTestProgress(-1, false, &clock)
+		progress.done = 25 * 1024 * 1024
+		progress.SetTotal(100 * 1024 * 1024)
+		line := progress.Line(clock.Add(5 * time.Second))
+		assert.Equal(t, "Uploading 'abc': 25.0M / 100.0M (25.0%), 5.0M/s, ETA 15s", line)
+	})
+
+	t.Run("without any progress", func(t *testing.T) {
+		progress, _ := newTestProgress(1024, false, &clock)
+		line := progress.Line(clock.Add(2 * time.Second))
+		assert.Equal(t, "Uploading 'abc': 0.0 / 1.0K (0.0%), 0.0/s, ETA unknown", line)
+	})
+}
+
+func Test__ProgressIsThrottled(t *testing.T) {
+	clock := time.Now()
+	progress, output := newTestProgress(1000, true, &clock)
+
+	progress.Add(100)
+	assert.Empty(t, output.String())
+
+	clock = clock.Add(500 * time.Millisecond)
+	progress.Add(100)
+	assert.Empty(t, output.String())
+
+	clock = clock.Add(time.Second)
+	progress.Add(100)
+	progress.Add(100)
+	assert.Equal(t, 1, strings.Count(output.String(), "Uploading 'abc'"))
+	assert.Contains(t, output.String(), "300.0 / 1000.0 (30.0%)")
+
+	progress.Finish()
+	assert.True(t, strings.HasSuffix(output.String(), "\r\033[K"))
+
+	// Nothing is reported after the transfer is finished.
+	clock = clock.Add(time.Minute)
+	progress.Add(100)
+	assert.Equal(t, 1, strings.Count(output.String(), "Uploading 'abc'"))
+}
+
+func Test__ProgressIsNilSafe(t *testing.T) {
+	os.Setenv("SEMAPHORE_CACHE_PROGRESS", "false")
+	defer os.Unsetenv("SEMAPHORE_CACHE_PROGRESS")
+
+	progress := NewProgress("Uploading 'abc'", 100)
+	assert.Nil(t, progress)
+
+	reader := NewProgressReader(strings.NewReader("hello"), progress)
+	data, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+	progress.Finish()
+}
+
+func Test__ProgressFile(t *testing.T) {
+	file, _ := ioutil.TempFile(os.TempDir(), "*")
+	defer os.Remove(file.Name())
+
+	clock := time.Now()
+	progress, _ := newTestProgress(-1, false, &clock)
+	progressFile := NewProgressFile(file, progress)
+
+	_, err := progressFile.Write([]byte("hello"))
+	assert.Nil(t, err)
+	_, err = progressFile.WriteAt([]byte("world"), 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), progressFile.Size())
+
+	buffer := make([]byte, 5)
+	_, err = progressFile.ReadAt(buffer, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, "world", string(buffer))
+	assert.Equal(t, int64(15), progress.done)
+
+	_ = file.Close()
+}
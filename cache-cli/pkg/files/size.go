@@ -2,6 +2,11 @@ package files
 
 import (
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 func HumanReadableSize(b int64) string {
@@ -19,3 +24,53 @@ func HumanReadableSize(b int64) string {
 
 	return fmt.Sprintf("%.1f%c", float64(b)/float64(div), "KMGTPE"[exp])
 }
+
+// Parses sizes in the same format used by HumanReadableSize, e.g. 800, 100K, 1.5G.
+// A trailing B is also accepted, so 1GB and 1G are the same.
+func ParseSize(size string) (int64, error) {
+	value := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B")
+	if value == "" {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+
+	multiplier := int64(1)
+	unitIndex := strings.IndexByte("KMGTPE", value[len(value)-1])
+	if unitIndex != -1 {
+		value = value[:len(value)-1]
+		for i := 0; i <= unitIndex; i++ {
+			multiplier *= 1024
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+
+	// float64(math.MaxInt64) is rounded up to 2^63, which doesn't fit in an int64 anymore.
+	bytes := number * float64(multiplier)
+	if bytes >= float64(math.MaxInt64) {
+		return 0, fmt.Errorf("size '%s' is too large", size)
+	}
+
+	return int64(bytes), nil
+}
+
+// Returns the total size of all regular files in path.
+// Symlinks are not followed.
+func PathSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size, err
+}
@@ -1,6 +1,9 @@
 package files
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	assert "github.com/stretchr/testify/assert"
@@ -35,3 +38,82 @@ func Test__HumanReadableSize(t *testing.T) {
 		assert.Equal(t, "5.1G", HumanReadableSize(1024*1024*1024*5+1024*1024*128))
 	})
 }
+
+func Test__PathSize(t *testing.T) {
+	t.Run("single file", func(t *testing.T) {
+		size, err := PathSize("testdata/test.txt")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(8), size)
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+		defer os.RemoveAll(tempDir)
+
+		_ = os.MkdirAll(filepath.Join(tempDir, "nested"), 0755)
+		_ = ioutil.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("hello"), 0600)
+		_ = ioutil.WriteFile(filepath.Join(tempDir, "nested", "b.txt"), []byte("world!"), 0600)
+
+		size, err := PathSize(tempDir)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(11), size)
+	})
+
+	t.Run("path does not exist", func(t *testing.T) {
+		_, err := PathSize("/tmp/this-path-does-not-exist")
+		assert.NotNil(t, err)
+	})
+}
+
+func Test__ParseSize(t *testing.T) {
+	t.Run("bytes", func(t *testing.T) {
+		size, err := ParseSize("800")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(800), size)
+	})
+
+	t.Run("units", func(t *testing.T) {
+		size, err := ParseSize("100K")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1024*100), size)
+
+		size, err = ParseSize("5m")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1024*1024*5), size)
+
+		size, err = ParseSize("1GB")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1024*1024*1024), size)
+	})
+
+	t.Run("fractions", func(t *testing.T) {
+		size, err := ParseSize("1.5G")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1024*1024*1024*3/2), size)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, value := range []string{"", "G", "abc", "-1G", "1X"} {
+			_, err := ParseSize(value)
+			assert.NotNil(t, err, value)
+		}
+	})
+
+	t.Run("non-finite", func(t *testing.T) {
+		for _, value := range []string{"NaN", "Inf", "+Inf", "infinity", "1e400", "NaNK"} {
+			_, err := ParseSize(value)
+			assert.NotNil(t, err, value)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		for _, value := range []string{"9223372036854775808", "8E", "1e19", "100000P"} {
+			_, err := ParseSize(value)
+			assert.NotNil(t, err, value)
+		}
+
+		size, err := ParseSize("7E")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(7)<<60, size)
+	})
+}
@@ -0,0 +1,145 @@
+package gocache
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An action entry points to the output produced by an action, and is stored as:
+//
+//	v1 <output ID> <size> <time in unix nanoseconds>
+//
+// The same format is used for the local directory and for the storage backend.
+type actionEntry struct {
+	OutputID []byte
+	Size     int64
+	Time     time.Time
+}
+
+func (e *actionEntry) encode() []byte {
+	return []byte(fmt.Sprintf("v1 %x %d %d\n", e.OutputID, e.Size, e.Time.UnixNano()))
+}
+
+func decodeActionEntry(content []byte) (*actionEntry, error) {
+	fields := strings.Fields(string(content))
+	if len(fields) != 4 || fields[0] != "v1" {
+		return nil, fmt.Errorf("invalid action entry '%s'", strings.TrimSpace(string(content)))
+	}
+
+	outputID, err := hex.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid output ID '%s': %v", fields[1], err)
+	}
+
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("invalid size '%s'", fields[2])
+	}
+
+	nanos, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time '%s'", fields[3])
+	}
+
+	return &actionEntry{OutputID: outputID, Size: size, Time: time.Unix(0, nanos)}, nil
+}
+
+// The local tier is a directory that the go command reads outputs from.
+// Files are spread over subdirectories named after the first byte of their ID,
+// like the go command does in its own cache.
+type diskCache struct {
+	Dir string
+}
+
+func (d *diskCache) actionPath(actionID []byte) string {
+	return d.path(actionID, "a")
+}
+
+func (d *diskCache) outputPath(outputID []byte) string {
+	return d.path(outputID, "d")
+}
+
+func (d *diskCache) path(id []byte, suffix string) string {
+	name := hex.EncodeToString(id)
+	return filepath.Join(d.Dir, name[:2], fmt.Sprintf("%s-%s", name, suffix))
+}
+
+// Returns nil if the action or its output is not in the directory.
+func (d *diskCache) get(actionID []byte) *actionEntry {
+	// #nosec
+	content, err := ioutil.ReadFile(d.actionPath(actionID))
+	if err != nil {
+		return nil
+	}
+
+	entry, err := decodeActionEntry(content)
+	if err != nil {
+		return nil
+	}
+
+	info, err := os.Stat(d.outputPath(entry.OutputID))
+	if err != nil || info.Size() != entry.Size {
+		return nil
+	}
+
+	return entry
+}
+
+func (d *diskCache) putAction(actionID []byte, entry *actionEntry) error {
+	return d.write(d.actionPath(actionID), func(w io.Writer) error {
+		_, err := w.Write(entry.encode())
+		return err
+	})
+}
+
+// Outputs are named after their contents, so an existing output is never written again.
+func (d *diskCache) putOutput(outputID []byte, size int64, write func(io.Writer) error) error {
+	path := d.outputPath(outputID)
+	if info, err := os.Stat(path); err == nil && info.Size() == size {
+		return nil
+	}
+
+	return d.write(path, write)
+}
+
+// Files are written under a temporary name and renamed,
+// so the go command never reads a partially written file.
+func (d *diskCache) write(path string, write func(io.Writer) error) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+
+	err = write(tempFile)
+	if err != nil {
+		_ = tempFile.Close()
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+
+	err = tempFile.Close()
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+
+	err = os.Rename(tempFile.Name(), path)
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+
+	return nil
+}
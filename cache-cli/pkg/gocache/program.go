@@ -0,0 +1,353 @@
+package gocache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+const DefaultKeyPrefix = "gocache-"
+const DefaultUploadParallelism = 8
+
+// Program implements the GOCACHEPROG protocol, used by the go command
+// to read and write its build cache through an external program.
+// Outputs are kept in a local directory, which the go command reads them from,
+// and shared with other jobs through the storage backend.
+// Every action and output is a separate key in the storage, prefixed with storage.BuildCacheKeyPrefix and KeyPrefix.
+// If Storage is nil, only the local directory is used.
+type Program struct {
+	Storage   storage.Storage
+	KeyPrefix string
+	ReadOnly  bool
+
+	disk        *diskCache
+	output      *bufio.Writer
+	outputMutex sync.Mutex
+	requests    sync.WaitGroup
+	uploads     sync.WaitGroup
+	uploadSlots chan struct{}
+	stats       Stats
+}
+
+type Stats struct {
+	LocalHits    int64
+	RemoteHits   int64
+	Misses       int64
+	Puts         int64
+	Uploads      int64
+	RemoteErrors int64
+}
+
+func NewProgram(dir string, storage storage.Storage, keyPrefix string, readOnly bool) *Program {
+	return &Program{
+		disk:        &diskCache{Dir: dir},
+		Storage:     storage,
+		KeyPrefix:   keyPrefix,
+		ReadOnly:    readOnly,
+		uploadSlots: make(chan struct{}, DefaultUploadParallelism),
+	}
+}
+
+func (p *Program) Stats() Stats {
+	return Stats{
+		LocalHits:    atomic.LoadInt64(&p.stats.LocalHits),
+		RemoteHits:   atomic.LoadInt64(&p.stats.RemoteHits),
+		Misses:       atomic.LoadInt64(&p.stats.Misses),
+		Puts:         atomic.LoadInt64(&p.stats.Puts),
+		Uploads:      atomic.LoadInt64(&p.stats.Uploads),
+		RemoteErrors: atomic.LoadInt64(&p.stats.RemoteErrors),
+	}
+}
+
+// Run handles requests until the go command sends a close request, or closes stdin.
+// Requests are handled concurrently, so responses might not follow the order of the requests.
+// Uploads to the storage continue in the background, and are only waited for before exiting.
+func (p *Program) Run(in io.Reader, out io.Writer) error {
+	p.output = bufio.NewWriter(out)
+	err := p.respond(&Response{ID: 0, KnownCommands: []string{CommandGet, CommandPut, CommandClose}})
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(in))
+	for {
+		var request Request
+		err := decoder.Decode(&request)
+		if err == io.EOF {
+			p.wait()
+			return nil
+		}
+
+		if err != nil {
+			p.wait()
+			return fmt.Errorf("error reading request: %v", err)
+		}
+
+		var body []byte
+		if request.Command == CommandPut && request.BodySize > 0 {
+			err := decoder.Decode(&body)
+			if err != nil {
+				p.wait()
+				return fmt.Errorf("error reading body of request %d: %v", request.ID, err)
+			}
+
+			if int64(len(body)) != request.BodySize {
+				p.wait()
+				return fmt.Errorf("body of request %d has %d bytes, expected %d", request.ID, len(body), request.BodySize)
+			}
+		}
+
+		if request.Command == CommandClose {
+			p.wait()
+			return p.respond(&Response{ID: request.ID})
+		}
+
+		p.requests.Add(1)
+		go func(request Request, body []byte) {
+			defer p.requests.Done()
+			response := p.handle(&request, body)
+			response.ID = request.ID
+			if err := p.respond(response); err != nil {
+				log.Errorf("Error sending response to request %d: %v", request.ID, err)
+			}
+		}(request, body)
+	}
+}
+
+func (p *Program) wait() {
+	p.requests.Wait()
+	p.uploads.Wait()
+
+	stats := p.Stats()
+	log.Infof(
+		"Go build cache: %d local hits, %d remote hits, %d misses, %d puts, %d uploads, %d errors.",
+		stats.LocalHits, stats.RemoteHits, stats.Misses, stats.Puts, stats.Uploads, stats.RemoteErrors,
+	)
+}
+
+func (p *Program) respond(response *Response) error {
+	p.outputMutex.Lock()
+	defer p.outputMutex.Unlock()
+
+	err := json.NewEncoder(p.output).Encode(response)
+	if err != nil {
+		return err
+	}
+
+	return p.output.Flush()
+}
+
+func (p *Program) handle(request *Request, body []byte) *Response {
+	switch request.Command {
+	case CommandGet:
+		return p.get(request)
+	case CommandPut:
+		return p.put(request, body)
+	default:
+		return &Response{Err: fmt.Sprintf("unknown command '%s'", request.Command)}
+	}
+}
+
+func (p *Program) get(request *Request) *Response {
+	if len(request.ActionID) == 0 {
+		return &Response{Err: "missing action ID"}
+	}
+
+	entry := p.disk.get(request.ActionID)
+	if entry != nil {
+		atomic.AddInt64(&p.stats.LocalHits, 1)
+		return p.hit(entry)
+	}
+
+	if p.Storage != nil {
+		entry, err := p.fetch(request.ActionID)
+		if err != nil {
+			atomic.AddInt64(&p.stats.RemoteErrors, 1)
+			log.Errorf("Error fetching action %x from the cache: %v", request.ActionID, err)
+		}
+
+		if entry != nil {
+			atomic.AddInt64(&p.stats.RemoteHits, 1)
+			return p.hit(entry)
+		}
+	}
+
+	atomic.AddInt64(&p.stats.Misses, 1)
+	return &Response{Miss: true}
+}
+
+func (p *Program) hit(entry *actionEntry) *Response {
+	return &Response{
+		OutputID: entry.OutputID,
+		Size:     entry.Size,
+		Time:     &entry.Time,
+		DiskPath: p.disk.outputPath(entry.OutputID),
+	}
+}
+
+// Downloads the action and its output from the storage into the local directory.
+// Returns nil if the action, or its output, is not in the storage.
+func (p *Program) fetch(actionID []byte) (*actionEntry, error) {
+	actionKey := p.actionKey(actionID)
+	if ok, err := p.Storage.HasKey(actionKey); err != nil || !ok {
+		return nil, err
+	}
+
+	content, err := p.restore(actionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := decodeActionEntry(content)
+	if err != nil {
+		return nil, err
+	}
+
+	// Outputs are evicted independently of the actions pointing to them,
+	// so an action whose output is gone is the same as a missing action.
+	if entry.Size > 0 {
+		ok, err := p.Storage.HasKey(p.outputKey(entry.OutputID))
+		if err != nil || !ok {
+			return nil, err
+		}
+	}
+
+	err = p.disk.putOutput(entry.OutputID, entry.Size, func(w io.Writer) error {
+		if entry.Size == 0 {
+			return nil
+		}
+
+		output, err := p.restore(p.outputKey(entry.OutputID))
+		if err != nil {
+			return err
+		}
+
+		if int64(len(output)) != entry.Size {
+			return fmt.Errorf("output %x has %d bytes, expected %d", entry.OutputID, len(output), entry.Size)
+		}
+
+		_, err = w.Write(output)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, p.disk.putAction(actionID, entry)
+}
+
+func (p *Program) restore(key string) ([]byte, error) {
+	file, err := p.Storage.Restore(key)
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(file.Name())
+	return ioutil.ReadFile(file.Name())
+}
+
+func (p *Program) put(request *Request, body []byte) *Response {
+	outputID := request.OutputID
+	if len(outputID) == 0 {
+		outputID = request.ObjectID
+	}
+
+	if len(request.ActionID) == 0 || len(outputID) == 0 {
+		return &Response{Err: "missing action or output ID"}
+	}
+
+	// Outputs are shared with other jobs, so we make sure they match their ID.
+	sum := sha256.Sum256(body)
+	if len(outputID) == sha256.Size && !bytes.Equal(sum[:], outputID) {
+		return &Response{Err: fmt.Sprintf("sha256 of the output is %s, not %x", hex.EncodeToString(sum[:]), outputID)}
+	}
+
+	atomic.AddInt64(&p.stats.Puts, 1)
+	size := int64(len(body))
+	err := p.disk.putOutput(outputID, size, func(w io.Writer) error {
+		_, err := w.Write(body)
+		return err
+	})
+
+	if err != nil {
+		return &Response{Err: fmt.Sprintf("error writing output: %v", err)}
+	}
+
+	entry := &actionEntry{OutputID: outputID, Size: size, Time: time.Now()}
+	err = p.disk.putAction(request.ActionID, entry)
+	if err != nil {
+		return &Response{Err: fmt.Sprintf("error writing action: %v", err)}
+	}
+
+	if p.Storage != nil && !p.ReadOnly {
+		p.upload(request.ActionID, entry)
+	}
+
+	return &Response{DiskPath: p.disk.outputPath(outputID)}
+}
+
+func (p *Program) upload(actionID []byte, entry *actionEntry) {
+	p.uploads.Add(1)
+	go func() {
+		defer p.uploads.Done()
+		p.uploadSlots <- struct{}{}
+		defer func() { <-p.uploadSlots }()
+
+		// The output goes first, so an action in the storage always has its output there too.
+		if entry.Size > 0 {
+			err := p.storeIfMissing(p.outputKey(entry.OutputID), p.disk.outputPath(entry.OutputID))
+			if err != nil {
+				atomic.AddInt64(&p.stats.RemoteErrors, 1)
+				log.Errorf("Error uploading output %x: %v", entry.OutputID, err)
+				return
+			}
+		}
+
+		err := p.storeIfMissing(p.actionKey(actionID), p.disk.actionPath(actionID))
+		if err != nil {
+			atomic.AddInt64(&p.stats.RemoteErrors, 1)
+			log.Errorf("Error uploading action %x: %v", actionID, err)
+		}
+	}()
+}
+
+func (p *Program) storeIfMissing(key, path string) error {
+	ok, err := p.Storage.HasKey(key)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		return nil
+	}
+
+	err = p.Storage.Store(key, path)
+	if err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&p.stats.Uploads, 1)
+	return nil
+}
+
+// Keys are kept with the other build cache keys, apart from the keys users store.
+func (p *Program) actionKey(actionID []byte) string {
+	return fmt.Sprintf("%s%sa-%x", storage.BuildCacheKeyPrefix, p.KeyPrefix, actionID)
+}
+
+func (p *Program) outputKey(outputID []byte) string {
+	return fmt.Sprintf("%s%so-%x", storage.BuildCacheKeyPrefix, p.KeyPrefix, outputID)
+}
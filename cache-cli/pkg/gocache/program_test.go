@@ -0,0 +1,302 @@
+package gocache
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	assert "github.com/stretchr/testify/assert"
+)
+
+// Keeps keys in memory, so the program can be tested without a real backend.
+type memoryStorage struct {
+	mutex sync.Mutex
+	keys  map[string][]byte
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{keys: map[string][]byte{}}
+}
+
+func (s *memoryStorage) List() ([]storage.CacheKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keys := []storage.CacheKey{}
+	for name, content := range s.keys {
+		keys = append(keys, storage.CacheKey{Name: name, Size: int64(len(content))})
+	}
+
+	return keys, nil
+}
+
+func (s *memoryStorage) HasKey(key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.keys[key]
+	return ok, nil
+}
+
+func (s *memoryStorage) Store(key, path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys[key] = content
+	return nil
+}
+
+func (s *memoryStorage) Replace(key, path string) error {
+	return s.Store(key, path)
+}
+
+func (s *memoryStorage) AcquireLock(key string) (bool, error) {
+	return true, nil
+}
+
+func (s *memoryStorage) RefreshLock(key string) error {
+	return nil
+}
+
+func (s *memoryStorage) ReleaseLock(key string) error {
+	return nil
+}
+
+func (s *memoryStorage) Restore(key string) (*os.File, error) {
+	s.mutex.Lock()
+	content, ok := s.keys[key]
+	s.mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("key '%s' does not exist", key)
+	}
+
+	file, err := ioutil.TempFile(os.TempDir(), "*")
+	if err != nil {
+		return nil, err
+	}
+
+	_, _ = file.Write(content)
+	return file, file.Close()
+}
+
+func (s *memoryStorage) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.keys, key)
+	return nil
+}
+
+func (s *memoryStorage) DeleteMany(keys []storage.CacheKey) error {
+	for _, key := range keys {
+		_ = s.Delete(key.Name)
+	}
+
+	return nil
+}
+
+func (s *memoryStorage) Clear() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys = map[string][]byte{}
+	return nil
+}
+
+func (s *memoryStorage) Usage() (*storage.UsageSummary, error) {
+	return &storage.UsageSummary{Free: -1}, nil
+}
+
+func (s *memoryStorage) IsNotEmpty() (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.keys) > 0, nil
+}
+
+func (s *memoryStorage) Config() storage.StorageConfig {
+	return storage.StorageConfig{SortKeysBy: storage.SortByStoreTime}
+}
+
+// Sends the requests like the go command does, and returns the responses by ID.
+func runProgram(t *testing.T, program *Program, requests []Request, bodies map[int64][]byte) map[int64]Response {
+	input := ""
+	for _, request := range requests {
+		line, err := json.Marshal(request)
+		assert.Nil(t, err)
+		input += string(line) + "\n"
+
+		if body, ok := bodies[request.ID]; ok && len(body) > 0 {
+			encoded, err := json.Marshal(body)
+			assert.Nil(t, err)
+			input += string(encoded) + "\n"
+		}
+	}
+
+	output, writer := io.Pipe()
+	go func() {
+		err := program.Run(strings.NewReader(input), writer)
+		assert.Nil(t, err)
+		writer.Close()
+	}()
+
+	responses := map[int64]Response{}
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		var response Response
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &response))
+		responses[response.ID] = response
+	}
+
+	return responses
+}
+
+func putRequest(id int64, actionID string, body []byte) Request {
+	sum := sha256.Sum256(body)
+	return Request{ID: id, Command: CommandPut, ActionID: []byte(actionID), OutputID: sum[:], BodySize: int64(len(body))}
+}
+
+func Test__GoCacheProg(t *testing.T) {
+	remote := newMemoryStorage()
+	body := []byte("compiled package")
+	sum := sha256.Sum256(body)
+
+	t.Run("first job misses and uploads", func(t *testing.T) {
+		dir, _ := ioutil.TempDir(os.TempDir(), "*")
+		defer os.RemoveAll(dir)
+
+		program := NewProgram(dir, remote, DefaultKeyPrefix, false)
+		responses := runProgram(t, program, []Request{
+			{ID: 1, Command: CommandGet, ActionID: []byte("action-0")},
+			putRequest(2, "action-1", body),
+			putRequest(3, "action-2", []byte{}),
+			{ID: 4, Command: CommandClose},
+		}, map[int64][]byte{2: body})
+
+		assert.Equal(t, []string{CommandGet, CommandPut, CommandClose}, responses[0].KnownCommands)
+		assert.True(t, responses[1].Miss)
+		assert.Empty(t, responses[2].Err)
+		assert.Empty(t, responses[3].Err)
+		assert.Contains(t, responses, int64(4))
+
+		content, err := ioutil.ReadFile(responses[2].DiskPath)
+		assert.Nil(t, err)
+		assert.Equal(t, body, content)
+
+		assert.Equal(t, body, remote.keys[fmt.Sprintf(storage.BuildCacheKeyPrefix+"gocache-o-%x", sum)])
+		assert.Contains(t, remote.keys, fmt.Sprintf(storage.BuildCacheKeyPrefix+"gocache-a-%x", "action-1"))
+		assert.Contains(t, remote.keys, fmt.Sprintf(storage.BuildCacheKeyPrefix+"gocache-a-%x", "action-2"))
+		assert.Equal(t, Stats{Misses: 1, Puts: 2, Uploads: 3}, program.Stats())
+	})
+
+	t.Run("second job downloads from the storage", func(t *testing.T) {
+		dir, _ := ioutil.TempDir(os.TempDir(), "*")
+		defer os.RemoveAll(dir)
+
+		program := NewProgram(dir, remote, DefaultKeyPrefix, false)
+		responses := runProgram(t, program, []Request{
+			{ID: 1, Command: CommandGet, ActionID: []byte("action-1")},
+			{ID: 2, Command: CommandGet, ActionID: []byte("action-1")},
+			{ID: 3, Command: CommandGet, ActionID: []byte("action-2")},
+			{ID: 4, Command: CommandClose},
+		}, nil)
+
+		for _, id := range []int64{1, 2} {
+			assert.False(t, responses[id].Miss)
+			assert.Equal(t, sum[:], responses[id].OutputID)
+			assert.Equal(t, int64(len(body)), responses[id].Size)
+			assert.NotNil(t, responses[id].Time)
+
+			content, err := ioutil.ReadFile(responses[id].DiskPath)
+			assert.Nil(t, err)
+			assert.Equal(t, body, content)
+		}
+
+		assert.False(t, responses[3].Miss)
+		assert.Equal(t, int64(0), responses[3].Size)
+		assert.FileExists(t, responses[3].DiskPath)
+
+		stats := program.Stats()
+		assert.Equal(t, int64(3), stats.LocalHits+stats.RemoteHits)
+		assert.Equal(t, int64(0), stats.Misses)
+	})
+
+	t.Run("read-only jobs do not upload", func(t *testing.T) {
+		dir, _ := ioutil.TempDir(os.TempDir(), "*")
+		defer os.RemoveAll(dir)
+
+		program := NewProgram(dir, remote, DefaultKeyPrefix, true)
+		other := []byte("other package")
+		responses := runProgram(t, program, []Request{
+			putRequest(1, "action-3", other),
+		}, map[int64][]byte{1: other})
+
+		assert.Empty(t, responses[1].Err)
+		assert.FileExists(t, responses[1].DiskPath)
+		assert.NotContains(t, remote.keys, fmt.Sprintf(storage.BuildCacheKeyPrefix+"gocache-a-%x", "action-3"))
+	})
+
+	t.Run("actions with evicted outputs are misses", func(t *testing.T) {
+		dir, _ := ioutil.TempDir(os.TempDir(), "*")
+		defer os.RemoveAll(dir)
+
+		delete(remote.keys, fmt.Sprintf(storage.BuildCacheKeyPrefix+"gocache-o-%x", sum))
+
+		program := NewProgram(dir, remote, DefaultKeyPrefix, true)
+		responses := runProgram(t, program, []Request{
+			{ID: 1, Command: CommandGet, ActionID: []byte("action-1")},
+		}, nil)
+
+		assert.True(t, responses[1].Miss)
+		assert.Empty(t, responses[1].Err)
+		assert.Equal(t, Stats{Misses: 1}, program.Stats())
+	})
+}
+
+func Test__GoCacheProgRejectsInvalidOutputs(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "*")
+	defer os.RemoveAll(dir)
+
+	remote := newMemoryStorage()
+	program := NewProgram(dir, remote, DefaultKeyPrefix, false)
+
+	request := putRequest(1, "action-1", []byte("expected"))
+	responses := runProgram(t, program, []Request{
+		request,
+		{ID: 2, Command: CommandGet, ActionID: []byte("action-1")},
+		{ID: 3, Command: "unknown"},
+	}, map[int64][]byte{1: []byte("modified")})
+
+	assert.Contains(t, responses[1].Err, "sha256 of the output")
+	assert.True(t, responses[2].Miss)
+	assert.Contains(t, responses[3].Err, "unknown command")
+	assert.Empty(t, remote.keys)
+}
+
+func Test__GoCacheProgLocalOnly(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "*")
+	defer os.RemoveAll(dir)
+
+	body := []byte("compiled package")
+	responses := runProgram(t, NewProgram(dir, nil, DefaultKeyPrefix, false), []Request{
+		putRequest(1, "action-1", body),
+	}, map[int64][]byte{1: body})
+	assert.Empty(t, responses[1].Err)
+
+	responses = runProgram(t, NewProgram(dir, nil, DefaultKeyPrefix, false), []Request{
+		{ID: 1, Command: CommandGet, ActionID: []byte("action-1")},
+		{ID: 2, Command: CommandGet, ActionID: []byte("action-2")},
+	}, nil)
+
+	assert.False(t, responses[1].Miss)
+	assert.Equal(t, responses[1].Size, int64(len(body)))
+	assert.True(t, responses[2].Miss)
+}
@@ -0,0 +1,37 @@
+package gocache
+
+import "time"
+
+// Commands sent by the go command to a GOCACHEPROG program.
+// See https://pkg.go.dev/cmd/go/internal/cacheprog.
+const (
+	CommandGet   = "get"
+	CommandPut   = "put"
+	CommandClose = "close"
+)
+
+// Requests are read from stdin, one JSON object at a time.
+// For puts with a body, the body follows the request as a base64-encoded JSON string.
+type Request struct {
+	ID       int64
+	Command  string
+	ActionID []byte `json:",omitempty"`
+	OutputID []byte `json:",omitempty"`
+	BodySize int64  `json:",omitempty"`
+
+	// Older Go versions send the output ID with this name.
+	ObjectID []byte `json:",omitempty"`
+}
+
+// Responses are written to stdout, and may be sent in any order.
+// The first response has ID 0, and tells the go command which commands are supported.
+type Response struct {
+	ID            int64
+	Err           string     `json:",omitempty"`
+	KnownCommands []string   `json:",omitempty"`
+	Miss          bool       `json:",omitempty"`
+	OutputID      []byte     `json:",omitempty"`
+	Size          int64      `json:",omitempty"`
+	Time          *time.Time `json:",omitempty"`
+	DiskPath      string     `json:",omitempty"`
+}
@@ -6,10 +6,18 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// When multiple cache entries are processed at the same time,
+// this field is used to tell which entry a log line belongs to.
+const PrefixField = "prefix"
+
 type CustomFormatter struct {
 }
 
 // We just care about the actual message here
 func (f *CustomFormatter) Format(entry *log.Entry) ([]byte, error) {
+	if prefix, ok := entry.Data[PrefixField]; ok {
+		return []byte(fmt.Sprintf("[%v] %s\n", prefix, entry.Message)), nil
+	}
+
 	return []byte(fmt.Sprintf("%s\n", entry.Message)), nil
 }
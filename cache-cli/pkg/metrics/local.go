@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 )
 
 type LocalMetricsManager struct {
@@ -52,40 +53,86 @@ func publishEventToFile(file string, event CacheEvent) error {
 		command = CommandRestore
 	}
 
-	corruptValue := 0
-	if event.Corrupt {
-		corruptValue = 1
-	}
-
-	durationMs := event.Duration.Milliseconds()
-	if durationMs < 0 {
-		durationMs = 0
-	}
-
 	// #nosec
 	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
 	if err != nil {
 		return err
 	}
 
-	line := fmt.Sprintf(
-		"%s,server=%s,user=%s,command=%s,corrupt=%d size=%d,duration=%d\n",
-		MeasurementName,
+	_, err = f.WriteString(formatEventLine(server, user, command, event))
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Tags and fields added after the initial version are only included when set,
+// so lines for events that don't use them look the same as before.
+// Lines in MeasurementName are counted as transfers by existing consumers,
+// so events without a transfer, like misses, go to OutcomeMeasurementName instead.
+func formatEventLine(server, user, command string, event CacheEvent) string {
+	corruptValue := 0
+	if event.Corrupt {
+		corruptValue = 1
+	}
+
+	tags := fmt.Sprintf(
+		"server=%s,user=%s,command=%s,corrupt=%d",
 		escapeTagValue(server),
 		escapeTagValue(user),
 		escapeTagValue(command),
 		corruptValue,
-		event.SizeBytes,
-		durationMs,
 	)
 
-	_, err = f.WriteString(line)
-	if err != nil {
-		_ = f.Close()
-		return err
+	if event.Result != "" {
+		tags += fmt.Sprintf(",result=%s", escapeTagValue(event.Result))
 	}
 
-	return f.Close()
+	if event.ArchiveMethod != "" {
+		tags += fmt.Sprintf(",archive_method=%s", escapeTagValue(event.ArchiveMethod))
+	}
+
+	if event.Source != "" {
+		tags += fmt.Sprintf(",source=%s", escapeTagValue(event.Source))
+	}
+
+	fields := []string{}
+	if event.HasTransfer() {
+		fields = append(fields, fmt.Sprintf("size=%d", event.SizeBytes))
+	}
+
+	if event.Result != ResultUnpacked {
+		fields = append(fields, fmt.Sprintf("duration=%d", nonNegativeMs(event.Duration)))
+	}
+
+	if event.IsHit() {
+		fields = append(fields, fmt.Sprintf("key_index=%d", event.KeyIndex))
+	}
+
+	if event.CompressionDuration > 0 {
+		fields = append(fields, fmt.Sprintf("compression_duration=%d", nonNegativeMs(event.CompressionDuration)))
+	}
+
+	if event.UnpackDuration > 0 || event.Result == ResultUnpacked {
+		fields = append(fields, fmt.Sprintf("unpack_duration=%d", nonNegativeMs(event.UnpackDuration)))
+	}
+
+	measurement := MeasurementName
+	if !event.HasTransfer() {
+		measurement = OutcomeMeasurementName
+	}
+
+	return fmt.Sprintf("%s,%s %s\n", measurement, tags, strings.Join(fields, ","))
+}
+
+func nonNegativeMs(duration time.Duration) int64 {
+	if duration < 0 {
+		return 0
+	}
+
+	return duration.Milliseconds()
 }
 
 func escapeTagValue(value string) string {
@@ -58,6 +58,60 @@ func TestLogEventMarksCorruption(t *testing.T) {
 	os.Remove(metricsManager.ToolboxMetricsPath)
 }
 
+func TestLogEventWritesResultAndDurations(t *testing.T) {
+	os.Setenv("SEMAPHORE_TOOLBOX_METRICS_ENABLED", "true")
+	os.Setenv("SEMAPHORE_CACHE_USERNAME", "tester")
+	os.Setenv("SEMAPHORE_CACHE_URL", "10.0.0.5:1234")
+
+	metricsManager, err := NewLocalMetricsBackend()
+	assert.Nil(t, err)
+
+	event := CacheEvent{
+		Command:        CommandRestore,
+		Result:         ResultPartialHit,
+		KeyIndex:       2,
+		ArchiveMethod:  "native-parallel",
+		SizeBytes:      2048,
+		Duration:       time.Second,
+		UnpackDuration: 2 * time.Second,
+		Source:         SourceCDN,
+	}
+
+	err = metricsManager.LogEvent(event)
+	assert.Nil(t, err)
+
+	bytes, err := ioutil.ReadFile(metricsManager.ToolboxMetricsPath)
+	assert.Nil(t, err)
+	assert.Contains(t, string(bytes), "usercache,server=10.0.0.5,user=tester,command=restore,corrupt=0,result=partial-hit,archive_method=native-parallel,source=cdn size=2048,duration=1000,key_index=2,unpack_duration=2000")
+
+	os.Remove(metricsManager.ToolboxMetricsPath)
+}
+
+func TestLogEventWithoutTransfer(t *testing.T) {
+	os.Setenv("SEMAPHORE_TOOLBOX_METRICS_ENABLED", "true")
+	os.Setenv("SEMAPHORE_CACHE_USERNAME", "tester")
+	os.Setenv("SEMAPHORE_CACHE_URL", "10.0.0.5:1234")
+
+	metricsManager, err := NewLocalMetricsBackend()
+	assert.Nil(t, err)
+
+	assert.Nil(t, metricsManager.LogEvent(CacheEvent{Command: CommandRestore, Result: ResultMiss}))
+	assert.Nil(t, metricsManager.LogEvent(CacheEvent{Command: CommandStore, Result: ResultSkipped}))
+	assert.Nil(t, metricsManager.LogEvent(CacheEvent{Command: CommandRestore, Result: ResultUnpacked, UnpackDuration: 2 * time.Second}))
+
+	bytes, err := ioutil.ReadFile(metricsManager.ToolboxMetricsPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "usercache_outcome,server=10.0.0.5,user=tester,command=restore,corrupt=0,result=miss duration=0\n"+
+		"usercache_outcome,server=10.0.0.5,user=tester,command=store,corrupt=0,result=skipped duration=0\n"+
+		"usercache_outcome,server=10.0.0.5,user=tester,command=restore,corrupt=0,result=unpacked unpack_duration=2000\n", string(bytes))
+
+	events, err := ReadEvents(metricsManager.ToolboxMetricsPath)
+	assert.Nil(t, err)
+	assert.Len(t, events, 3)
+
+	os.Remove(metricsManager.ToolboxMetricsPath)
+}
+
 func TestLogEventDisabled(t *testing.T) {
 	os.Setenv("SEMAPHORE_TOOLBOX_METRICS_ENABLED", "false")
 	metricsManager, err := NewLocalMetricsBackend()
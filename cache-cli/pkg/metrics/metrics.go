@@ -3,15 +3,34 @@ package metrics
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
 const (
-	LocalBackend = "local"
+	LocalBackend      = "local"
+	StatsDBackend     = "statsd"
+	PrometheusBackend = "prometheus"
+	OTLPBackend       = "otlp"
+
+	MeasurementName        = "usercache"
+	OutcomeMeasurementName = "usercache_outcome"
+	CommandStore           = "store"
+	CommandRestore         = "restore"
+
+	ResultHit        = "hit"
+	ResultPartialHit = "partial-hit"
+	ResultMiss       = "miss"
+	ResultStored     = "stored"
+	ResultSkipped    = "skipped"
+	ResultUnpacked   = "unpacked"
 
-	MeasurementName = "usercache"
-	CommandStore    = "store"
-	CommandRestore  = "restore"
+	SourceStorage         = "storage"
+	SourceCDN             = "cdn"
+	SourceStorageFallback = "storage-fallback"
 )
 
 type CacheEvent struct {
@@ -21,6 +40,30 @@ type CacheEvent struct {
 	SizeBytes int64
 	Duration  time.Duration
 	Corrupt   bool
+
+	// Result is one of the Result* constants.
+	// For hits, KeyIndex is the position of the matched key in the list of keys used.
+	// Restores publish their event once the key is downloaded, and unpacking is only timed afterwards,
+	// so the unpack duration is published in an additional event, with ResultUnpacked.
+	// Events without a transfer are kept apart from the ones with, see HasTransfer.
+	Result              string
+	KeyIndex            int
+	ArchiveMethod       string
+	CompressionDuration time.Duration
+	UnpackDuration      time.Duration
+
+	// Source is where a restored key was downloaded from, one of the Source* constants.
+	// SourceStorageFallback means the CDN was used first, but the download failed.
+	Source string
+}
+
+func (e *CacheEvent) IsHit() bool {
+	return e.Result == ResultHit || e.Result == ResultPartialHit
+}
+
+// Misses, skipped stores and unpack events have nothing transferred, so no size is recorded for them.
+func (e *CacheEvent) HasTransfer() bool {
+	return e.Result != ResultMiss && e.Result != ResultSkipped && e.Result != ResultUnpacked
 }
 
 type MetricsManager interface {
@@ -32,7 +75,47 @@ func InitMetricsManager(backend string) (MetricsManager, error) {
 	switch backend {
 	case LocalBackend:
 		return NewLocalMetricsBackend()
+	case StatsDBackend:
+		return NewStatsDMetricsBackend()
+	case PrometheusBackend:
+		return NewPrometheusMetricsBackend()
+	case OTLPBackend:
+		return NewOTLPMetricsBackend()
 	default:
 		return nil, fmt.Errorf("metrics backend '%s' is not available", backend)
 	}
 }
+
+// The local backend is always used, since cache stats are read from it.
+// Other backends are a comma-separated list in SEMAPHORE_CACHE_METRICS_BACKENDS.
+// Metrics should never prevent the cache from being used,
+// so backends that can't be initialized are skipped.
+func InitMetricsManagerFromEnv() MetricsManager {
+	backends := []string{LocalBackend}
+	for _, backend := range strings.Split(os.Getenv("SEMAPHORE_CACHE_METRICS_BACKENDS"), ",") {
+		backend = strings.TrimSpace(backend)
+		if backend != "" && backend != LocalBackend {
+			backends = append(backends, backend)
+		}
+	}
+
+	managers := []MetricsManager{}
+	for _, backend := range backends {
+		manager, err := InitMetricsManager(backend)
+		if err != nil {
+			log.Errorf("Error initializing metrics backend '%s': %v - proceeding without it.", backend, err)
+			continue
+		}
+
+		managers = append(managers, manager)
+	}
+
+	switch len(managers) {
+	case 0:
+		return NewNoOpMetricsManager()
+	case 1:
+		return managers[0]
+	default:
+		return NewMultiMetricsManager(managers...)
+	}
+}
@@ -0,0 +1,39 @@
+//revive:disable-next-line:var-naming
+package metrics
+
+import "errors"
+
+// Sends every event to all the managers it holds.
+// An error in one of them does not prevent the others from receiving the event.
+type MultiMetricsManager struct {
+	Managers []MetricsManager
+}
+
+func NewMultiMetricsManager(managers ...MetricsManager) *MultiMetricsManager {
+	return &MultiMetricsManager{Managers: managers}
+}
+
+func (m *MultiMetricsManager) Enabled() bool {
+	for _, manager := range m.Managers {
+		if manager.Enabled() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *MultiMetricsManager) LogEvent(event CacheEvent) error {
+	errs := []error{}
+	for _, manager := range m.Managers {
+		if !manager.Enabled() {
+			continue
+		}
+
+		if err := manager.LogEvent(event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,274 @@
+//revive:disable-next-line:var-naming
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLP aggregation temporality: every event is sent as a delta since the previous one.
+const otlpAggregationTemporalityDelta = 1
+
+// Events are exported as they happen, so a slow or unreachable collector
+// could delay every store and restore. Each export gives up after OTLPRequestTimeout,
+// and once exports took OTLPExportBudget in total, or one of them timed out,
+// the remaining events of the process are dropped.
+const OTLPRequestTimeout = 2 * time.Second
+const OTLPExportBudget = 5 * time.Second
+
+// Exports events to an OpenTelemetry collector using OTLP/HTTP with JSON encoding.
+// The standard OTEL_EXPORTER_OTLP_* environment variables are used for the endpoint and headers.
+type OTLPMetricsManager struct {
+	Endpoint string
+	Headers  map[string]string
+	Client   *http.Client
+
+	// If set, limits the total time spent exporting events.
+	Budget time.Duration
+
+	mutex     sync.Mutex
+	spent     time.Duration
+	exhausted bool
+}
+
+func NewOTLPMetricsBackend() (*OTLPMetricsManager, error) {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil, fmt.Errorf("no OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_METRICS_ENDPOINT set")
+		}
+
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/metrics"
+	}
+
+	headers := os.Getenv("OTEL_EXPORTER_OTLP_METRICS_HEADERS")
+	if headers == "" {
+		headers = os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")
+	}
+
+	return &OTLPMetricsManager{
+		Endpoint: endpoint,
+		Headers:  parseOTLPHeaders(headers),
+		Client:   &http.Client{Timeout: OTLPRequestTimeout},
+		Budget:   OTLPExportBudget,
+	}, nil
+}
+
+func (b *OTLPMetricsManager) Enabled() bool {
+	return true
+}
+
+func (b *OTLPMetricsManager) LogEvent(event CacheEvent) error {
+	body, err := json.Marshal(otlpRequest(event, time.Now()))
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if b.Budget > 0 {
+		remaining, ok := b.remaining()
+		if !ok {
+			return b.exhaust()
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, remaining)
+		defer cancel()
+
+		start := time.Now()
+		defer func() { b.spend(time.Since(start)) }()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, b.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range b.Headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := b.Client.Do(request)
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return b.exhaust()
+		}
+
+		return err
+	}
+
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("OTLP endpoint '%s' responded with %d", b.Endpoint, response.StatusCode)
+	}
+
+	return nil
+}
+
+// Returns how much of the budget is left for the next export.
+func (b *OTLPMetricsManager) remaining() (time.Duration, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	remaining := b.Budget - b.spent
+	return remaining, !b.exhausted && remaining > 0
+}
+
+func (b *OTLPMetricsManager) spend(duration time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.spent += duration
+}
+
+// Dropping events is only reported once, and not for every event after that.
+func (b *OTLPMetricsManager) exhaust() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.exhausted {
+		return nil
+	}
+
+	b.exhausted = true
+	return fmt.Errorf("OTLP endpoint '%s' is too slow - the remaining events are dropped", b.Endpoint)
+}
+
+// Headers are in the format key1=value1,key2=value2.
+func parseOTLPHeaders(value string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			continue
+		}
+
+		headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return headers
+}
+
+type otlpAttribute struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsInt             string          `json:"asInt"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpMetric struct {
+	Name string  `json:"name"`
+	Unit string  `json:"unit"`
+	Sum  otlpSum `json:"sum"`
+}
+
+func otlpRequest(event CacheEvent, now time.Time) map[string]interface{} {
+	command := event.Command
+	if command == "" {
+		command = CommandRestore
+	}
+
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+	point := func(value int64, attributes ...otlpAttribute) otlpDataPoint {
+		return otlpDataPoint{
+			Attributes:        append([]otlpAttribute{otlpStringAttribute("command", command)}, attributes...),
+			StartTimeUnixNano: timestamp,
+			TimeUnixNano:      timestamp,
+			AsInt:             strconv.FormatInt(value, 10),
+		}
+	}
+
+	sum := func(name, unit string, points ...otlpDataPoint) otlpMetric {
+		return otlpMetric{
+			Name: name,
+			Unit: unit,
+			Sum:  otlpSum{DataPoints: points, AggregationTemporality: otlpAggregationTemporalityDelta, IsMonotonic: true},
+		}
+	}
+
+	metrics := []otlpMetric{}
+	if event.Corrupt {
+		metrics = append(metrics, sum("cache.corrupt_archives", "1", point(1)))
+	} else {
+		result := event.Result
+		if result == "" {
+			result = "unknown"
+		}
+
+		if event.Result != ResultUnpacked {
+			metrics = append(metrics, sum("cache.operations", "1", point(1,
+				otlpStringAttribute("result", result),
+				otlpStringAttribute("archive_method", event.ArchiveMethod),
+				otlpStringAttribute("source", event.Source),
+			)))
+		}
+
+		if event.SizeBytes > 0 {
+			metrics = append(metrics, sum("cache.bytes", "By", point(event.SizeBytes)))
+		}
+
+		durations := []otlpDataPoint{}
+		for _, phase := range []struct {
+			name     string
+			duration time.Duration
+		}{
+			{"transfer", event.Duration},
+			{"compression", event.CompressionDuration},
+			{"unpack", event.UnpackDuration},
+		} {
+			if phase.duration > 0 {
+				durations = append(durations, point(phase.duration.Milliseconds(), otlpStringAttribute("phase", phase.name)))
+			}
+		}
+
+		if len(durations) > 0 {
+			metrics = append(metrics, sum("cache.duration", "ms", durations...))
+		}
+	}
+
+	return map[string]interface{}{
+		"resourceMetrics": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpAttribute{otlpStringAttribute("service.name", "cache-cli")},
+				},
+				"scopeMetrics": []interface{}{
+					map[string]interface{}{
+						"scope":   map[string]string{"name": "github.com/semaphoreci/toolbox/cache-cli"},
+						"metrics": metrics,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpStringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]string{"stringValue": value}}
+}
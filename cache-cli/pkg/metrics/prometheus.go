@@ -0,0 +1,215 @@
+//revive:disable-next-line:var-naming
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const PrometheusTextfileName = "semaphore_cache.prom"
+
+var prometheusMetricHelp = map[string]string{
+	"semaphore_cache_operations_total":            "Number of cache operations, by command and result.",
+	"semaphore_cache_bytes_total":                 "Bytes transferred by cache operations.",
+	"semaphore_cache_duration_milliseconds_total": "Time spent on cache operations, by phase.",
+	"semaphore_cache_corrupt_archives_total":      "Number of corrupt archives found while restoring.",
+}
+
+// Writes counters to a file read by the node-exporter textfile collector.
+// Every cache command runs in its own process, so the counters are read from the file,
+// incremented, and written back. The file is replaced atomically,
+// and a lock file is used to avoid losing updates from concurrent processes.
+type PrometheusMetricsManager struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+func NewPrometheusMetricsBackend() (*PrometheusMetricsManager, error) {
+	directory := os.Getenv("SEMAPHORE_CACHE_PROMETHEUS_TEXTFILE_DIR")
+	if directory == "" {
+		return nil, fmt.Errorf("no SEMAPHORE_CACHE_PROMETHEUS_TEXTFILE_DIR set")
+	}
+
+	return &PrometheusMetricsManager{Path: filepath.Join(directory, PrometheusTextfileName)}, nil
+}
+
+func (b *PrometheusMetricsManager) Enabled() bool {
+	return true
+}
+
+func (b *PrometheusMetricsManager) LogEvent(event CacheEvent) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	unlock, err := lockFile(b.Path + ".lock")
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	counters, err := readPrometheusCounters(b.Path)
+	if err != nil {
+		return err
+	}
+
+	for series, value := range prometheusSeries(event) {
+		counters[series] += value
+	}
+
+	return writePrometheusCounters(b.Path, counters)
+}
+
+func prometheusSeries(event CacheEvent) map[string]float64 {
+	command := event.Command
+	if command == "" {
+		command = CommandRestore
+	}
+
+	if event.Corrupt {
+		return map[string]float64{"semaphore_cache_corrupt_archives_total": 1}
+	}
+
+	result := event.Result
+	if result == "" {
+		result = "unknown"
+	}
+
+	series := map[string]float64{}
+	if event.Result != ResultUnpacked {
+		series[fmt.Sprintf(`semaphore_cache_operations_total{command="%s",result="%s"}`, command, result)] = 1
+	}
+
+	if event.SizeBytes > 0 {
+		series[fmt.Sprintf(`semaphore_cache_bytes_total{command="%s"}`, command)] = float64(event.SizeBytes)
+	}
+
+	phases := map[string]time.Duration{
+		"transfer":    event.Duration,
+		"compression": event.CompressionDuration,
+		"unpack":      event.UnpackDuration,
+	}
+
+	for phase, duration := range phases {
+		if duration > 0 {
+			name := fmt.Sprintf(`semaphore_cache_duration_milliseconds_total{command="%s",phase="%s"}`, command, phase)
+			series[name] = float64(duration.Milliseconds())
+		}
+	}
+
+	return series
+}
+
+func readPrometheusCounters(path string) (map[string]float64, error) {
+	counters := map[string]float64{}
+
+	// #nosec
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return counters, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		separator := strings.LastIndex(line, " ")
+		if separator == -1 {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(line[separator+1:], 64)
+		if err != nil {
+			continue
+		}
+
+		counters[line[:separator]] = value
+	}
+
+	return counters, scanner.Err()
+}
+
+func writePrometheusCounters(path string, counters map[string]float64) error {
+	series := []string{}
+	for name := range counters {
+		series = append(series, name)
+	}
+
+	sort.Strings(series)
+
+	content := strings.Builder{}
+	lastMetric := ""
+	for _, name := range series {
+		metric := name
+		if i := strings.Index(name, "{"); i != -1 {
+			metric = name[:i]
+		}
+
+		if metric != lastMetric {
+			content.WriteString(fmt.Sprintf("# HELP %s %s\n", metric, prometheusMetricHelp[metric]))
+			content.WriteString(fmt.Sprintf("# TYPE %s counter\n", metric))
+			lastMetric = metric
+		}
+
+		content.WriteString(fmt.Sprintf("%s %s\n", name, strconv.FormatFloat(counters[name], 'f', -1, 64)))
+	}
+
+	// The collector might read the file at any point,
+	// so we write it somewhere else first, and then move it into place.
+	tmpPath := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+
+	// #nosec
+	err := os.WriteFile(tmpPath, []byte(content.String()), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// Lock files older than this are considered abandoned by a process that died while holding it.
+const lockFileStaleAfter = 10 * time.Second
+
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// #nosec
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_ = f.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > lockFileStaleAfter {
+			_ = os.Remove(path)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock '%s'", path)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,252 @@
+//revive:disable-next-line:var-naming
+package metrics
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestStatsDSendsMetrics(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	manager := &StatsDMetricsManager{Address: listener.LocalAddr().String(), Prefix: "cache"}
+	err = manager.LogEvent(CacheEvent{
+		Command:        CommandRestore,
+		Result:         ResultHit,
+		SizeBytes:      2048,
+		Duration:       time.Second,
+		UnpackDuration: 2 * time.Second,
+	})
+	assert.Nil(t, err)
+
+	buffer := make([]byte, 1024)
+	_ = listener.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := listener.ReadFrom(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, "cache.restore.hit:1|c\n"+
+		"cache.restore.bytes:2048|c\n"+
+		"cache.restore.duration:1000|ms\n"+
+		"cache.restore.unpack_duration:2000|ms", string(buffer[:n]))
+}
+
+func TestStatsDCorruption(t *testing.T) {
+	manager := &StatsDMetricsManager{Prefix: "ci.cache"}
+	lines := manager.formatEvent(CacheEvent{Command: CommandRestore, Corrupt: true})
+	assert.Equal(t, []string{"ci.cache.restore.corrupt:1|c"}, lines)
+}
+
+func TestPrometheusAccumulatesCounters(t *testing.T) {
+	tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("SEMAPHORE_CACHE_PROMETHEUS_TEXTFILE_DIR", tempDir)
+	defer os.Unsetenv("SEMAPHORE_CACHE_PROMETHEUS_TEXTFILE_DIR")
+
+	manager, err := NewPrometheusMetricsBackend()
+	assert.Nil(t, err)
+
+	assert.Nil(t, manager.LogEvent(CacheEvent{Command: CommandRestore, Result: ResultHit, SizeBytes: 100, Duration: time.Second}))
+	assert.Nil(t, manager.LogEvent(CacheEvent{Command: CommandRestore, Result: ResultHit, SizeBytes: 50, Duration: time.Second}))
+	assert.Nil(t, manager.LogEvent(CacheEvent{Command: CommandRestore, Result: ResultMiss}))
+	assert.Nil(t, manager.LogEvent(CacheEvent{Command: CommandRestore, Corrupt: true}))
+
+	// A new process reads what the previous one wrote.
+	other, _ := NewPrometheusMetricsBackend()
+	assert.Nil(t, other.LogEvent(CacheEvent{Command: CommandStore, Result: ResultStored, SizeBytes: 10, CompressionDuration: time.Second}))
+
+	content, err := ioutil.ReadFile(filepath.Join(tempDir, PrometheusTextfileName))
+	assert.Nil(t, err)
+
+	output := string(content)
+	assert.Contains(t, output, "# TYPE semaphore_cache_operations_total counter\n")
+	assert.Contains(t, output, `semaphore_cache_operations_total{command="restore",result="hit"} 2`)
+	assert.Contains(t, output, `semaphore_cache_operations_total{command="restore",result="miss"} 1`)
+	assert.Contains(t, output, `semaphore_cache_operations_total{command="store",result="stored"} 1`)
+	assert.Contains(t, output, `semaphore_cache_bytes_total{command="restore"} 150`)
+	assert.Contains(t, output, `semaphore_cache_duration_milliseconds_total{command="restore",phase="transfer"} 2000`)
+	assert.Contains(t, output, `semaphore_cache_duration_milliseconds_total{command="store",phase="compression"} 1000`)
+	assert.Contains(t, output, "semaphore_cache_corrupt_archives_total 1")
+
+	_, err = os.Stat(filepath.Join(tempDir, PrometheusTextfileName+".lock"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPrometheusConcurrentEvents(t *testing.T) {
+	tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+	defer os.RemoveAll(tempDir)
+
+	manager := &PrometheusMetricsManager{Path: filepath.Join(tempDir, PrometheusTextfileName)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, manager.LogEvent(CacheEvent{Command: CommandRestore, Result: ResultHit}))
+		}()
+	}
+
+	wg.Wait()
+
+	counters, err := readPrometheusCounters(manager.Path)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(10), counters[`semaphore_cache_operations_total{command="restore",result="hit"}`])
+}
+
+func TestOTLPExportsMetrics(t *testing.T) {
+	var received map[string]interface{}
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		assert.Equal(t, "/v1/metrics", r.URL.Path)
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", server.URL+"/")
+	os.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "x-api-key=secret, x-other=1")
+	defer os.Unsetenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	defer os.Unsetenv("OTEL_EXPORTER_OTLP_HEADERS")
+
+	manager, err := NewOTLPMetricsBackend()
+	assert.Nil(t, err)
+
+	err = manager.LogEvent(CacheEvent{Command: CommandStore, Result: ResultStored, SizeBytes: 10, Duration: time.Second})
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", headers.Get("x-api-key"))
+	assert.Equal(t, "application/json", headers.Get("Content-Type"))
+
+	content, _ := json.Marshal(received)
+	assert.Contains(t, string(content), `"name":"cache.operations"`)
+	assert.Contains(t, string(content), `"name":"cache.bytes"`)
+	assert.Contains(t, string(content), `"name":"cache.duration"`)
+	assert.Contains(t, string(content), `{"key":"result","value":{"stringValue":"stored"}}`)
+}
+
+func TestOTLPErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	manager := &OTLPMetricsManager{Endpoint: server.URL, Client: http.DefaultClient}
+	err := manager.LogEvent(CacheEvent{Command: CommandRestore, Result: ResultMiss})
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "responded with 400"))
+}
+
+func TestOTLPStopsExportingAfterBudget(t *testing.T) {
+	requests := 0
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	manager := &OTLPMetricsManager{Endpoint: server.URL, Client: http.DefaultClient, Budget: 50 * time.Millisecond}
+	err := manager.LogEvent(CacheEvent{Command: CommandRestore, Result: ResultMiss})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "the remaining events are dropped")
+	}
+
+	// Only the first dropped event is reported.
+	start := time.Now()
+	assert.Nil(t, manager.LogEvent(CacheEvent{Command: CommandRestore, Result: ResultMiss}))
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, 1, requests)
+}
+
+func TestOTLPBudgetOnlyCountsExportTime(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	manager := &OTLPMetricsManager{Endpoint: server.URL, Client: http.DefaultClient, Budget: 50 * time.Millisecond}
+	assert.Nil(t, manager.LogEvent(CacheEvent{Command: CommandStore, Result: ResultStored}))
+
+	// A long store or restore between events does not use up the budget.
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, manager.LogEvent(CacheEvent{Command: CommandRestore, Result: ResultHit}))
+	assert.Equal(t, 2, requests)
+}
+
+func TestOTLPStopsExportingAfterTimeout(t *testing.T) {
+	requests := 0
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := &http.Client{Timeout: 20 * time.Millisecond}
+	manager := &OTLPMetricsManager{Endpoint: server.URL, Client: client, Budget: time.Minute}
+	err := manager.LogEvent(CacheEvent{Command: CommandRestore, Result: ResultMiss})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "the remaining events are dropped")
+	}
+
+	assert.Nil(t, manager.LogEvent(CacheEvent{Command: CommandRestore, Result: ResultMiss}))
+	assert.Equal(t, 1, requests)
+}
+
+func TestInitMetricsManagerFromEnv(t *testing.T) {
+	t.Run("defaults to local", func(t *testing.T) {
+		os.Unsetenv("SEMAPHORE_CACHE_METRICS_BACKENDS")
+		manager := InitMetricsManagerFromEnv()
+		assert.IsType(t, &LocalMetricsManager{}, manager)
+	})
+
+	t.Run("multiple backends", func(t *testing.T) {
+		os.Setenv("SEMAPHORE_CACHE_METRICS_BACKENDS", "local, statsd")
+		defer os.Unsetenv("SEMAPHORE_CACHE_METRICS_BACKENDS")
+
+		manager := InitMetricsManagerFromEnv()
+		if assert.IsType(t, &MultiMetricsManager{}, manager) {
+			assert.Len(t, manager.(*MultiMetricsManager).Managers, 2)
+		}
+	})
+
+	t.Run("local is always used", func(t *testing.T) {
+		os.Setenv("SEMAPHORE_CACHE_METRICS_BACKENDS", "statsd")
+		defer os.Unsetenv("SEMAPHORE_CACHE_METRICS_BACKENDS")
+
+		manager := InitMetricsManagerFromEnv()
+		if assert.IsType(t, &MultiMetricsManager{}, manager) {
+			managers := manager.(*MultiMetricsManager).Managers
+			if assert.Len(t, managers, 2) {
+				assert.IsType(t, &LocalMetricsManager{}, managers[0])
+				assert.IsType(t, &StatsDMetricsManager{}, managers[1])
+			}
+		}
+	})
+
+	t.Run("skips backends that can't be initialized", func(t *testing.T) {
+		os.Setenv("SEMAPHORE_CACHE_METRICS_BACKENDS", "prometheus,does-not-exist")
+		os.Unsetenv("SEMAPHORE_CACHE_PROMETHEUS_TEXTFILE_DIR")
+		defer os.Unsetenv("SEMAPHORE_CACHE_METRICS_BACKENDS")
+
+		manager := InitMetricsManagerFromEnv()
+		assert.IsType(t, &LocalMetricsManager{}, manager)
+	})
+}
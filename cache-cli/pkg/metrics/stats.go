@@ -0,0 +1,241 @@
+//revive:disable-next-line:var-naming
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Summary struct {
+	Restores       RestoreSummary `json:"restores"`
+	Stores         StoreSummary   `json:"stores"`
+	ArchiveMethods map[string]int `json:"archive_methods"`
+}
+
+type RestoreSummary struct {
+	Total           int            `json:"total"`
+	Hits            int            `json:"hits"`
+	PartialHits     int            `json:"partial_hits"`
+	Misses          int            `json:"misses"`
+	Corrupt         int            `json:"corrupt"`
+	HitRate         float64        `json:"hit_rate"`
+	BytesDownloaded int64          `json:"bytes_downloaded"`
+	AvgDownloadMs   int64          `json:"avg_download_ms"`
+	AvgUnpackMs     int64          `json:"avg_unpack_ms"`
+	HitsByKeyIndex  map[int]int    `json:"hits_by_key_index"`
+	Sources         map[string]int `json:"sources"`
+}
+
+type StoreSummary struct {
+	Total            int   `json:"total"`
+	Stored           int   `json:"stored"`
+	Skipped          int   `json:"skipped"`
+	BytesUploaded    int64 `json:"bytes_uploaded"`
+	AvgUploadMs      int64 `json:"avg_upload_ms"`
+	AvgCompressionMs int64 `json:"avg_compression_ms"`
+}
+
+// Reads the events written by publishEventToFile.
+// Lines that can't be parsed are ignored.
+func ReadEvents(path string) ([]CacheEvent, error) {
+	// #nosec
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	events := []CacheEvent{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		event, err := parseEventLine(scanner.Text())
+		if err != nil {
+			continue
+		}
+
+		if event.Command == CommandStore || event.Command == CommandRestore {
+			events = append(events, *event)
+		}
+	}
+
+	return events, scanner.Err()
+}
+
+func parseEventLine(line string) (*CacheEvent, error) {
+	parts := splitUnescaped(strings.TrimSpace(line), ' ')
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid line '%s'", line)
+	}
+
+	tags := splitUnescaped(parts[0], ',')
+	if tags[0] != MeasurementName && tags[0] != OutcomeMeasurementName {
+		return nil, fmt.Errorf("unknown measurement '%s'", tags[0])
+	}
+
+	event := CacheEvent{}
+	for _, tag := range tags[1:] {
+		name, value := splitKeyValue(tag)
+		switch name {
+		case "server":
+			event.Server = value
+		case "user":
+			event.User = value
+		case "command":
+			event.Command = value
+		case "corrupt":
+			event.Corrupt = value == "1"
+		case "result":
+			event.Result = value
+		case "archive_method":
+			event.ArchiveMethod = value
+		case "source":
+			event.Source = value
+		}
+	}
+
+	for _, field := range splitUnescaped(parts[1], ',') {
+		name, value := splitKeyValue(field)
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for field '%s': %v", name, err)
+		}
+
+		switch name {
+		case "size":
+			event.SizeBytes = number
+		case "duration":
+			event.Duration = time.Duration(number) * time.Millisecond
+		case "key_index":
+			event.KeyIndex = int(number)
+		case "compression_duration":
+			event.CompressionDuration = time.Duration(number) * time.Millisecond
+		case "unpack_duration":
+			event.UnpackDuration = time.Duration(number) * time.Millisecond
+		}
+	}
+
+	return &event, nil
+}
+
+func splitUnescaped(value string, separator rune) []string {
+	parts := []string{}
+	current := strings.Builder{}
+	escaped := false
+	for _, c := range value {
+		switch {
+		case escaped:
+			current.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			current.WriteRune(c)
+			escaped = true
+		case c == separator:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(c)
+		}
+	}
+
+	return append(parts, current.String())
+}
+
+func splitKeyValue(pair string) (string, string) {
+	parts := splitUnescaped(pair, '=')
+	if len(parts) < 2 {
+		return unescapeTagValue(parts[0]), ""
+	}
+
+	return unescapeTagValue(parts[0]), unescapeTagValue(strings.Join(parts[1:], "="))
+}
+
+func unescapeTagValue(value string) string {
+	replacer := strings.NewReplacer("\\,", ",", "\\ ", " ", "\\=", "=")
+	return replacer.Replace(value)
+}
+
+// Events written before results were recorded only exist for successful downloads and uploads,
+// so restores without a result are counted as hits, and stores without a result as stored.
+// Corruption and unpack events are only counted as such, since they are published in addition to the restore event.
+func Summarize(events []CacheEvent) Summary {
+	summary := Summary{
+		ArchiveMethods: map[string]int{},
+		Restores:       RestoreSummary{HitsByKeyIndex: map[int]int{}, Sources: map[string]int{}},
+	}
+
+	var downloadMs, unpackMs, uploadMs, compressionMs int64
+	for _, event := range events {
+		if event.ArchiveMethod != "" {
+			summary.ArchiveMethods[event.ArchiveMethod]++
+		}
+
+		if event.Command == CommandRestore {
+			if event.Corrupt {
+				summary.Restores.Corrupt++
+				continue
+			}
+
+			if event.Result == ResultUnpacked {
+				unpackMs += event.UnpackDuration.Milliseconds()
+				continue
+			}
+
+			summary.Restores.Total++
+			switch event.Result {
+			case ResultMiss:
+				summary.Restores.Misses++
+				continue
+			case ResultPartialHit:
+				summary.Restores.PartialHits++
+			default:
+				summary.Restores.Hits++
+			}
+
+			if event.Result != "" {
+				summary.Restores.HitsByKeyIndex[event.KeyIndex]++
+			}
+
+			if event.Source != "" {
+				summary.Restores.Sources[event.Source]++
+			}
+
+			summary.Restores.BytesDownloaded += event.SizeBytes
+			downloadMs += event.Duration.Milliseconds()
+			unpackMs += event.UnpackDuration.Milliseconds()
+			continue
+		}
+
+		summary.Stores.Total++
+		if event.Result == ResultSkipped {
+			summary.Stores.Skipped++
+			continue
+		}
+
+		summary.Stores.Stored++
+		summary.Stores.BytesUploaded += event.SizeBytes
+		uploadMs += event.Duration.Milliseconds()
+		compressionMs += event.CompressionDuration.Milliseconds()
+	}
+
+	downloads := int64(summary.Restores.Hits + summary.Restores.PartialHits)
+	if downloads > 0 {
+		summary.Restores.AvgDownloadMs = downloadMs / downloads
+		summary.Restores.AvgUnpackMs = unpackMs / downloads
+	}
+
+	if summary.Restores.Total > 0 {
+		summary.Restores.HitRate = float64(downloads) / float64(summary.Restores.Total)
+	}
+
+	if summary.Stores.Stored > 0 {
+		summary.Stores.AvgUploadMs = uploadMs / int64(summary.Stores.Stored)
+		summary.Stores.AvgCompressionMs = compressionMs / int64(summary.Stores.Stored)
+	}
+
+	return summary
+}
@@ -0,0 +1,88 @@
+//revive:disable-next-line:var-naming
+package metrics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestReadEventsParsesPublishedEvents(t *testing.T) {
+	tempDir, _ := ioutil.TempDir(os.TempDir(), "*")
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "toolbox_metrics")
+	events := []CacheEvent{
+		{Command: CommandRestore, Server: "10.0.0.5", User: "some,user", Result: ResultPartialHit, KeyIndex: 1, SizeBytes: 100, Duration: time.Second, UnpackDuration: 2 * time.Second, ArchiveMethod: "native", Source: SourceStorageFallback},
+		{Command: CommandRestore, Server: "10.0.0.5", User: "tester", Result: ResultMiss},
+		{Command: CommandStore, Server: "10.0.0.5", User: "tester", Result: ResultStored, SizeBytes: 200, Duration: time.Second, CompressionDuration: 3 * time.Second, ArchiveMethod: "shell-out"},
+	}
+
+	for _, event := range events {
+		assert.Nil(t, publishEventToFile(path, event))
+	}
+
+	// Lines from other tools, or broken lines, are ignored.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	_, _ = f.WriteString("othermeasurement,a=b c=1\nbroken line here\n")
+	_ = f.Close()
+
+	parsed, err := ReadEvents(path)
+	assert.Nil(t, err)
+	assert.Equal(t, events, parsed)
+}
+
+func TestSummarize(t *testing.T) {
+	events := []CacheEvent{
+		{Command: CommandRestore, Result: ResultHit, KeyIndex: 0, SizeBytes: 100, Duration: 2 * time.Second, ArchiveMethod: "native", Source: SourceCDN},
+		{Command: CommandRestore, Result: ResultUnpacked, UnpackDuration: time.Second},
+		{Command: CommandRestore, Result: ResultPartialHit, KeyIndex: 2, SizeBytes: 300, Duration: 4 * time.Second, ArchiveMethod: "native", Source: SourceStorageFallback},
+		{Command: CommandRestore, Result: ResultUnpacked, UnpackDuration: 3 * time.Second},
+		{Command: CommandRestore, Result: ResultMiss},
+		{Command: CommandRestore, Result: ResultMiss},
+		{Command: CommandRestore, Corrupt: true},
+		{Command: CommandStore, Result: ResultStored, SizeBytes: 500, Duration: time.Second, CompressionDuration: 5 * time.Second, ArchiveMethod: "shell-out"},
+		{Command: CommandStore, Result: ResultSkipped},
+
+		// events written before results were recorded
+		{Command: CommandRestore, SizeBytes: 200, Duration: 3 * time.Second},
+		{Command: CommandStore, SizeBytes: 100, Duration: 3 * time.Second},
+	}
+
+	summary := Summarize(events)
+	assert.Equal(t, RestoreSummary{
+		Total:           5,
+		Hits:            2,
+		PartialHits:     1,
+		Misses:          2,
+		Corrupt:         1,
+		HitRate:         0.6,
+		BytesDownloaded: 600,
+		AvgDownloadMs:   3000,
+		AvgUnpackMs:     1333,
+		HitsByKeyIndex:  map[int]int{0: 1, 2: 1},
+		Sources:         map[string]int{SourceCDN: 1, SourceStorageFallback: 1},
+	}, summary.Restores)
+
+	assert.Equal(t, StoreSummary{
+		Total:            3,
+		Stored:           2,
+		Skipped:          1,
+		BytesUploaded:    600,
+		AvgUploadMs:      2000,
+		AvgCompressionMs: 2500,
+	}, summary.Stores)
+
+	assert.Equal(t, map[string]int{"native": 2, "shell-out": 1}, summary.ArchiveMethods)
+}
+
+func TestSummarizeNoEvents(t *testing.T) {
+	summary := Summarize([]CacheEvent{})
+	assert.Equal(t, 0, summary.Restores.Total)
+	assert.Equal(t, float64(0), summary.Restores.HitRate)
+	assert.Equal(t, 0, summary.Stores.Total)
+}
@@ -0,0 +1,94 @@
+//revive:disable-next-line:var-naming
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Emits events as plain StatsD metrics over UDP.
+// Since plain StatsD has no tags, the command and result are part of the metric names, e.g.:
+//
+//	cache.restore.hit:1|c
+//	cache.restore.bytes:2048|c
+//	cache.restore.duration:1000|ms
+type StatsDMetricsManager struct {
+	Address string
+	Prefix  string
+}
+
+func NewStatsDMetricsBackend() (*StatsDMetricsManager, error) {
+	address := os.Getenv("SEMAPHORE_CACHE_STATSD_ADDRESS")
+	if address == "" {
+		address = "127.0.0.1:8125"
+	}
+
+	prefix := os.Getenv("SEMAPHORE_CACHE_STATSD_PREFIX")
+	if prefix == "" {
+		prefix = "cache"
+	}
+
+	return &StatsDMetricsManager{Address: address, Prefix: prefix}, nil
+}
+
+func (b *StatsDMetricsManager) Enabled() bool {
+	return true
+}
+
+func (b *StatsDMetricsManager) LogEvent(event CacheEvent) error {
+	conn, err := net.DialTimeout("udp", b.Address, time.Second)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(strings.Join(b.formatEvent(event), "\n")))
+	return err
+}
+
+func (b *StatsDMetricsManager) formatEvent(event CacheEvent) []string {
+	command := event.Command
+	if command == "" {
+		command = CommandRestore
+	}
+
+	name := func(metric string) string {
+		return fmt.Sprintf("%s.%s.%s", b.Prefix, command, metric)
+	}
+
+	if event.Corrupt {
+		return []string{fmt.Sprintf("%s:1|c", name("corrupt"))}
+	}
+
+	result := event.Result
+	if result == "" {
+		result = "unknown"
+	}
+
+	lines := []string{}
+	if event.Result != ResultUnpacked {
+		lines = append(lines, fmt.Sprintf("%s:1|c", name(result)))
+	}
+
+	if event.SizeBytes > 0 {
+		lines = append(lines, fmt.Sprintf("%s:%d|c", name("bytes"), event.SizeBytes))
+	}
+
+	if event.Duration > 0 {
+		lines = append(lines, fmt.Sprintf("%s:%d|ms", name("duration"), event.Duration.Milliseconds()))
+	}
+
+	if event.CompressionDuration > 0 {
+		lines = append(lines, fmt.Sprintf("%s:%d|ms", name("compression_duration"), event.CompressionDuration.Milliseconds()))
+	}
+
+	if event.UnpackDuration > 0 {
+		lines = append(lines, fmt.Sprintf("%s:%d|ms", name("unpack_duration"), event.UnpackDuration.Milliseconds()))
+	}
+
+	return lines
+}
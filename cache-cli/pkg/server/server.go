@@ -0,0 +1,261 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	KindActionCache        = "ac"
+	KindContentAddressable = "cas"
+	KindKeyValue           = "kv"
+	DefaultKeyPrefix       = "remote-"
+)
+
+var digestRegex = regexp.MustCompile(`^[a-f0-9]{32,128}$`)
+var segmentRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+var segmentEscaper = strings.NewReplacer("_", "__", "-", "_-")
+
+// Server exposes a storage backend as a remote cache for build tools.
+// It implements the Bazel HTTP remote cache protocol, where entries live under /ac/ and /cas/,
+// and the simple HTTP protocol used by ccache and sccache, where any other path is a key.
+// Every entry is kept as a separate key in the storage, prefixed with storage.BuildCacheKeyPrefix and KeyPrefix.
+type Server struct {
+	Storage   storage.Storage
+	KeyPrefix string
+	ReadOnly  bool
+}
+
+func NewServer(storage storage.Storage, keyPrefix string, readOnly bool) *Server {
+	return &Server{
+		Storage:   storage,
+		KeyPrefix: keyPrefix,
+		ReadOnly:  readOnly,
+	}
+}
+
+type entry struct {
+	Kind   string
+	Digest string
+	Key    string
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	entry, err := s.parseEntry(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("%s %s -> key '%s'", r.Method, r.URL.Path, entry.Key)
+
+	switch r.Method {
+	case http.MethodGet:
+		s.get(w, entry)
+	case http.MethodHead:
+		s.head(w, entry)
+	case http.MethodPut:
+		s.put(w, r, entry)
+	case http.MethodDelete:
+		s.delete(w, entry)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// Bazel uses /ac/<digest> and /cas/<digest>, optionally after an instance name.
+// Everything else is a plain key, e.g. /ab/cdef0123 for ccache.
+func (s *Server) parseEntry(path string) (*entry, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, segment := range segments {
+		if !segmentRegex.MatchString(segment) {
+			return nil, fmt.Errorf("invalid path '%s'", path)
+		}
+	}
+
+	if len(segments) >= 2 {
+		kind := segments[len(segments)-2]
+		digest := segments[len(segments)-1]
+		if kind == KindActionCache || kind == KindContentAddressable {
+			if !digestRegex.MatchString(digest) {
+				return nil, fmt.Errorf("invalid digest '%s'", digest)
+			}
+
+			return &entry{
+				Kind:   kind,
+				Digest: digest,
+				Key:    s.key(kind, digest),
+			}, nil
+		}
+	}
+
+	// Segments are joined with '-', so '-' and '_' in them are escaped with '_',
+	// keeping /a/b-c and /a-b/c apart.
+	escaped := []string{}
+	for _, segment := range segments {
+		escaped = append(escaped, segmentEscaper.Replace(segment))
+	}
+
+	return &entry{
+		Kind: KindKeyValue,
+		Key:  s.key(KindKeyValue, strings.Join(escaped, "-")),
+	}, nil
+}
+
+// Entries are kept with the other build cache keys, apart from the keys users store.
+func (s *Server) key(kind, name string) string {
+	return fmt.Sprintf("%s%s%s-%s", storage.BuildCacheKeyPrefix, s.KeyPrefix, kind, name)
+}
+
+func (s *Server) head(w http.ResponseWriter, entry *entry) {
+	ok, err := s.Storage.HasKey(entry.Key)
+	if err != nil {
+		s.internalError(w, entry, err)
+		return
+	}
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) get(w http.ResponseWriter, entry *entry) {
+	ok, err := s.Storage.HasKey(entry.Key)
+	if err != nil {
+		s.internalError(w, entry, err)
+		return
+	}
+
+	if !ok {
+		http.Error(w, fmt.Sprintf("key '%s' does not exist", entry.Key), http.StatusNotFound)
+		return
+	}
+
+	file, err := s.Storage.Restore(entry.Key)
+	if err != nil {
+		s.internalError(w, entry, err)
+		return
+	}
+
+	defer os.Remove(file.Name())
+
+	// #nosec
+	downloaded, err := os.Open(file.Name())
+	if err != nil {
+		s.internalError(w, entry, err)
+		return
+	}
+
+	defer downloaded.Close()
+
+	info, err := downloaded.Stat()
+	if err != nil {
+		s.internalError(w, entry, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size()))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, downloaded); err != nil {
+		log.Errorf("Error sending key '%s': %v", entry.Key, err)
+	}
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request, entry *entry) {
+	if s.ReadOnly {
+		http.Error(w, "cache is read-only", http.StatusForbidden)
+		return
+	}
+
+	// Entries in the CAS never change, so there's no need to upload them again.
+	if entry.Kind == KindContentAddressable {
+		ok, err := s.Storage.HasKey(entry.Key)
+		if err == nil && ok {
+			_, _ = io.Copy(ioutil.Discard, r.Body)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	tempFile, err := ioutil.TempFile(os.TempDir(), fmt.Sprintf("%s-*", entry.Key))
+	if err != nil {
+		s.internalError(w, entry, err)
+		return
+	}
+
+	defer os.Remove(tempFile.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tempFile, hash), r.Body)
+	if err != nil {
+		_ = tempFile.Close()
+		http.Error(w, fmt.Sprintf("error reading request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := tempFile.Close(); err != nil {
+		s.internalError(w, entry, err)
+		return
+	}
+
+	// A CAS entry with the wrong contents would break every build using it.
+	if entry.Kind == KindContentAddressable && len(entry.Digest) == sha256.Size*2 {
+		actual := hex.EncodeToString(hash.Sum(nil))
+		if actual != entry.Digest {
+			http.Error(w, fmt.Sprintf("sha256 digest of the contents is %s, not %s", actual, entry.Digest), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.Storage.Store(entry.Key, tempFile.Name()); err != nil {
+		s.internalError(w, entry, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) delete(w http.ResponseWriter, entry *entry) {
+	if s.ReadOnly {
+		http.Error(w, "cache is read-only", http.StatusForbidden)
+		return
+	}
+
+	ok, err := s.Storage.HasKey(entry.Key)
+	if err != nil {
+		s.internalError(w, entry, err)
+		return
+	}
+
+	if !ok {
+		http.Error(w, fmt.Sprintf("key '%s' does not exist", entry.Key), http.StatusNotFound)
+		return
+	}
+
+	if err := s.Storage.Delete(entry.Key); err != nil {
+		s.internalError(w, entry, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) internalError(w http.ResponseWriter, entry *entry, err error) {
+	log.Errorf("Error handling key '%s': %v", entry.Key, err)
+	http.Error(w, "error accessing cache storage", http.StatusInternalServerError)
+}
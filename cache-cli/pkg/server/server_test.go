@@ -0,0 +1,259 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/storage"
+	assert "github.com/stretchr/testify/assert"
+)
+
+// Keeps keys in memory, so the server can be tested without a real backend.
+type memoryStorage struct {
+	mutex sync.Mutex
+	keys  map[string][]byte
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{keys: map[string][]byte{}}
+}
+
+func (s *memoryStorage) List() ([]storage.CacheKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keys := []storage.CacheKey{}
+	for name, content := range s.keys {
+		keys = append(keys, storage.CacheKey{Name: name, Size: int64(len(content))})
+	}
+
+	return keys, nil
+}
+
+func (s *memoryStorage) HasKey(key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.keys[key]
+	return ok, nil
+}
+
+func (s *memoryStorage) Store(key, path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys[key] = content
+	return nil
+}
+
+func (s *memoryStorage) Replace(key, path string) error {
+	return s.Store(key, path)
+}
+
+func (s *memoryStorage) AcquireLock(key string) (bool, error) {
+	return true, nil
+}
+
+func (s *memoryStorage) RefreshLock(key string) error {
+	return nil
+}
+
+func (s *memoryStorage) ReleaseLock(key string) error {
+	return nil
+}
+
+func (s *memoryStorage) Restore(key string) (*os.File, error) {
+	s.mutex.Lock()
+	content, ok := s.keys[key]
+	s.mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("key '%s' does not exist", key)
+	}
+
+	file, err := ioutil.TempFile(os.TempDir(), "*")
+	if err != nil {
+		return nil, err
+	}
+
+	_, _ = file.Write(content)
+	return file, file.Close()
+}
+
+func (s *memoryStorage) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.keys, key)
+	return nil
+}
+
+func (s *memoryStorage) DeleteMany(keys []storage.CacheKey) error {
+	for _, key := range keys {
+		_ = s.Delete(key.Name)
+	}
+
+	return nil
+}
+
+func (s *memoryStorage) Clear() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys = map[string][]byte{}
+	return nil
+}
+
+func (s *memoryStorage) Usage() (*storage.UsageSummary, error) {
+	return &storage.UsageSummary{Free: -1}, nil
+}
+
+func (s *memoryStorage) IsNotEmpty() (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.keys) > 0, nil
+}
+
+func (s *memoryStorage) Config() storage.StorageConfig {
+	return storage.StorageConfig{SortKeysBy: storage.SortByStoreTime}
+}
+
+func request(t *testing.T, server *httptest.Server, method, path, body string) (int, string) {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	assert.Nil(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	return resp.StatusCode, string(content)
+}
+
+func digest(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func Test__BazelProtocol(t *testing.T) {
+	memory := newMemoryStorage()
+	server := httptest.NewServer(NewServer(memory, DefaultKeyPrefix, false))
+	defer server.Close()
+
+	t.Run("missing entries", func(t *testing.T) {
+		status, _ := request(t, server, http.MethodGet, "/ac/"+digest("missing"), "")
+		assert.Equal(t, http.StatusNotFound, status)
+
+		status, _ = request(t, server, http.MethodHead, "/cas/"+digest("missing"), "")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("stores and reads CAS entries", func(t *testing.T) {
+		status, _ := request(t, server, http.MethodPut, "/cas/"+digest("hello"), "hello")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, memory.keys, storage.BuildCacheKeyPrefix+"remote-cas-"+digest("hello"))
+
+		status, body := request(t, server, http.MethodGet, "/cas/"+digest("hello"), "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "hello", body)
+	})
+
+	t.Run("rejects CAS entries with wrong digest", func(t *testing.T) {
+		status, _ := request(t, server, http.MethodPut, "/cas/"+digest("hello"), "not hello")
+		assert.Equal(t, http.StatusOK, status, "existing entries are not uploaded again")
+
+		status, body := request(t, server, http.MethodPut, "/cas/"+digest("other"), "not other")
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Contains(t, body, "sha256 digest of the contents")
+		assert.NotContains(t, memory.keys, storage.BuildCacheKeyPrefix+"remote-cas-"+digest("other"))
+	})
+
+	t.Run("action cache entries can be replaced", func(t *testing.T) {
+		path := "/instance/ac/" + digest("action")
+		status, _ := request(t, server, http.MethodPut, path, "result 1")
+		assert.Equal(t, http.StatusOK, status)
+		status, _ = request(t, server, http.MethodPut, path, "result 2")
+		assert.Equal(t, http.StatusOK, status)
+
+		status, body := request(t, server, http.MethodGet, path, "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "result 2", body)
+	})
+
+	t.Run("invalid digest", func(t *testing.T) {
+		status, _ := request(t, server, http.MethodGet, "/ac/not-a-digest", "")
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+}
+
+func Test__KeyValueProtocol(t *testing.T) {
+	memory := newMemoryStorage()
+	server := httptest.NewServer(NewServer(memory, "ccache-", false))
+	defer server.Close()
+
+	status, _ := request(t, server, http.MethodPut, "/ab/cdef0123", "object")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, memory.keys, storage.BuildCacheKeyPrefix+"ccache-kv-ab-cdef0123")
+
+	status, _ = request(t, server, http.MethodHead, "/ab/cdef0123", "")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, body := request(t, server, http.MethodGet, "/ab/cdef0123", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "object", body)
+
+	status, _ = request(t, server, http.MethodDelete, "/ab/cdef0123", "")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _ = request(t, server, http.MethodGet, "/ab/cdef0123", "")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, _ = request(t, server, http.MethodGet, "/ab/not%20valid", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = request(t, server, http.MethodPost, "/ab/cdef0123", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+
+	t.Run("paths do not collide", func(t *testing.T) {
+		status, _ := request(t, server, http.MethodPut, "/a/b-c", "first")
+		assert.Equal(t, http.StatusOK, status)
+		status, _ = request(t, server, http.MethodPut, "/a-b/c", "second")
+		assert.Equal(t, http.StatusOK, status)
+		status, _ = request(t, server, http.MethodPut, "/a_b/c", "third")
+		assert.Equal(t, http.StatusOK, status)
+
+		status, body := request(t, server, http.MethodGet, "/a/b-c", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "first", body)
+		assert.Contains(t, memory.keys, storage.BuildCacheKeyPrefix+"ccache-kv-a-b_-c")
+		assert.Contains(t, memory.keys, storage.BuildCacheKeyPrefix+"ccache-kv-a_-b-c")
+		assert.Contains(t, memory.keys, storage.BuildCacheKeyPrefix+"ccache-kv-a__b-c")
+	})
+}
+
+func Test__ReadOnlyServer(t *testing.T) {
+	memory := newMemoryStorage()
+	memory.keys[storage.BuildCacheKeyPrefix+"remote-kv-abc"] = []byte("existing")
+	server := httptest.NewServer(NewServer(memory, DefaultKeyPrefix, true))
+	defer server.Close()
+
+	status, body := request(t, server, http.MethodGet, "/abc", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "existing", body)
+
+	status, _ = request(t, server, http.MethodPut, "/abc", "new")
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status, _ = request(t, server, http.MethodDelete, "/abc", "")
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, []byte("existing"), memory.keys[storage.BuildCacheKeyPrefix+"remote-kv-abc"])
+}
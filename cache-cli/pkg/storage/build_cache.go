@@ -0,0 +1,28 @@
+package storage
+
+import "strings"
+
+// Remote caches for build tools, like 'cache serve' and 'cache gocacheprog',
+// keep every entry as a separate key, which means thousands of small keys.
+// Those keys start with BuildCacheKeyPrefix, so they can be told apart from the keys users store:
+// they are not listed by default, and they are evicted before any of them.
+const BuildCacheKeyPrefix = "_build-cache-"
+
+func IsBuildCacheKey(key string) bool {
+	return strings.HasPrefix(key, BuildCacheKeyPrefix)
+}
+
+// Splits the keys into the ones users stored, and the ones build tools did.
+func SplitBuildCacheKeys(keys []CacheKey) ([]CacheKey, []CacheKey) {
+	userKeys := []CacheKey{}
+	buildCacheKeys := []CacheKey{}
+	for _, key := range keys {
+		if IsBuildCacheKey(key.Name) {
+			buildCacheKeys = append(buildCacheKeys, key)
+		} else {
+			userKeys = append(userKeys, key)
+		}
+	}
+
+	return userKeys, buildCacheKeys
+}
@@ -36,5 +36,25 @@ func Test__Delete(t *testing.T) {
 
 			os.Remove(file.Name())
 		})
+
+		t.Run(fmt.Sprintf("%s multiple keys", storageType), func(t *testing.T) {
+			_ = storage.Clear()
+
+			file, _ := ioutil.TempFile(os.TempDir(), "*")
+			_ = storage.Store("abc001", file.Name())
+			_ = storage.Store("abc002", file.Name())
+			_ = storage.Store("abc003", file.Name())
+
+			err := storage.DeleteMany([]CacheKey{{Name: "abc001"}, {Name: "abc003"}, {Name: "does-not-exist"}})
+			assert.Nil(t, err)
+
+			keys, err := storage.List()
+			assert.Nil(t, err)
+			if assert.Len(t, keys, 1) {
+				assert.Equal(t, "abc002", keys[0].Name)
+			}
+
+			os.Remove(file.Name())
+		})
 	})
 }
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
+	log "github.com/sirupsen/logrus"
+)
+
+// Decides which keys are deleted when the cache needs space.
+// Keys are sorted by SortKeysBy, in descending order, and evicted starting from the last one:
+// the oldest keys when sorting by STORE_TIME or ACCESS_TIME, and the smallest ones when sorting by SIZE.
+// Keys matching one of the Pinned patterns, like *-main, are never evicted.
+// Keys used by build tools are evicted before the ones users stored.
+type EvictionPolicy struct {
+	SortKeysBy string
+	Pinned     []string
+}
+
+// Pinned patterns come from SEMAPHORE_CACHE_PINNED_KEYS, a comma-separated list of patterns like *-main.
+func NewEvictionPolicy(sortKeysBy string) EvictionPolicy {
+	return EvictionPolicy{SortKeysBy: sortKeysBy, Pinned: PinnedKeysFromEnv()}
+}
+
+func PinnedKeysFromEnv() []string {
+	patterns, err := ParsePinnedKeys(os.Getenv("SEMAPHORE_CACHE_PINNED_KEYS"))
+	if err != nil {
+		log.Errorf("Error parsing SEMAPHORE_CACHE_PINNED_KEYS: %v - no keys are pinned.", err)
+		return []string{}
+	}
+
+	return patterns
+}
+
+// Patterns use the same syntax as path.Match, where * matches any characters.
+func ParsePinnedKeys(value string) ([]string, error) {
+	patterns := []string{}
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %v", pattern, err)
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+func (p EvictionPolicy) IsPinned(key string) bool {
+	for _, pattern := range p.Pinned {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+type EvictionPlan struct {
+	Policy   string     `json:"policy"`
+	Required int64      `json:"required"`
+	Freed    int64      `json:"freed"`
+	Evicted  []CacheKey `json:"evicted"`
+
+	// Pinned keys that would have been evicted otherwise.
+	Pinned []CacheKey `json:"pinned"`
+}
+
+// If not enough space can be freed without touching pinned keys, the plan evicts every other key.
+func (p *EvictionPlan) IsEnough() bool {
+	return p.Freed >= p.Required
+}
+
+// Finds the keys to evict to free the required space.
+func (p EvictionPolicy) Plan(keys []CacheKey, required int64) *EvictionPlan {
+	plan := &EvictionPlan{
+		Policy:   p.SortKeysBy,
+		Required: required,
+		Evicted:  []CacheKey{},
+		Pinned:   []CacheKey{},
+	}
+
+	// Build cache entries are not mixed with the keys users stored,
+	// so a build tool writing many small entries only evicts its own older entries.
+	userKeys, buildCacheKeys := SplitBuildCacheKeys(keys)
+	p.planFrom(plan, SortKeys(buildCacheKeys, p.SortKeysBy))
+	p.planFrom(plan, SortKeys(userKeys, p.SortKeysBy))
+	return plan
+}
+
+func (p EvictionPolicy) planFrom(plan *EvictionPlan, sorted []CacheKey) {
+	for i := len(sorted) - 1; i >= 0 && plan.Freed < plan.Required; i-- {
+		key := sorted[i]
+		if p.IsPinned(key.Name) {
+			plan.Pinned = append(plan.Pinned, key)
+			continue
+		}
+
+		plan.Evicted = append(plan.Evicted, key)
+		plan.Freed += key.Size
+	}
+}
+
+// Deletes the keys in the plan, in order.
+func Evict(storage Storage, plan *EvictionPlan) error {
+	for _, key := range plan.Evicted {
+		err := storage.Delete(key.Name)
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Key '%s' is deleted (%s).", key.Name, files.HumanReadableSize(key.Size))
+	}
+
+	return nil
+}
+
+// Sorts keys in descending order by one of the SortBy* fields.
+// Backends that don't track access times report the time the key was stored instead.
+func SortKeys(keys []CacheKey, sortBy string) []CacheKey {
+	switch sortBy {
+	case SortBySize:
+		sort.SliceStable(keys, func(i, j int) bool {
+			return keys[i].Size > keys[j].Size
+		})
+	case SortByAccessTime:
+		sort.SliceStable(keys, func(i, j int) bool {
+			return keyTime(lastAccessedAt(keys[i])).After(keyTime(lastAccessedAt(keys[j])))
+		})
+	default:
+		sort.SliceStable(keys, func(i, j int) bool {
+			return keyTime(keys[i].StoredAt).After(keyTime(keys[j].StoredAt))
+		})
+	}
+
+	return keys
+}
+
+func lastAccessedAt(key CacheKey) *time.Time {
+	if key.LastAccessedAt == nil {
+		return key.StoredAt
+	}
+
+	return key.LastAccessedAt
+}
+
+// Keys without a timestamp are considered the oldest ones.
+func keyTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return *t
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func evictionTestKeys() []CacheKey {
+	now := time.Now()
+	key := func(name string, size int64, storedAgo, accessedAgo time.Duration) CacheKey {
+		storedAt := now.Add(-storedAgo)
+		accessedAt := now.Add(-accessedAgo)
+		return CacheKey{Name: name, Size: size, StoredAt: &storedAt, LastAccessedAt: &accessedAt}
+	}
+
+	return []CacheKey{
+		key("deps-main", 500, 4*time.Hour, 4*time.Hour),
+		key("deps-feature", 300, 3*time.Hour, time.Minute),
+		key("build-feature", 100, 2*time.Hour, 2*time.Hour),
+		key("build-main", 200, time.Hour, time.Hour),
+	}
+}
+
+func names(keys []CacheKey) []string {
+	result := []string{}
+	for _, key := range keys {
+		result = append(result, key.Name)
+	}
+
+	return result
+}
+
+func Test__EvictionPlan(t *testing.T) {
+	t.Run("evicts the oldest keys first", func(t *testing.T) {
+		plan := EvictionPolicy{SortKeysBy: SortByStoreTime}.Plan(evictionTestKeys(), 700)
+		assert.Equal(t, []string{"deps-main", "deps-feature"}, names(plan.Evicted))
+		assert.Equal(t, int64(800), plan.Freed)
+		assert.True(t, plan.IsEnough())
+	})
+
+	t.Run("evicts the least recently accessed keys first", func(t *testing.T) {
+		plan := EvictionPolicy{SortKeysBy: SortByAccessTime}.Plan(evictionTestKeys(), 700)
+		assert.Equal(t, []string{"deps-main", "build-feature", "build-main"}, names(plan.Evicted))
+	})
+
+	t.Run("evicts the smallest keys first", func(t *testing.T) {
+		plan := EvictionPolicy{SortKeysBy: SortBySize}.Plan(evictionTestKeys(), 250)
+		assert.Equal(t, []string{"build-feature", "build-main"}, names(plan.Evicted))
+	})
+
+	t.Run("pinned keys are not evicted", func(t *testing.T) {
+		plan := EvictionPolicy{SortKeysBy: SortByStoreTime, Pinned: []string{"*-main"}}.Plan(evictionTestKeys(), 350)
+		assert.Equal(t, []string{"deps-feature", "build-feature"}, names(plan.Evicted))
+		assert.Equal(t, []string{"deps-main"}, names(plan.Pinned))
+		assert.True(t, plan.IsEnough())
+	})
+
+	t.Run("not enough space without pinned keys", func(t *testing.T) {
+		plan := EvictionPolicy{SortKeysBy: SortByStoreTime, Pinned: []string{"*-main"}}.Plan(evictionTestKeys(), 1000)
+		assert.Equal(t, []string{"deps-feature", "build-feature"}, names(plan.Evicted))
+		assert.Equal(t, []string{"deps-main", "build-main"}, names(plan.Pinned))
+		assert.False(t, plan.IsEnough())
+	})
+
+	t.Run("no keys", func(t *testing.T) {
+		plan := EvictionPolicy{SortKeysBy: SortByStoreTime}.Plan([]CacheKey{}, 100)
+		assert.Empty(t, plan.Evicted)
+		assert.False(t, plan.IsEnough())
+	})
+
+	t.Run("nothing required", func(t *testing.T) {
+		plan := EvictionPolicy{SortKeysBy: SortByStoreTime}.Plan(evictionTestKeys(), 0)
+		assert.Empty(t, plan.Evicted)
+		assert.True(t, plan.IsEnough())
+	})
+
+	t.Run("build cache keys are evicted first", func(t *testing.T) {
+		storedAt := time.Now()
+		keys := append(evictionTestKeys(),
+			CacheKey{Name: BuildCacheKeyPrefix + "remote-cas-a", Size: 50, StoredAt: &storedAt},
+			CacheKey{Name: BuildCacheKeyPrefix + "remote-cas-b", Size: 50, StoredAt: &storedAt},
+		)
+
+		plan := EvictionPolicy{SortKeysBy: SortByStoreTime}.Plan(keys, 50)
+		assert.Equal(t, []string{BuildCacheKeyPrefix + "remote-cas-b"}, names(plan.Evicted))
+
+		plan = EvictionPolicy{SortKeysBy: SortByStoreTime}.Plan(keys, 150)
+		assert.Equal(t, []string{BuildCacheKeyPrefix + "remote-cas-b", BuildCacheKeyPrefix + "remote-cas-a", "deps-main"}, names(plan.Evicted))
+	})
+
+	t.Run("keys given are not reordered", func(t *testing.T) {
+		keys := evictionTestKeys()
+		EvictionPolicy{SortKeysBy: SortBySize}.Plan(keys, 100)
+		assert.Equal(t, names(evictionTestKeys()), names(keys))
+	})
+}
+
+func Test__SortKeysWithoutTimestamps(t *testing.T) {
+	storedAt := time.Now()
+	keys := SortKeys([]CacheKey{{Name: "unknown"}, {Name: "known", StoredAt: &storedAt}}, SortByAccessTime)
+	assert.Equal(t, []string{"known", "unknown"}, names(keys))
+}
+
+func Test__PinnedKeys(t *testing.T) {
+	patterns, err := ParsePinnedKeys(" *-main, ,deps-*-master ")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"*-main", "deps-*-master"}, patterns)
+
+	_, err = ParsePinnedKeys("[")
+	assert.NotNil(t, err)
+
+	os.Setenv("SEMAPHORE_CACHE_PINNED_KEYS", "*-main")
+	defer os.Unsetenv("SEMAPHORE_CACHE_PINNED_KEYS")
+
+	policy := NewEvictionPolicy(SortByStoreTime)
+	assert.True(t, policy.IsPinned("deps-main"))
+	assert.False(t, policy.IsPinned("deps-maintenance"))
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Used to select keys for bulk operations.
+// A key needs to match all the conditions that are set.
+type KeyFilter struct {
+	Prefix           string
+	Regex            *regexp.Regexp
+	StoredBefore     *time.Time
+	LargerThan       *int64
+	NotAccessedSince *time.Time
+}
+
+func (f KeyFilter) IsEmpty() bool {
+	return f.Prefix == "" &&
+		f.Regex == nil &&
+		f.StoredBefore == nil &&
+		f.LargerThan == nil &&
+		f.NotAccessedSince == nil
+}
+
+// Keys without the timestamps required by a condition never match it.
+// If a backend does not track access times, the time the key was stored is used.
+func (f KeyFilter) Matches(key CacheKey) bool {
+	if f.Prefix != "" && !strings.HasPrefix(key.Name, f.Prefix) {
+		return false
+	}
+
+	if f.Regex != nil && !f.Regex.MatchString(key.Name) {
+		return false
+	}
+
+	if f.StoredBefore != nil && (key.StoredAt == nil || !key.StoredAt.Before(*f.StoredBefore)) {
+		return false
+	}
+
+	if f.LargerThan != nil && key.Size <= *f.LargerThan {
+		return false
+	}
+
+	if f.NotAccessedSince != nil {
+		accessedAt := key.LastAccessedAt
+		if accessedAt == nil {
+			accessedAt = key.StoredAt
+		}
+
+		if accessedAt == nil || !accessedAt.Before(*f.NotAccessedSince) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f KeyFilter) Filter(keys []CacheKey) []CacheKey {
+	filtered := []CacheKey{}
+	for _, key := range keys {
+		if f.Matches(key) {
+			filtered = append(filtered, key)
+		}
+	}
+
+	return filtered
+}
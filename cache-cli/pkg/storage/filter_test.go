@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__KeyFilter(t *testing.T) {
+	now := time.Now()
+	monthAgo := now.Add(-30 * 24 * time.Hour)
+	weekAgo := now.Add(-7 * 24 * time.Hour)
+
+	keys := []CacheKey{
+		{Name: "gems-master-1", Size: 2048, StoredAt: &monthAgo, LastAccessedAt: &now},
+		{Name: "gems-dev-2", Size: 100, StoredAt: &weekAgo, LastAccessedAt: &weekAgo},
+		{Name: "node-modules-master-3", Size: 4096, StoredAt: &now, LastAccessedAt: &now},
+		{Name: "unknown-times", Size: 4096},
+	}
+
+	names := func(keys []CacheKey) []string {
+		result := []string{}
+		for _, key := range keys {
+			result = append(result, key.Name)
+		}
+		return result
+	}
+
+	t.Run("empty filter matches everything", func(t *testing.T) {
+		filter := KeyFilter{}
+		assert.True(t, filter.IsEmpty())
+		assert.Len(t, filter.Filter(keys), 4)
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		filtered := KeyFilter{Prefix: "gems-"}.Filter(keys)
+		assert.Equal(t, []string{"gems-master-1", "gems-dev-2"}, names(filtered))
+	})
+
+	t.Run("regex", func(t *testing.T) {
+		filtered := KeyFilter{Regex: regexp.MustCompile("-master-")}.Filter(keys)
+		assert.Equal(t, []string{"gems-master-1", "node-modules-master-3"}, names(filtered))
+	})
+
+	t.Run("older than", func(t *testing.T) {
+		storedBefore := now.Add(-14 * 24 * time.Hour)
+		filtered := KeyFilter{StoredBefore: &storedBefore}.Filter(keys)
+		assert.Equal(t, []string{"gems-master-1"}, names(filtered))
+	})
+
+	t.Run("larger than", func(t *testing.T) {
+		largerThan := int64(2048)
+		filtered := KeyFilter{LargerThan: &largerThan}.Filter(keys)
+		assert.Equal(t, []string{"node-modules-master-3", "unknown-times"}, names(filtered))
+	})
+
+	t.Run("larger than zero", func(t *testing.T) {
+		largerThan := int64(0)
+		filter := KeyFilter{LargerThan: &largerThan}
+		assert.False(t, filter.IsEmpty())
+		assert.Len(t, filter.Filter(append(keys, CacheKey{Name: "empty"})), 4)
+	})
+
+	t.Run("not accessed since", func(t *testing.T) {
+		since := now.Add(-24 * time.Hour)
+		filtered := KeyFilter{NotAccessedSince: &since}.Filter(keys)
+		assert.Equal(t, []string{"gems-dev-2"}, names(filtered))
+	})
+
+	t.Run("all conditions must match", func(t *testing.T) {
+		largerThan := int64(1024)
+		filtered := KeyFilter{Prefix: "gems-", LargerThan: &largerThan}.Filter(keys)
+		assert.Equal(t, []string{"gems-master-1"}, names(filtered))
+	})
+}
@@ -3,7 +3,6 @@ package storage
 import (
 	"context"
 	"fmt"
-	"sort"
 	"strings"
 
 	"cloud.google.com/go/storage"
@@ -11,7 +10,7 @@ import (
 )
 
 func (s *GCSStorage) List() ([]CacheKey, error) {
-	it := s.Bucket.Objects(context.TODO(), &storage.Query{Prefix: s.Project})
+	it := s.Bucket.Objects(context.TODO(), &storage.Query{Prefix: s.Project + "/"})
 
 	keys := make([]CacheKey, 0)
 	for {
@@ -26,23 +25,7 @@ func (s *GCSStorage) List() ([]CacheKey, error) {
 		keys = s.appendToListResult(keys, attrs)
 	}
 
-	return s.sortKeys(keys), nil
-}
-
-// S3 backend does not support sorting keys by ACCESS_TIME
-func (s *GCSStorage) sortKeys(keys []CacheKey) []CacheKey {
-	switch s.Config().SortKeysBy {
-	case SortBySize:
-		sort.SliceStable(keys, func(i, j int) bool {
-			return keys[i].Size > keys[j].Size
-		})
-	default:
-		sort.SliceStable(keys, func(i, j int) bool {
-			return keys[i].StoredAt.After(*keys[j].StoredAt)
-		})
-	}
-
-	return keys
+	return SortKeys(keys, s.Config().SortKeysBy), nil
 }
 
 func (s *GCSStorage) appendToListResult(keys []CacheKey, object *storage.ObjectAttrs) []CacheKey {
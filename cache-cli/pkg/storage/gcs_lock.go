@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	gcs "cloud.google.com/go/storage"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+)
+
+// Locks are objects created only if they do not exist yet.
+// They live outside of the project prefix, so they are never listed as keys.
+// An expired lock is replaced with a precondition on its generation,
+// so only one of the jobs finding it expired takes it over.
+func (s *GCSStorage) AcquireLock(key string) (bool, error) {
+	acquired, err := s.putLock(key, gcs.Conditions{DoesNotExist: true})
+	if err != nil || acquired {
+		return acquired, err
+	}
+
+	attrs, err := s.Bucket.Object(s.lockKey(key)).Attrs(context.TODO())
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return s.putLock(key, gcs.Conditions{DoesNotExist: true})
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if !isLockExpired(attrs.Updated) {
+		return false, nil
+	}
+
+	log.Warnf("Lock for key '%s' expired, taking it over.", key)
+	return s.putLock(key, gcs.Conditions{GenerationMatch: attrs.Generation})
+}
+
+// The lock is only rewritten if it is still ours, and was not changed since we read it.
+func (s *GCSStorage) RefreshLock(key string) error {
+	generation, err := s.ownLockGeneration(key)
+	if err != nil {
+		return err
+	}
+
+	refreshed, err := s.putLock(key, gcs.Conditions{GenerationMatch: generation})
+	if err != nil {
+		return err
+	}
+
+	if !refreshed {
+		return errLockLost(key)
+	}
+
+	return nil
+}
+
+// The lock is only deleted if it is still ours, and was not changed since we read it,
+// so a job whose lock expired and was taken over doesn't remove the lock of the new owner.
+func (s *GCSStorage) ReleaseLock(key string) error {
+	generation, err := s.ownLockGeneration(key)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = s.Bucket.Object(s.lockKey(key)).If(gcs.Conditions{GenerationMatch: generation}).Delete(context.TODO())
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return errLockLost(key)
+	}
+
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// Returns the generation of the lock, if it is held by this job.
+func (s *GCSStorage) ownLockGeneration(key string) (int64, error) {
+	reader, err := s.Bucket.Object(s.lockKey(key)).NewReader(context.TODO())
+	if err != nil {
+		return 0, err
+	}
+
+	owner, err := io.ReadAll(reader)
+	_ = reader.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	if string(owner) != lockOwner() {
+		return 0, errLockLost(key)
+	}
+
+	return reader.Attrs.Generation, nil
+}
+
+// Returns false if the precondition is not met.
+func (s *GCSStorage) putLock(key string, conditions gcs.Conditions) (bool, error) {
+	writer := s.Bucket.Object(s.lockKey(key)).If(conditions).NewWriter(context.TODO())
+	_, err := writer.Write([]byte(lockOwner()))
+	if err != nil {
+		_ = writer.Close()
+		return false, err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *GCSStorage) lockKey(key string) string {
+	return fmt.Sprintf("%s/%s/%s", locksDirectory, s.Project, key)
+}
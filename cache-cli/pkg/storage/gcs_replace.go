@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	gcs "cloud.google.com/go/storage"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+)
+
+// Uploads are already atomic in GCS, so we only need to make sure
+// the object we are replacing was not changed by someone else in the meantime.
+// That is done with a precondition on the object generation.
+func (s *GCSStorage) Replace(key, path string) error {
+	destination := fmt.Sprintf("%s/%s", s.Project, key)
+	object := s.Bucket.Object(destination)
+
+	attrs, err := object.Attrs(context.TODO())
+	switch {
+	case errors.Is(err, gcs.ErrObjectNotExist):
+		object = object.If(gcs.Conditions{DoesNotExist: true})
+	case err != nil:
+		return err
+	default:
+		object = object.If(gcs.Conditions{GenerationMatch: attrs.Generation})
+	}
+
+	// #nosec
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	writer := object.NewWriter(ctx)
+	_, err = io.Copy(writer, file)
+	if err != nil {
+		log.Errorf("Error uploading: %v", err)
+		_ = file.Close()
+
+		// canceled context will abort the save, closing writer would save a partial object
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		_ = file.Close()
+
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+			return fmt.Errorf("key '%s' was changed by another writer during the upload", key)
+		}
+
+		return err
+	}
+
+	return file.Close()
+}
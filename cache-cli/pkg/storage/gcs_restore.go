@@ -23,7 +23,10 @@ func (s *GCSStorage) Restore(key string) (*os.File, error) {
 
 	defer reader.Close()
 
-	_, err = io.Copy(tempFile, reader)
+	progressFile := transferFile(tempFile, downloadProgress(key, reader.Attrs.Size))
+	defer progressFile.Progress.Finish()
+
+	_, err = io.Copy(progressFile, reader)
 	if err != nil {
 		_ = tempFile.Close()
 		return nil, err
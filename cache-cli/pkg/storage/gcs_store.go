@@ -22,7 +22,10 @@ func (s *GCSStorage) Store(key, path string) error {
 	destination := fmt.Sprintf("%s/%s", s.Project, key)
 	writer := s.Bucket.Object(destination).NewWriter(ctx)
 
-	_, err = io.Copy(writer, file)
+	progressFile := transferFile(file, uploadProgress(key, file))
+	defer progressFile.Progress.Finish()
+
+	_, err = io.Copy(writer, progressFile)
 	if err != nil {
 		log.Errorf("Error uploading: %v", err)
 		_ = file.Close()
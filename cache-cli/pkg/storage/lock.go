@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Locks older than this are considered abandoned,
+// probably because the job holding it was stopped before releasing it.
+// Jobs holding a lock refresh it every LockRefreshInterval, so long uploads keep it.
+const LockTTL = 10 * time.Minute
+const LockRefreshInterval = LockTTL / 5
+
+const locksDirectory = ".locks"
+
+func lockOwner() string {
+	jobID := os.Getenv("SEMAPHORE_JOB_ID")
+	if jobID != "" {
+		return jobID
+	}
+
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+func isLockExpired(lockedAt time.Time) bool {
+	return time.Since(lockedAt) > LockTTL
+}
+
+func errLockLost(key string) error {
+	return fmt.Errorf("lock for key '%s' is no longer held by this job", key)
+}
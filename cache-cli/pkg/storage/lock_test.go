@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__Lock(t *testing.T) {
+	runTestForAllStorageTypes(t, SortByStoreTime, func(storageType string, storage Storage) {
+		t.Run(fmt.Sprintf("%s only one writer can hold the lock", storageType), func(t *testing.T) {
+			_ = storage.Clear()
+			_ = storage.ReleaseLock("abc001")
+
+			acquired, err := storage.AcquireLock("abc001")
+			assert.Nil(t, err)
+			assert.True(t, acquired)
+
+			acquired, err = storage.AcquireLock("abc001")
+			assert.Nil(t, err)
+			assert.False(t, acquired)
+
+			acquired, err = storage.AcquireLock("abc002")
+			assert.Nil(t, err)
+			assert.True(t, acquired)
+
+			assert.Nil(t, storage.ReleaseLock("abc001"))
+			assert.Nil(t, storage.ReleaseLock("abc002"))
+		})
+
+		t.Run(fmt.Sprintf("%s lock can be acquired again after release", storageType), func(t *testing.T) {
+			_ = storage.ReleaseLock("abc001")
+
+			acquired, err := storage.AcquireLock("abc001")
+			assert.Nil(t, err)
+			assert.True(t, acquired)
+			assert.Nil(t, storage.ReleaseLock("abc001"))
+
+			acquired, err = storage.AcquireLock("abc001")
+			assert.Nil(t, err)
+			assert.True(t, acquired)
+			assert.Nil(t, storage.ReleaseLock("abc001"))
+		})
+
+		t.Run(fmt.Sprintf("%s lock can be refreshed by its owner only", storageType), func(t *testing.T) {
+			_ = storage.ReleaseLock("abc001")
+
+			os.Setenv("SEMAPHORE_JOB_ID", "job-1")
+			defer os.Unsetenv("SEMAPHORE_JOB_ID")
+
+			acquired, err := storage.AcquireLock("abc001")
+			assert.Nil(t, err)
+			assert.True(t, acquired)
+			assert.Nil(t, storage.RefreshLock("abc001"))
+
+			os.Setenv("SEMAPHORE_JOB_ID", "job-2")
+			assert.NotNil(t, storage.RefreshLock("abc001"))
+
+			acquired, err = storage.AcquireLock("abc001")
+			assert.Nil(t, err)
+			assert.False(t, acquired)
+
+			os.Setenv("SEMAPHORE_JOB_ID", "job-1")
+			assert.Nil(t, storage.ReleaseLock("abc001"))
+		})
+
+		t.Run(fmt.Sprintf("%s lock can be released by its owner only", storageType), func(t *testing.T) {
+			_ = storage.ReleaseLock("abc001")
+
+			os.Setenv("SEMAPHORE_JOB_ID", "job-1")
+			defer os.Unsetenv("SEMAPHORE_JOB_ID")
+
+			acquired, err := storage.AcquireLock("abc001")
+			assert.Nil(t, err)
+			assert.True(t, acquired)
+
+			os.Setenv("SEMAPHORE_JOB_ID", "job-2")
+			assert.NotNil(t, storage.ReleaseLock("abc001"))
+
+			acquired, err = storage.AcquireLock("abc001")
+			assert.Nil(t, err)
+			assert.False(t, acquired)
+
+			os.Setenv("SEMAPHORE_JOB_ID", "job-1")
+			assert.Nil(t, storage.ReleaseLock("abc001"))
+		})
+
+		t.Run(fmt.Sprintf("%s locks are not listed as keys", storageType), func(t *testing.T) {
+			_ = storage.Clear()
+
+			acquired, err := storage.AcquireLock("abc001")
+			assert.Nil(t, err)
+			assert.True(t, acquired)
+
+			keys, err := storage.List()
+			assert.Nil(t, err)
+			assert.Empty(t, keys)
+
+			isNotEmpty, err := storage.IsNotEmpty()
+			assert.Nil(t, err)
+			assert.False(t, isNotEmpty)
+
+			assert.Nil(t, storage.ReleaseLock("abc001"))
+		})
+	})
+}
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
+)
+
+func uploadProgress(key string, file *os.File) *files.Progress {
+	total := int64(-1)
+	if info, err := file.Stat(); err == nil {
+		total = info.Size()
+	}
+
+	return files.NewProgress(fmt.Sprintf("Uploading '%s'", key), total)
+}
+
+func downloadProgress(key string, total int64) *files.Progress {
+	return files.NewProgress(fmt.Sprintf("Downloading '%s'", key), total)
+}
+
+// Every transfer goes through the same limiter, configured with SEMAPHORE_CACHE_MAX_BANDWIDTH.
+func transferFile(file *os.File, progress *files.Progress) *files.ProgressFile {
+	progressFile := files.NewProgressFile(file, progress)
+	progressFile.Limiter = files.SharedRateLimiter()
+	return progressFile
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__Replace(t *testing.T) {
+	runTestForAllStorageTypes(t, SortByStoreTime, func(storageType string, storage Storage) {
+		t.Run(fmt.Sprintf("%s replaces existing key", storageType), func(t *testing.T) {
+			_ = storage.Clear()
+
+			file, _ := ioutil.TempFile(os.TempDir(), "*")
+			file.WriteString("old")
+			assert.Nil(t, storage.Store("abc001", file.Name()))
+
+			newFile, _ := ioutil.TempFile(os.TempDir(), "*")
+			newFile.WriteString("new")
+			assert.Nil(t, storage.Replace("abc001", newFile.Name()))
+
+			restoredFile, err := storage.Restore("abc001")
+			assert.Nil(t, err)
+
+			content, err := ioutil.ReadFile(restoredFile.Name())
+			assert.Nil(t, err)
+			assert.Equal(t, "new", string(content))
+
+			keys, err := storage.List()
+			assert.Nil(t, err)
+			assert.Len(t, keys, 1)
+
+			os.Remove(file.Name())
+			os.Remove(newFile.Name())
+			os.Remove(restoredFile.Name())
+		})
+
+		t.Run(fmt.Sprintf("%s creates key if it does not exist", storageType), func(t *testing.T) {
+			_ = storage.Clear()
+
+			file, _ := ioutil.TempFile(os.TempDir(), "*")
+			assert.Nil(t, storage.Replace("abc002", file.Name()))
+
+			ok, err := storage.HasKey("abc002")
+			assert.Nil(t, err)
+			assert.True(t, ok)
+
+			os.Remove(file.Name())
+		})
+	})
+}
+
+func Test__SFTPReplaceReusesSpace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	runTestForSingleStorageType("sftp", 1024, SortByStoreTime, t, func(storage Storage) {
+		t.Run("sftp does not evict other keys to replace a key", func(t *testing.T) {
+			_ = storage.Clear()
+
+			file, _ := ioutil.TempFile(os.TempDir(), "*")
+			file.WriteString(strings.Repeat("x", 400))
+			assert.Nil(t, storage.Store("abc001", file.Name()))
+			assert.Nil(t, storage.Store("abc002", file.Name()))
+
+			newFile, _ := ioutil.TempFile(os.TempDir(), "*")
+			newFile.WriteString(strings.Repeat("y", 600))
+			assert.Nil(t, storage.Replace("abc002", newFile.Name()))
+
+			keys, err := storage.List()
+			assert.Nil(t, err)
+			if assert.Len(t, keys, 2) {
+				assert.Equal(t, "abc002", keys[0].Name)
+				assert.Equal(t, int64(600), keys[0].Size)
+			}
+
+			os.Remove(file.Name())
+			os.Remove(newFile.Name())
+		})
+	})
+}
+
+func Test__S3ReplaceUsesConditionalWrites(t *testing.T) {
+	var lock sync.Mutex
+	headers := map[string]http.Header{}
+	existingKey := "/semaphore-cache/cache-cli/existing"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		headers[r.Method+" "+r.URL.Path] = r.Header.Clone()
+		lock.Unlock()
+
+		if r.Method == http.MethodHead && r.URL.Path != existingKey {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("ETag", `"abc123"`)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	defer server.Close()
+
+	os.Setenv("SEMAPHORE_CACHE_S3_KEY", "key")
+	os.Setenv("SEMAPHORE_CACHE_S3_SECRET", "secret")
+	defer os.Unsetenv("SEMAPHORE_CACHE_S3_KEY")
+	defer os.Unsetenv("SEMAPHORE_CACHE_S3_SECRET")
+
+	storage, err := NewS3Storage(S3StorageOptions{
+		URL:     server.URL,
+		Bucket:  "semaphore-cache",
+		Project: "cache-cli",
+		Config:  StorageConfig{MaxSpace: math.MaxInt64, SortKeysBy: SortByStoreTime},
+	})
+
+	assert.Nil(t, err)
+
+	file, _ := ioutil.TempFile(os.TempDir(), "*")
+	file.WriteString("hello")
+	defer os.Remove(file.Name())
+
+	t.Run("new key uses If-None-Match", func(t *testing.T) {
+		assert.Nil(t, storage.Replace("new", file.Name()))
+		assert.Equal(t, "*", headers["PUT /semaphore-cache/cache-cli/new"].Get("If-None-Match"))
+		assert.Empty(t, headers["PUT /semaphore-cache/cache-cli/new"].Get("If-Match"))
+	})
+
+	t.Run("existing key uses If-Match", func(t *testing.T) {
+		assert.Nil(t, storage.Replace("existing", file.Name()))
+		assert.Equal(t, `"abc123"`, headers["PUT "+existingKey].Get("If-Match"))
+		assert.Empty(t, headers["PUT "+existingKey].Get("If-None-Match"))
+	})
+
+	t.Run("regular store does not use conditional writes", func(t *testing.T) {
+		assert.Nil(t, storage.Store("other", file.Name()))
+		assert.Empty(t, headers["PUT /semaphore-cache/cache-cli/other"].Get("If-Match"))
+		assert.Empty(t, headers["PUT /semaphore-cache/cache-cli/other"].Get("If-None-Match"))
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	assert "github.com/stretchr/testify/assert"
 )
 
@@ -39,3 +40,12 @@ func Test__Restore(t *testing.T) {
 		})
 	})
 }
+
+func Test__S3ObjectSize(t *testing.T) {
+	contentRange := "bytes 0-99/1000"
+	assert.Equal(t, int64(1000), objectSize(&s3.GetObjectOutput{ContentLength: 100, ContentRange: &contentRange}))
+	assert.Equal(t, int64(100), objectSize(&s3.GetObjectOutput{ContentLength: 100}))
+
+	contentRange = "bytes 0-99/*"
+	assert.Equal(t, int64(-1), objectSize(&s3.GetObjectOutput{ContentLength: 100, ContentRange: &contentRange}))
+}
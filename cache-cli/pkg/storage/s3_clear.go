@@ -14,21 +14,7 @@ func (s *S3Storage) Clear() error {
 		return err
 	}
 
-	if len(keys) == 0 {
-		return nil
-	}
-
-	// the s3 DeleteObjects operation only allows up to 1000 keys to be used
-	chunks := createChunks(keys, 1000)
-
-	for _, chunk := range chunks {
-		err := s.deleteChunk(chunk)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return s.DeleteMany(keys)
 }
 
 func (s *S3Storage) deleteChunk(keys []CacheKey) error {
@@ -45,7 +31,7 @@ func (s *S3Storage) deleteChunk(keys []CacheKey) error {
 
 	if len(output.Errors) > 0 {
 		firstError := output.Errors[0]
-		return fmt.Errorf("clear operation failed, some keys might not have been deleted: %s", *firstError.Message)
+		return fmt.Errorf("delete operation failed, some keys might not have been deleted: %s", *firstError.Message)
 	}
 
 	return nil
@@ -0,0 +1,19 @@
+package storage
+
+func (s *S3Storage) DeleteMany(keys []CacheKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	// the s3 DeleteObjects operation only allows up to 1000 keys to be used
+	chunks := createChunks(keys, 1000)
+
+	for _, chunk := range chunks {
+		err := s.deleteChunk(chunk)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -3,7 +3,6 @@ package storage
 import (
 	"context"
 	"fmt"
-	"sort"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -29,37 +28,24 @@ func (s *S3Storage) List() ([]CacheKey, error) {
 		keys = s.appendToListResult(keys, output.Contents)
 	}
 
-	return s.sortKeys(keys), nil
-}
-
-// S3 backend does not support sorting keys by ACCESS_TIME
-func (s *S3Storage) sortKeys(keys []CacheKey) []CacheKey {
-	switch s.Config().SortKeysBy {
-	case SortBySize:
-		sort.SliceStable(keys, func(i, j int) bool {
-			return keys[i].Size > keys[j].Size
-		})
-	default:
-		sort.SliceStable(keys, func(i, j int) bool {
-			return keys[i].StoredAt.After(*keys[j].StoredAt)
-		})
-	}
-
-	return keys
+	return SortKeys(keys, s.Config().SortKeysBy), nil
 }
 
+// The trailing slash makes sure keys from projects or scopes
+// starting with the same characters as this one are not included.
 func (s *S3Storage) listObjectsInput(nextMarker *string) *s3.ListObjectsInput {
+	prefix := fmt.Sprintf("%s/", s.Project)
 	if nextMarker != nil {
 		return &s3.ListObjectsInput{
 			Bucket: &s.Bucket,
-			Prefix: &s.Project,
+			Prefix: &prefix,
 			Marker: nextMarker,
 		}
 	}
 
 	return &s3.ListObjectsInput{
 		Bucket: &s.Bucket,
-		Prefix: &s.Project,
+		Prefix: &prefix,
 	}
 }
 
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// Locks are objects created with a conditional write.
+// They live outside of the project prefix, so they are never listed as keys.
+// An expired lock is replaced with If-Match on its ETag,
+// so only one of the jobs finding it expired takes it over.
+func (s *S3Storage) AcquireLock(key string) (bool, error) {
+	acquired, err := s.putLock(key, "If-None-Match", "*")
+	if err != nil || acquired {
+		return acquired, err
+	}
+
+	lockKey := s.lockKey(key)
+	output, err := s.Client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &lockKey,
+	})
+
+	if err != nil {
+		var apiErr *smithy.GenericAPIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound" {
+			return s.putLock(key, "If-None-Match", "*")
+		}
+
+		return false, err
+	}
+
+	if output.LastModified == nil || output.ETag == nil || !isLockExpired(*output.LastModified) {
+		return false, nil
+	}
+
+	log.Warnf("Lock for key '%s' expired, taking it over.", key)
+	return s.putLock(key, "If-Match", *output.ETag)
+}
+
+// The lock is only rewritten if it is still ours, and was not changed since we read it.
+func (s *S3Storage) RefreshLock(key string) error {
+	etag, err := s.ownLockETag(key)
+	if err != nil {
+		return err
+	}
+
+	refreshed, err := s.putLock(key, "If-Match", etag)
+	if err != nil {
+		return err
+	}
+
+	if !refreshed {
+		return errLockLost(key)
+	}
+
+	return nil
+}
+
+// The lock is only deleted if it is still ours, and was not changed since we read it,
+// so a job whose lock expired and was taken over doesn't remove the lock of the new owner.
+func (s *S3Storage) ReleaseLock(key string) error {
+	etag, err := s.ownLockETag(key)
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchKey" {
+			return nil
+		}
+
+		return err
+	}
+
+	lockKey := s.lockKey(key)
+	_, err = s.Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &lockKey,
+	}, func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, addConditionalWriteHeader("If-Match", etag))
+	})
+
+	if isPreconditionFailed(err) {
+		return errLockLost(key)
+	}
+
+	return err
+}
+
+// Returns the ETag of the lock, if it is held by this job.
+func (s *S3Storage) ownLockETag(key string) (string, error) {
+	lockKey := s.lockKey(key)
+	output, err := s.Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &lockKey,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	owner, err := io.ReadAll(output.Body)
+	_ = output.Body.Close()
+	if err != nil {
+		return "", err
+	}
+
+	if string(owner) != lockOwner() || output.ETag == nil {
+		return "", errLockLost(key)
+	}
+
+	return *output.ETag, nil
+}
+
+// Returns false if the write condition is not met.
+func (s *S3Storage) putLock(key, conditionHeader, conditionValue string) (bool, error) {
+	lockKey := s.lockKey(key)
+	_, err := s.Client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &lockKey,
+		Body:   strings.NewReader(lockOwner()),
+	}, func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, addConditionalWriteHeader(conditionHeader, conditionValue))
+	})
+
+	if err != nil {
+		if isPreconditionFailed(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *S3Storage) lockKey(key string) string {
+	return fmt.Sprintf("%s/%s/%s", locksDirectory, s.Project, key)
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	log "github.com/sirupsen/logrus"
+)
+
+// Uploads are already atomic in S3, so we only need to make sure
+// the object we are replacing was not changed by someone else in the meantime.
+// That is done with a conditional write: If-Match with the current ETag,
+// or If-None-Match if the key does not exist yet.
+func (s *S3Storage) Replace(key, path string) error {
+	destination := fmt.Sprintf("%s/%s", s.Project, key)
+	headerName, headerValue, err := s.writeCondition(destination)
+	if err != nil {
+		return err
+	}
+
+	// #nosec
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	uploader := manager.NewUploader(s.Client, func(u *manager.Uploader) {
+		u.ClientOptions = append(u.ClientOptions, func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, addConditionalWriteHeader(headerName, headerValue))
+		})
+	})
+
+	_, err = uploader.Upload(context.TODO(), &s3.PutObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &destination,
+		Body:   file,
+	})
+
+	if err != nil {
+		_ = file.Close()
+		if isPreconditionFailed(err) {
+			return fmt.Errorf("key '%s' was changed by another writer during the upload", key)
+		}
+
+		log.Errorf("Error uploading: %v", err)
+		return err
+	}
+
+	return file.Close()
+}
+
+func (s *S3Storage) writeCondition(bucketKey string) (string, string, error) {
+	output, err := s.Client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &bucketKey,
+	})
+
+	if err != nil {
+		var apiErr *smithy.GenericAPIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound" {
+			return "If-None-Match", "*", nil
+		}
+
+		return "", "", err
+	}
+
+	if output.ETag == nil {
+		return "", "", fmt.Errorf("no ETag found for '%s'", bucketKey)
+	}
+
+	return "If-Match", *output.ETag, nil
+}
+
+// The SDK version we use does not expose conditional write fields,
+// so we add the header ourselves to the requests that create the object.
+func addConditionalWriteHeader(name, value string) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Build.Add(middleware.BuildMiddlewareFunc("ConditionalWrite", func(
+			ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler,
+		) (middleware.BuildOutput, middleware.Metadata, error) {
+			operation := awsmiddleware.GetOperationName(ctx)
+			if operation == "PutObject" || operation == "CompleteMultipartUpload" || operation == "DeleteObject" {
+				if request, ok := in.Request.(*smithyhttp.Request); ok {
+					request.Header.Set(name, value)
+				}
+			}
+
+			return next.HandleBuild(ctx, in)
+		}), middleware.After)
+	}
+}
+
+func isPreconditionFailed(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		return code == "PreconditionFailed" || code == "ConditionalRequestConflict"
+	}
+
+	return false
+}
@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
 )
 
 func (s *S3Storage) Restore(key string) (*os.File, error) {
@@ -17,8 +21,12 @@ func (s *S3Storage) Restore(key string) (*os.File, error) {
 	}
 
 	bucketKey := fmt.Sprintf("%s/%s", s.Project, key)
-	downloader := manager.NewDownloader(s.Client)
-	_, err = downloader.Download(context.TODO(), tempFile, &s3.GetObjectInput{
+	progressFile := transferFile(tempFile, downloadProgress(key, -1))
+	defer progressFile.Progress.Finish()
+
+	client := &sizeReportingClient{DownloadAPIClient: s.Client, progress: progressFile.Progress}
+	downloader := manager.NewDownloader(client)
+	_, err = downloader.Download(context.TODO(), progressFile, &s3.GetObjectInput{
 		Bucket: &s.Bucket,
 		Key:    &bucketKey,
 	})
@@ -30,3 +38,41 @@ func (s *S3Storage) Restore(key string) (*os.File, error) {
 
 	return tempFile, tempFile.Close()
 }
+
+// The downloader gets the object in parts, and every part tells the size of the whole object,
+// so the progress total comes from the first response, without asking for the size separately.
+type sizeReportingClient struct {
+	manager.DownloadAPIClient
+	progress *files.Progress
+	once     sync.Once
+}
+
+func (c *sizeReportingClient) GetObject(ctx context.Context, input *s3.GetObjectInput, options ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	output, err := c.DownloadAPIClient.GetObject(ctx, input, options...)
+	if err == nil {
+		c.once.Do(func() {
+			c.progress.SetTotal(objectSize(output))
+		})
+	}
+
+	return output, err
+}
+
+// Ranged responses have the size in Content-Range, e.g. 'bytes 0-99/1000'.
+func objectSize(output *s3.GetObjectOutput) int64 {
+	if output.ContentRange == nil {
+		return output.ContentLength
+	}
+
+	index := strings.LastIndex(*output.ContentRange, "/")
+	if index == -1 {
+		return -1
+	}
+
+	size, err := strconv.ParseInt((*output.ContentRange)[index+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+
+	return size
+}
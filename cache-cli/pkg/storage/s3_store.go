@@ -17,12 +17,15 @@ func (s *S3Storage) Store(key, path string) error {
 		return err
 	}
 
+	progressFile := transferFile(file, uploadProgress(key, file))
+	defer progressFile.Progress.Finish()
+
 	destination := fmt.Sprintf("%s/%s", s.Project, key)
 	uploader := manager.NewUploader(s.Client)
 	_, err = uploader.Upload(context.TODO(), &s3.PutObjectInput{
 		Bucket: &s.Bucket,
 		Key:    &destination,
-		Body:   file,
+		Body:   progressFile,
 	})
 
 	if err != nil {
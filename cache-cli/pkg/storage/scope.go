@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Scopes decide which keys are visible, for backends keeping keys from many projects in the same bucket.
+// The project scope is only visible to the project itself, and is what was used before scopes existed.
+// All other scopes, including the org one, are shared by every project using the bucket.
+const (
+	ScopeProject = "project"
+	ScopeOrg     = "org"
+)
+
+// Shared scopes live under this prefix, so they never clash with project IDs.
+const sharedScopePrefix = "shared"
+
+var scopeNameRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// Names made only of dots, like '..', are not allowed, since they are special path segments on SFTP.
+func ValidateScope(scope string) error {
+	if scope == "" || scope == ScopeProject {
+		return nil
+	}
+
+	if !scopeNameRegex.MatchString(scope) {
+		return fmt.Errorf("invalid scope '%s': only letters, digits, '.', '_' and '-' are allowed", scope)
+	}
+
+	if strings.Trim(scope, ".") == "" {
+		return fmt.Errorf("invalid scope '%s': it needs more than dots", scope)
+	}
+
+	return nil
+}
+
+func IsProjectScope(scope string) bool {
+	return scope == "" || scope == ScopeProject
+}
+
+// Returns the prefix used for the keys in the scope.
+func ScopePrefix(scope, project string) (string, error) {
+	if err := ValidateScope(scope); err != nil {
+		return "", err
+	}
+
+	if IsProjectScope(scope) {
+		if project == "" {
+			return "", fmt.Errorf("no SEMAPHORE_PROJECT_ID set")
+		}
+
+		return project, nil
+	}
+
+	return fmt.Sprintf("%s/%s", sharedScopePrefix, scope), nil
+}
+
+// Parses a comma-separated list of scopes, e.g. project,org.
+// If nothing is given, only the project scope is used.
+func ParseScopes(value string) ([]string, error) {
+	scopes := []string{}
+	for _, scope := range strings.Split(value, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+
+		if err := ValidateScope(scope); err != nil {
+			return nil, err
+		}
+
+		scopes = append(scopes, scope)
+	}
+
+	if len(scopes) == 0 {
+		return []string{ScopeProject}, nil
+	}
+
+	return scopes, nil
+}
+
+// Scopes listed in SEMAPHORE_CACHE_READ_ONLY_SCOPES can be restored from, but nothing can be stored in them.
+// This allows jobs to use a shared scope, without being able to change it.
+func IsReadOnlyScope(scope string) bool {
+	if scope == "" {
+		scope = ScopeProject
+	}
+
+	for _, readOnlyScope := range strings.Split(os.Getenv("SEMAPHORE_CACHE_READ_ONLY_SCOPES"), ",") {
+		if strings.TrimSpace(readOnlyScope) == scope {
+			return true
+		}
+	}
+
+	return false
+}
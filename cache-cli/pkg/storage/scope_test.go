@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"os"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__ScopePrefix(t *testing.T) {
+	t.Run("project scope uses project", func(t *testing.T) {
+		prefix, err := ScopePrefix(ScopeProject, "abc")
+		assert.Nil(t, err)
+		assert.Equal(t, "abc", prefix)
+
+		prefix, err = ScopePrefix("", "abc")
+		assert.Nil(t, err)
+		assert.Equal(t, "abc", prefix)
+	})
+
+	t.Run("project scope requires project", func(t *testing.T) {
+		_, err := ScopePrefix(ScopeProject, "")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("shared scopes do not use project", func(t *testing.T) {
+		prefix, err := ScopePrefix(ScopeOrg, "")
+		assert.Nil(t, err)
+		assert.Equal(t, "shared/org", prefix)
+
+		prefix, err = ScopePrefix("bazel-toolchain", "abc")
+		assert.Nil(t, err)
+		assert.Equal(t, "shared/bazel-toolchain", prefix)
+	})
+
+	t.Run("invalid scope", func(t *testing.T) {
+		_, err := ScopePrefix("../other-project", "abc")
+		assert.NotNil(t, err)
+
+		for _, scope := range []string{".", "..", "..."} {
+			_, err = ScopePrefix(scope, "abc")
+			assert.NotNil(t, err, scope)
+		}
+
+		prefix, err := ScopePrefix("v1.2", "abc")
+		assert.Nil(t, err)
+		assert.Equal(t, "shared/v1.2", prefix)
+	})
+}
+
+func Test__ParseScopes(t *testing.T) {
+	scopes, err := ParseScopes("")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ScopeProject}, scopes)
+
+	scopes, err = ParseScopes("project, org,m2")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ScopeProject, ScopeOrg, "m2"}, scopes)
+
+	_, err = ParseScopes("project,not/valid")
+	assert.NotNil(t, err)
+}
+
+func Test__IsReadOnlyScope(t *testing.T) {
+	os.Setenv("SEMAPHORE_CACHE_READ_ONLY_SCOPES", "org, m2")
+	defer os.Unsetenv("SEMAPHORE_CACHE_READ_ONLY_SCOPES")
+
+	assert.True(t, IsReadOnlyScope(ScopeOrg))
+	assert.True(t, IsReadOnlyScope("m2"))
+	assert.False(t, IsReadOnlyScope(ScopeProject))
+	assert.False(t, IsReadOnlyScope(""))
+}
+
+func Test__InitStorageWithScope(t *testing.T) {
+	os.Setenv("SEMAPHORE_CACHE_BACKEND", "sftp")
+	defer os.Unsetenv("SEMAPHORE_CACHE_BACKEND")
+
+	_, err := InitStorageWithConfig(StorageConfig{SortKeysBy: SortByStoreTime, Scope: ScopeOrg})
+	assert.EqualError(t, err, "scope 'org' is not supported by the sftp backend")
+}
@@ -0,0 +1,12 @@
+package storage
+
+func (s *SFTPStorage) DeleteMany(keys []CacheKey) error {
+	for _, key := range keys {
+		err := s.Delete(key.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -2,7 +2,6 @@ package storage
 
 import (
 	"io/fs"
-	"sort"
 	"time"
 
 	"github.com/pkg/sftp"
@@ -16,6 +15,11 @@ func (s *SFTPStorage) List() ([]CacheKey, error) {
 
 	keys := []CacheKey{}
 	for _, file := range files {
+		// Keys are always files. Directories are used for internal purposes, like locks.
+		if file.IsDir() {
+			continue
+		}
+
 		storedAt := file.ModTime()
 		keys = append(keys, CacheKey{
 			Name:           file.Name(),
@@ -25,26 +29,7 @@ func (s *SFTPStorage) List() ([]CacheKey, error) {
 		})
 	}
 
-	return s.sortKeys(keys), nil
-}
-
-func (s *SFTPStorage) sortKeys(keys []CacheKey) []CacheKey {
-	switch s.Config().SortKeysBy {
-	case SortBySize:
-		sort.SliceStable(keys, func(i, j int) bool {
-			return keys[i].Size > keys[j].Size
-		})
-	case SortByAccessTime:
-		sort.SliceStable(keys, func(i, j int) bool {
-			return keys[i].LastAccessedAt.After(*keys[j].LastAccessedAt)
-		})
-	default:
-		sort.SliceStable(keys, func(i, j int) bool {
-			return keys[i].StoredAt.After(*keys[j].StoredAt)
-		})
-	}
-
-	return keys
+	return SortKeys(keys, s.Config().SortKeysBy), nil
 }
 
 // If we can't figure out the access time of the file,
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Locks are files created with O_EXCL inside the locks directory,
+// which is ignored when listing keys.
+func (s *SFTPStorage) AcquireLock(key string) (bool, error) {
+	err := s.SFTPClient.MkdirAll(locksDirectory)
+	if err != nil {
+		return false, err
+	}
+
+	lockPath := path.Join(locksDirectory, key)
+	acquired, err := s.createLockFile(lockPath)
+	if err != nil || acquired {
+		return acquired, err
+	}
+
+	info, err := s.SFTPClient.Stat(lockPath)
+	if err != nil {
+		return false, err
+	}
+
+	if !isLockExpired(info.ModTime()) {
+		return false, nil
+	}
+
+	return s.takeOverLock(key, lockPath)
+}
+
+// An expired lock is first moved out of the way with a rename, which only one job can do,
+// so two jobs finding it expired at the same time don't both remove it and create their own.
+func (s *SFTPStorage) takeOverLock(key, lockPath string) (bool, error) {
+	expiredPath := lockPath + ".expired-" + strings.ReplaceAll(lockOwner(), "/", "-")
+	if err := s.SFTPClient.Rename(lockPath, expiredPath); err != nil {
+		return false, nil
+	}
+
+	// Someone else might have taken the lock over between our check and the rename,
+	// and the lock we moved is theirs, so we put it back.
+	info, err := s.SFTPClient.Stat(expiredPath)
+	if err == nil && !isLockExpired(info.ModTime()) {
+		if err := s.SFTPClient.Rename(expiredPath, lockPath); err != nil {
+			_ = s.SFTPClient.Remove(expiredPath)
+		}
+
+		return false, nil
+	}
+
+	log.Warnf("Lock for key '%s' expired, taking it over.", key)
+	if err := s.SFTPClient.Remove(expiredPath); err != nil && !strings.Contains(err.Error(), "file does not exist") {
+		return false, err
+	}
+
+	return s.createLockFile(lockPath)
+}
+
+func (s *SFTPStorage) RefreshLock(key string) error {
+	lockPath := path.Join(locksDirectory, key)
+	err := s.checkLockOwner(key, lockPath)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return s.SFTPClient.Chtimes(lockPath, now, now)
+}
+
+// The lock is only removed if it is still ours,
+// so a job whose lock expired and was taken over doesn't remove the lock of the new owner.
+func (s *SFTPStorage) ReleaseLock(key string) error {
+	lockPath := path.Join(locksDirectory, key)
+	err := s.checkLockOwner(key, lockPath)
+	if err == nil {
+		err = s.SFTPClient.Remove(lockPath)
+	}
+
+	if err != nil && strings.Contains(err.Error(), "file does not exist") {
+		return nil
+	}
+
+	return err
+}
+
+func (s *SFTPStorage) checkLockOwner(key, lockPath string) error {
+	file, err := s.SFTPClient.Open(lockPath)
+	if err != nil {
+		return err
+	}
+
+	owner, err := io.ReadAll(file)
+	_ = file.Close()
+	if err != nil {
+		return err
+	}
+
+	if string(owner) != lockOwner() {
+		return errLockLost(key)
+	}
+
+	return nil
+}
+
+func (s *SFTPStorage) createLockFile(lockPath string) (bool, error) {
+	file, err := s.SFTPClient.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		// Not all servers report a proper error code when the file already exists,
+		// so we check if the lock is there before giving up.
+		if _, statErr := s.SFTPClient.Stat(lockPath); statErr == nil {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	_, err = file.Write([]byte(lockOwner()))
+	if err != nil {
+		_ = file.Close()
+		return false, err
+	}
+
+	return true, file.Close()
+}
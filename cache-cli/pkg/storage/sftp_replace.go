@@ -0,0 +1,20 @@
+package storage
+
+import "strings"
+
+// Store already uploads to a temporary file and renames it to the key,
+// and the rename replaces an existing key atomically.
+// The space used by the key being replaced is freed by the rename,
+// so it is not counted when making space for the new file, and the key is never evicted for it.
+func (s *SFTPStorage) Replace(key, path string) error {
+	file, err := s.SFTPClient.Stat(key)
+	if file == nil {
+		if err != nil && !strings.Contains(err.Error(), "file does not exist") {
+			return err
+		}
+
+		return s.store(key, path, nil)
+	}
+
+	return s.store(key, path, &CacheKey{Name: key, Size: file.Size()})
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 )
@@ -19,7 +20,14 @@ func (s *SFTPStorage) Restore(key string) (*os.File, error) {
 		return nil, err
 	}
 
-	_, err = localFile.ReadFrom(remoteFile)
+	total := int64(-1)
+	if info, err := remoteFile.Stat(); err == nil {
+		total = info.Size()
+	}
+
+	progressFile := transferFile(localFile, downloadProgress(key, total))
+	_, err = io.Copy(progressFile, remoteFile)
+	progressFile.Progress.Finish()
 	if err != nil {
 		_ = localFile.Close()
 		_ = remoteFile.Close()
@@ -5,10 +5,15 @@ import (
 	"os"
 	"time"
 
+	"github.com/semaphoreci/toolbox/cache-cli/pkg/files"
 	log "github.com/sirupsen/logrus"
 )
 
 func (s *SFTPStorage) Store(key, path string) error {
+	return s.store(key, path, nil)
+}
+
+func (s *SFTPStorage) store(key, path string, replaced *CacheKey) error {
 	epochNanos := time.Now().UnixNano()
 	tmpKey := fmt.Sprintf("%s-%d", os.Getenv("SEMAPHORE_JOB_ID"), epochNanos)
 
@@ -17,7 +22,7 @@ func (s *SFTPStorage) Store(key, path string) error {
 		return err
 	}
 
-	err = s.allocateSpace(localFileInfo.Size())
+	err = s.allocateSpace(localFileInfo.Size(), replaced)
 	if err != nil {
 		return err
 	}
@@ -34,7 +39,9 @@ func (s *SFTPStorage) Store(key, path string) error {
 		return err
 	}
 
-	_, err = remoteTmpFile.ReadFrom(localFile)
+	progressFile := transferFile(localFile, uploadProgress(key, localFile))
+	_, err = remoteTmpFile.ReadFrom(progressFile)
+	progressFile.Progress.Finish()
 
 	if err != nil {
 		if rmErr := s.SFTPClient.Remove(tmpKey); rmErr != nil {
@@ -66,32 +73,51 @@ func (s *SFTPStorage) Store(key, path string) error {
 	return localFile.Close()
 }
 
-func (s *SFTPStorage) allocateSpace(space int64) error {
+func (s *SFTPStorage) allocateSpace(space int64, replaced *CacheKey) error {
 	usage, err := s.Usage()
 	if err != nil {
 		return err
 	}
 
-	freeSpace := usage.Free
-	if freeSpace < space {
-		fmt.Printf("Not enough space, deleting keys based on %s...\n", s.Config().SortKeysBy)
-		keys, err := s.List()
-		if err != nil {
-			return err
-		}
+	free := usage.Free
+	if replaced != nil {
+		free += replaced.Size
+	}
 
-		for freeSpace < space {
-			lastKey := keys[len(keys)-1]
-			err = s.Delete(lastKey.Name)
-			if err != nil {
-				return err
-			}
+	if free >= space {
+		return nil
+	}
+
+	log.Infof("Not enough space, deleting keys based on %s...", s.Config().SortKeysBy)
+	keys, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	if replaced != nil {
+		keys = withoutKey(keys, replaced.Name)
+	}
+
+	// Nothing is deleted if the key would not fit anyway.
+	plan := NewEvictionPolicy(s.Config().SortKeysBy).Plan(keys, space-free)
+	if !plan.IsEnough() {
+		return fmt.Errorf(
+			"not enough space: %s needed, but only %s can be freed without deleting pinned keys",
+			files.HumanReadableSize(plan.Required),
+			files.HumanReadableSize(plan.Freed),
+		)
+	}
+
+	return Evict(s, plan)
+}
 
-			log.Infof("Key '%s' is deleted.", lastKey.Name)
-			freeSpace = freeSpace + lastKey.Size
-			keys = keys[:len(keys)-1]
+func withoutKey(keys []CacheKey, name string) []CacheKey {
+	filtered := []CacheKey{}
+	for _, key := range keys {
+		if key.Name != name {
+			filtered = append(filtered, key)
 		}
 	}
 
-	return nil
+	return filtered
 }
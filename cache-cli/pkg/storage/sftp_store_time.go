@@ -0,0 +1,7 @@
+package storage
+
+import "time"
+
+func (s *SFTPStorage) SetStoreTime(key string, storedAt time.Time) error {
+	return s.SFTPClient.Chtimes(key, storedAt, storedAt)
+}
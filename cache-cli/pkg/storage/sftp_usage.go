@@ -8,6 +8,11 @@ func (s *SFTPStorage) Usage() (*UsageSummary, error) {
 
 	var totalUsed int64
 	for _, file := range files {
+		// Keys are always files. Directories are used for internal purposes, like locks.
+		if file.IsDir() {
+			continue
+		}
+
 		totalUsed = totalUsed + file.Size()
 	}
 
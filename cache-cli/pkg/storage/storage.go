@@ -14,43 +14,58 @@ type Storage interface {
 	List() ([]CacheKey, error)
 	HasKey(key string) (bool, error)
 	Store(key, path string) error
+	Replace(key, path string) error
+	AcquireLock(key string) (bool, error)
+	RefreshLock(key string) error
+	ReleaseLock(key string) error
 	Restore(key string) (*os.File, error)
 	Delete(key string) error
+	DeleteMany(keys []CacheKey) error
 	Clear() error
 	Usage() (*UsageSummary, error)
 	IsNotEmpty() (bool, error)
 	Config() StorageConfig
 }
 
+// Implemented by backends that allow changing when a key was stored.
+// Object stores like S3 and GCS always use the time of the upload.
+type StoreTimeSetter interface {
+	SetStoreTime(key string, storedAt time.Time) error
+}
+
 const SortBySize = "SIZE"
 const SortByStoreTime = "STORE_TIME"
 const SortByAccessTime = "ACCESS_TIME"
 
 var ValidSortByKeys = []string{SortBySize, SortByStoreTime, SortByAccessTime}
 
+// Scope is one of the Scope* constants, or the name of a custom scope.
+// If empty, the project scope is used.
 type StorageConfig struct {
 	MaxSpace   int64
 	SortKeysBy string
+	Scope      string
 }
 
 func (c *StorageConfig) Validate() error {
-	if contains(c.SortKeysBy, ValidSortByKeys) {
-		return nil
+	if !contains(c.SortKeysBy, ValidSortByKeys) {
+		return fmt.Errorf("sorting keys by '%s' is not supported", c.SortKeysBy)
 	}
 
-	return fmt.Errorf("sorting keys by '%s' is not supported", c.SortKeysBy)
+	return ValidateScope(c.Scope)
 }
 
 type CacheKey struct {
-	Name           string
-	StoredAt       *time.Time
-	LastAccessedAt *time.Time
-	Size           int64
+	Name           string     `json:"name"`
+	StoredAt       *time.Time `json:"stored_at"`
+	LastAccessedAt *time.Time `json:"last_accessed_at"`
+	Size           int64      `json:"size"`
 }
 
+// Free is -1 if the storage has no space limit.
 type UsageSummary struct {
-	Free int64
-	Used int64
+	Free int64 `json:"free"`
+	Used int64 `json:"used"`
 }
 
 func InitStorage() (Storage, error) {
@@ -70,9 +85,9 @@ func InitStorageWithConfig(config StorageConfig) (Storage, error) {
 
 	switch backend {
 	case "s3":
-		project := os.Getenv("SEMAPHORE_PROJECT_ID")
-		if project == "" {
-			return nil, fmt.Errorf("no SEMAPHORE_PROJECT_ID set")
+		project, err := ScopePrefix(config.Scope, os.Getenv("SEMAPHORE_PROJECT_ID"))
+		if err != nil {
+			return nil, err
 		}
 
 		s3Bucket := os.Getenv("SEMAPHORE_CACHE_S3_BUCKET")
@@ -84,10 +99,14 @@ func InitStorageWithConfig(config StorageConfig) (Storage, error) {
 			URL:     os.Getenv("SEMAPHORE_CACHE_S3_URL"),
 			Bucket:  s3Bucket,
 			Project: project,
-			Config:  StorageConfig{MaxSpace: math.MaxInt64, SortKeysBy: config.SortKeysBy},
+			Config:  StorageConfig{MaxSpace: math.MaxInt64, SortKeysBy: config.SortKeysBy, Scope: config.Scope},
 		})
 
 	case "sftp":
+		if !IsProjectScope(config.Scope) {
+			return nil, fmt.Errorf("scope '%s' is not supported by the sftp backend", config.Scope)
+		}
+
 		url := os.Getenv("SEMAPHORE_CACHE_URL")
 		if url == "" {
 			return nil, fmt.Errorf("no SEMAPHORE_CACHE_URL set")
@@ -110,9 +129,9 @@ func InitStorageWithConfig(config StorageConfig) (Storage, error) {
 			Config:         buildStorageConfig(config, 9*1024*1024*1024),
 		})
 	case "gcs":
-		project := os.Getenv("SEMAPHORE_PROJECT_ID")
-		if project == "" {
-			return nil, fmt.Errorf("no SEMAPHORE_PROJECT_ID set")
+		project, err := ScopePrefix(config.Scope, os.Getenv("SEMAPHORE_PROJECT_ID"))
+		if err != nil {
+			return nil, err
 		}
 
 		gcsBucket := os.Getenv("SEMAPHORE_CACHE_GCS_BUCKET")
@@ -123,7 +142,7 @@ func InitStorageWithConfig(config StorageConfig) (Storage, error) {
 		return NewGCSStorage(GCSStorageOptions{
 			Bucket:  gcsBucket,
 			Project: project,
-			Config:  StorageConfig{MaxSpace: math.MaxInt64, SortKeysBy: config.SortKeysBy},
+			Config:  StorageConfig{MaxSpace: math.MaxInt64, SortKeysBy: config.SortKeysBy, Scope: config.Scope},
 		})
 	default:
 		return nil, fmt.Errorf("cache backend '%s' is not available", backend)
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Describes a storage backend using a URL, instead of the SEMAPHORE_CACHE_* environment variables.
+// This is used when more than one backend is needed at the same time, e.g. when migrating keys.
+// Supported formats:
+//   - env: use the backend configured through the environment, as usual
+//   - s3://<bucket>/<project>?endpoint=<url>
+//   - gcs://<bucket>/<project>
+//   - sftp://<username>@<host>:<port>?private-key=<path>
+//
+// If <project> is not given, SEMAPHORE_PROJECT_ID is used.
+// If private-key is not given, SEMAPHORE_CACHE_PRIVATE_KEY_PATH is used.
+type storageURL struct {
+	Backend        string
+	Bucket         string
+	Project        string
+	Endpoint       string
+	Host           string
+	Username       string
+	PrivateKeyPath string
+}
+
+func InitStorageFromURL(rawURL string, config StorageConfig) (Storage, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	storageURL, err := parseStorageURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// For shared scopes, the project in the URL is not used.
+	switch storageURL.Backend {
+	case "env":
+		return InitStorageWithConfig(config)
+	case "s3":
+		prefix, err := ScopePrefix(config.Scope, storageURL.Project)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewS3Storage(S3StorageOptions{
+			URL:     storageURL.Endpoint,
+			Bucket:  storageURL.Bucket,
+			Project: prefix,
+			Config:  StorageConfig{MaxSpace: math.MaxInt64, SortKeysBy: config.SortKeysBy, Scope: config.Scope},
+		})
+	case "gcs":
+		prefix, err := ScopePrefix(config.Scope, storageURL.Project)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewGCSStorage(GCSStorageOptions{
+			Bucket:  storageURL.Bucket,
+			Project: prefix,
+			Config:  StorageConfig{MaxSpace: math.MaxInt64, SortKeysBy: config.SortKeysBy, Scope: config.Scope},
+		})
+	default:
+		if !IsProjectScope(config.Scope) {
+			return nil, fmt.Errorf("scope '%s' is not supported by the sftp backend", config.Scope)
+		}
+
+		return NewSFTPStorage(SFTPStorageOptions{
+			URL:            storageURL.Host,
+			Username:       storageURL.Username,
+			PrivateKeyPath: storageURL.PrivateKeyPath,
+			Config:         buildStorageConfig(config, 9*1024*1024*1024),
+		})
+	}
+}
+
+func parseStorageURL(rawURL string) (*storageURL, error) {
+	if rawURL == "env" {
+		return &storageURL{Backend: "env"}, nil
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage URL '%s': %v", rawURL, err)
+	}
+
+	project := strings.Trim(parsed.Path, "/")
+	if project == "" {
+		project = os.Getenv("SEMAPHORE_PROJECT_ID")
+	}
+
+	switch parsed.Scheme {
+	case "s3", "gcs":
+		if parsed.Host == "" {
+			return nil, fmt.Errorf("no bucket set in storage URL '%s'", rawURL)
+		}
+
+		if project == "" {
+			return nil, fmt.Errorf("no project set in storage URL '%s', and no SEMAPHORE_PROJECT_ID set", rawURL)
+		}
+
+		return &storageURL{
+			Backend:  parsed.Scheme,
+			Bucket:   parsed.Host,
+			Project:  project,
+			Endpoint: parsed.Query().Get("endpoint"),
+		}, nil
+
+	case "sftp":
+		if parsed.Host == "" || parsed.User == nil || parsed.User.Username() == "" {
+			return nil, fmt.Errorf("storage URL '%s' should be in the format sftp://<username>@<host>:<port>", rawURL)
+		}
+
+		privateKeyPath := parsed.Query().Get("private-key")
+		if privateKeyPath == "" {
+			privateKeyPath = os.Getenv("SEMAPHORE_CACHE_PRIVATE_KEY_PATH")
+		}
+
+		if privateKeyPath == "" {
+			return nil, fmt.Errorf("no private key set in storage URL '%s', and no SEMAPHORE_CACHE_PRIVATE_KEY_PATH set", rawURL)
+		}
+
+		return &storageURL{
+			Backend:        "sftp",
+			Host:           parsed.Host,
+			Username:       parsed.User.Username(),
+			PrivateKeyPath: privateKeyPath,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("cache backend '%s' is not available", parsed.Scheme)
+	}
+}
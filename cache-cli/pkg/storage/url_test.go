@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"os"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__ParseStorageURL(t *testing.T) {
+	t.Run("env", func(t *testing.T) {
+		parsed, err := parseStorageURL("env")
+		assert.Nil(t, err)
+		assert.Equal(t, &storageURL{Backend: "env"}, parsed)
+	})
+
+	t.Run("s3", func(t *testing.T) {
+		parsed, err := parseStorageURL("s3://my-bucket/my-project?endpoint=http://s3:9000")
+		assert.Nil(t, err)
+		assert.Equal(t, &storageURL{Backend: "s3", Bucket: "my-bucket", Project: "my-project", Endpoint: "http://s3:9000"}, parsed)
+	})
+
+	t.Run("gcs using SEMAPHORE_PROJECT_ID", func(t *testing.T) {
+		os.Setenv("SEMAPHORE_PROJECT_ID", "env-project")
+		defer os.Unsetenv("SEMAPHORE_PROJECT_ID")
+
+		parsed, err := parseStorageURL("gcs://my-bucket")
+		assert.Nil(t, err)
+		assert.Equal(t, &storageURL{Backend: "gcs", Bucket: "my-bucket", Project: "env-project"}, parsed)
+	})
+
+	t.Run("s3 without project", func(t *testing.T) {
+		os.Unsetenv("SEMAPHORE_PROJECT_ID")
+		_, err := parseStorageURL("s3://my-bucket")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("sftp", func(t *testing.T) {
+		parsed, err := parseStorageURL("sftp://tester@sftp-server:22?private-key=/root/.ssh/key")
+		assert.Nil(t, err)
+		assert.Equal(t, &storageURL{Backend: "sftp", Host: "sftp-server:22", Username: "tester", PrivateKeyPath: "/root/.ssh/key"}, parsed)
+	})
+
+	t.Run("sftp without username", func(t *testing.T) {
+		_, err := parseStorageURL("sftp://sftp-server:22?private-key=/root/.ssh/key")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("unknown backend", func(t *testing.T) {
+		_, err := parseStorageURL("ftp://server")
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,50 @@
+//revive:disable-next-line:var-naming
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Same as time.ParseDuration, but also accepts days and weeks, e.g. 30d or 2w.
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("invalid duration '%s'", value)
+	}
+
+	var unit time.Duration
+	switch value[len(value)-1] {
+	case 'd':
+		unit = 24 * time.Hour
+	case 'w':
+		unit = 7 * 24 * time.Hour
+	default:
+		return time.ParseDuration(value)
+	}
+
+	number, err := strconv.ParseFloat(value[:len(value)-1], 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid duration '%s'", value)
+	}
+
+	return time.Duration(number * float64(unit)), nil
+}
+
+// Accepts either a duration relative to now (7d), or a date (2022-03-01, or RFC3339).
+func ParseTimeOrAge(value string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	age, err := ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date or duration '%s'", value)
+	}
+
+	return now.Add(-age), nil
+}
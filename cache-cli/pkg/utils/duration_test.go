@@ -0,0 +1,61 @@
+//revive:disable-next-line:var-naming
+package utils
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test__ParseDuration(t *testing.T) {
+	t.Run("go durations", func(t *testing.T) {
+		duration, err := ParseDuration("12h30m")
+		assert.Nil(t, err)
+		assert.Equal(t, 12*time.Hour+30*time.Minute, duration)
+	})
+
+	t.Run("days and weeks", func(t *testing.T) {
+		duration, err := ParseDuration("30d")
+		assert.Nil(t, err)
+		assert.Equal(t, 30*24*time.Hour, duration)
+
+		duration, err = ParseDuration("2w")
+		assert.Nil(t, err)
+		assert.Equal(t, 14*24*time.Hour, duration)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, value := range []string{"", "d", "abc", "-1d", "10x"} {
+			_, err := ParseDuration(value)
+			assert.NotNil(t, err, value)
+		}
+	})
+}
+
+func Test__ParseTimeOrAge(t *testing.T) {
+	now := time.Date(2022, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	t.Run("date", func(t *testing.T) {
+		parsed, err := ParseTimeOrAge("2022-03-01", now)
+		assert.Nil(t, err)
+		assert.Equal(t, time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), parsed)
+	})
+
+	t.Run("timestamp", func(t *testing.T) {
+		parsed, err := ParseTimeOrAge("2022-03-01T10:00:00Z", now)
+		assert.Nil(t, err)
+		assert.Equal(t, time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC), parsed)
+	})
+
+	t.Run("age", func(t *testing.T) {
+		parsed, err := ParseTimeOrAge("7d", now)
+		assert.Nil(t, err)
+		assert.Equal(t, time.Date(2022, 3, 3, 12, 0, 0, 0, time.UTC), parsed)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ParseTimeOrAge("yesterday", now)
+		assert.NotNil(t, err)
+	})
+}